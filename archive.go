@@ -0,0 +1,215 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Large archives lying around a projects directory are usually old backups
+// or builds exported for someone. They are found by the walker's file
+// callback and classified by peeking at the start of their listing.
+
+const archivePattern = "archive"
+
+const (
+	largeArchiveSize = 100 << 20
+	// peekEntries and peekBytes bound how much of an archive is read while
+	// scanning; a tarball has to be decompressed to reach its headers.
+	peekEntries = 200
+	peekBytes   = 64 << 20
+	// listingEntries bounds the listing shown in the preview.
+	listingEntries = 1000
+)
+
+var archiveSuffixes = []string{".tar.gz", ".tgz", ".tar", ".zip", ".7z"}
+
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+var errListingUnsupported = errors.New("listing 7z archives is not supported")
+
+// archiveEntries lists up to limit entries of the archive at p, reading at
+// most maxBytes of decompressed tar data when maxBytes > 0. A listing cut
+// short by maxBytes is returned without an error.
+func archiveEntries(p string, limit int, maxBytes int64) ([]previewEntry, error) {
+	lower := strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		r, err := zip.OpenReader(fsPath(p))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		var entries []previewEntry
+		for _, f := range r.File {
+			if len(entries) == limit {
+				break
+			}
+			entries = append(entries, previewEntry{
+				name:  strings.TrimSuffix(f.Name, "/"),
+				size:  int64(f.UncompressedSize64),
+				isDir: strings.HasSuffix(f.Name, "/"),
+			})
+		}
+		return entries, nil
+
+	case strings.HasSuffix(lower, ".7z"):
+		return nil, errListingUnsupported
+	}
+
+	f, err := os.Open(fsPath(p))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(lower, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if maxBytes > 0 {
+		r = io.LimitReader(r, maxBytes)
+	}
+
+	var entries []previewEntry
+	tr := tar.NewReader(r)
+	for len(entries) < limit {
+		hdr, err := tr.Next()
+		if err == io.EOF || (err != nil && len(entries) > 0 && maxBytes > 0) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, previewEntry{
+			name:  strings.TrimSuffix(hdr.Name, "/"),
+			size:  hdr.Size,
+			isDir: hdr.Typeflag == tar.TypeDir,
+		})
+	}
+	return entries, nil
+}
+
+var (
+	backupWords   = []string{"backup", "bak", "snapshot", "dump"}
+	buildDirs     = []string{"dist", "build", "target", "out", "release", "bin"}
+	buildSuffixes = []string{".exe", ".dll", ".so", ".dylib", ".jar", ".war", ".apk", ".ipa", ".wasm", ".app"}
+)
+
+// classifyArchive tells what kind of archive name with the given entries is.
+func classifyArchive(name string, entries []previewEntry) string {
+	lower := strings.ToLower(name)
+	for _, word := range backupWords {
+		if strings.Contains(lower, word) {
+			return "old backup"
+		}
+	}
+
+	var builds, projects, repos int
+	for _, entry := range entries {
+		elems := strings.Split(entry.name, "/")
+		base := elems[len(elems)-1]
+		switch {
+		case containsAny(elems[:len(elems)-1], buildDirs) || hasAnySuffix(strings.ToLower(base), buildSuffixes):
+			builds++
+		case containsAny(elems, projectMarkers):
+			projects++
+		}
+		if slices.Contains(elems, ".git") {
+			repos++
+		}
+	}
+	switch {
+	case repos > 0:
+		return "old backup"
+	case builds > 0 && builds >= len(entries)/2:
+		return "exported build"
+	case projects > 0:
+		return "project export"
+	}
+	return ""
+}
+
+func containsAny(elems, names []string) bool {
+	for _, e := range elems {
+		for _, name := range names {
+			if e == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectArchive is the walker's file callback for the large archives
+// detector.
+func detectArchive(p string, e os.DirEntry) (CleanableItem, bool) {
+	if !e.Type().IsRegular() || !isArchive(e.Name()) {
+		return CleanableItem{}, false
+	}
+	info, err := e.Info()
+	if err != nil || info.Size() < largeArchiveSize {
+		return CleanableItem{}, false
+	}
+
+	entries, _ := archiveEntries(p, peekEntries, peekBytes)
+	typ := "Archive"
+	if kind := classifyArchive(e.Name(), entries); kind != "" {
+		typ += ": " + kind
+	}
+	return CleanableItem{
+		Path:    p,
+		Type:    typ,
+		Pattern: archivePattern,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Info:    "Large archive; check it isn't the only copy before cleaning",
+	}, true
+}
+
+// loadArchiveListing is loadPreview for archives: it lists the entries inside
+// instead of reading a directory.
+func loadArchiveListing(p string) tea.Cmd {
+	return func() tea.Msg {
+		entries, err := archiveEntries(p, listingEntries, 0)
+		if err != nil {
+			return previewMsg{path: p, archive: true, err: err}
+		}
+		truncated := len(entries) == listingEntries
+		// directory entries have no size of their own
+		entries = slices.DeleteFunc(entries, func(e previewEntry) bool { return e.isDir })
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].size > entries[j].size
+		})
+		return previewMsg{path: p, archive: true, entries: entries, truncated: truncated}
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// With --archive, every item is compressed into a timestamped tar.zst, or
+// tar.gz with --compression gzip, in the archive directory before it is
+// deleted, so build outputs that took hours to produce can be restored
+// instead of rebuilt. Entries keep the full path of the item, so extracting
+// the archive at the root of the filesystem (tar -xf ARCHIVE -C /) puts it
+// back where it was. zstd compression is left to the zstd command, which
+// uses every core; gzip uses pigz when it is on the PATH for the same reason
+// and compresses in-process otherwise.
+//
+// Next to every archive is a manifest, ARCHIVE.manifest.json, with the
+// checksum of every file and the mode, modification time and link target of
+// every entry. devtidy restore checks the extracted tree against it before
+// putting it in place, so a restored tree is the one that was archived.
+
+var errNoZstd = errors.New("zstd is not on the PATH, so items can't be archived; --compression gzip doesn't need it")
+
+// compression is how archives are compressed.
+type compression struct {
+	// name is zstd or gzip
+	name string
+	// level is the compression level, 0 for the compressor's default
+	level int
+}
+
+// archiveCompression is the compression of new archives, set from
+// --compression and --compression-level.
+var archiveCompression = compression{name: "zstd"}
+
+// maxLevels are the compressions and their highest level.
+var maxLevels = map[string]int{"zstd": 22, "gzip": 9}
+
+// parseCompression checks a compression and its level; an empty name is
+// zstd.
+func parseCompression(name string, level int) (compression, error) {
+	if name == "" {
+		name = "zstd"
+	}
+	maxLevel, ok := maxLevels[name]
+	if !ok {
+		return compression{}, fmt.Errorf("unknown compression %q (zstd or gzip)", name)
+	}
+	if level < 0 || level > maxLevel {
+		return compression{}, fmt.Errorf("the %s level must be between 1 and %d, or 0 for its default", name, maxLevel)
+	}
+	return compression{name: name, level: level}, nil
+}
+
+// ext is the extension of archives compressed with c.
+func (c compression) ext() string {
+	if c.name == "gzip" {
+		return ".tar.gz"
+	}
+	return ".tar.zst"
+}
+
+// archiveExts are the extensions of every compression.
+var archiveExts = []string{".tar.zst", ".tar.gz"}
+
+// compress starts compressing into out. Closing the writer returned
+// finishes the compressed stream, but doesn't close out.
+func (c compression) compress(out io.Writer) (io.WriteCloser, error) {
+	if c.name == "gzip" {
+		if pigz, err := exec.LookPath("pigz"); err == nil {
+			return startCompressor(out, pigz, c.level, "-c")
+		}
+		level := c.level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(out, level)
+	}
+	zstd, err := exec.LookPath("zstd")
+	if err != nil {
+		return nil, errNoZstd
+	}
+	args := []string{"-T0", "-c"}
+	if c.level > 19 {
+		args = append(args, "--ultra")
+	}
+	return startCompressor(out, zstd, c.level, args...)
+}
+
+// startCompressor runs a compressor command writing to out, at level unless
+// it is 0.
+func startCompressor(out io.Writer, command string, level int, args ...string) (io.WriteCloser, error) {
+	args = append([]string{"-q"}, args...)
+	if level > 0 {
+		args = append(args, fmt.Sprintf("-%d", level))
+	}
+	cmd := exec.Command(command, args...)
+	cmd.Stdout = out
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandWriter{WriteCloser: stdin, cmd: cmd, stderr: &stderr}, nil
+}
+
+// commandWriter is the input of a command; closing it waits for the command
+// and fails when the command does.
+type commandWriter struct {
+	io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *strings.Builder
+}
+
+func (w *commandWriter) Close() error {
+	w.WriteCloser.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %s", filepath.Base(w.cmd.Path), strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+// archiveName is the file an item is archived to: the names of its project
+// and itself, a hash of its full path, so items of projects with the same
+// name get different archives, and the time, with the extension ext. n
+// counts names already taken.
+func archiveName(path, ext string, t time.Time, n int) string {
+	sum := sha256.Sum256([]byte(path))
+	name := fmt.Sprintf("%s-%s-%x-%s", filepath.Base(filepath.Dir(path)), filepath.Base(path), sum[:4], t.Format("20060102-150405"))
+	if n > 0 {
+		name += fmt.Sprintf("-%d", n+1)
+	}
+	return name + ext
+}
+
+// createArchive creates the partial file of a new archive in dir, under a
+// name neither it nor the archive is taken by.
+func createArchive(path, dir, ext string) (archive string, f *os.File, err error) {
+	now := time.Now()
+	for n := 0; ; n++ {
+		archive = filepath.Join(dir, archiveName(path, ext, now, n))
+		if _, err := os.Lstat(archive); err == nil {
+			continue
+		}
+		f, err = os.OpenFile(archive+partialSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if os.IsExist(err) {
+			continue
+		}
+		return archive, f, err
+	}
+}
+
+// publishArchive gives a complete archive its name, without replacing a file
+// that took the name in the meantime.
+func publishArchive(partial, archive string) error {
+	err := os.Link(partial, archive)
+	if err == nil {
+		return os.Remove(partial)
+	}
+	if os.IsExist(err) {
+		return fmt.Errorf("%s was created while archiving", archive)
+	}
+	// Filesystems without hard links, like exFAT
+	if _, statErr := os.Lstat(archive); statErr == nil {
+		return fmt.Errorf("%s was created while archiving", archive)
+	}
+	return os.Rename(partial, archive)
+}
+
+// archiveEntry is the name of path in an archive: its path from the root of
+// its volume.
+func archiveEntry(path string) string {
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
+
+// archiveItem writes path to a new archive in dir and returns its path. A
+// failed archive is removed again.
+func archiveItem(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	// Written under another name until complete, so an interrupted archive
+	// is never taken for a good one
+	archive, out, err := createArchive(path, dir, archiveCompression.ext())
+	if err != nil {
+		return "", err
+	}
+	partial := archive + partialSuffix
+	w, err := archiveCompression.compress(out)
+	if err != nil {
+		out.Close()
+		os.Remove(partial)
+		return "", err
+	}
+	files, err := writeTar(w, path)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = publishArchive(partial, archive)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	manifest := archiveManifest{Path: path, Created: time.Now(), Files: files}
+	if err := writeManifest(archive, manifest); err != nil {
+		os.Remove(archive)
+		return "", fmt.Errorf("writing the manifest: %w", err)
+	}
+	return archive, nil
+}
+
+// writeTar writes the tree at root to w and describes what it wrote for the
+// manifest. Sockets and devices, which tar can't hold or which builds don't
+// leave behind, are left out. Modification times are kept to the
+// nanosecond, for builds that compare them.
+func writeTar(w io.Writer, root string) ([]manifestEntry, error) {
+	tw := tar.NewWriter(w)
+	var files []manifestEntry
+	base := fsPath(root)
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = archiveEntry(filepath.Join(root, rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Format = tar.FormatPAX
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		entry := manifestEntry{
+			Name:    filepath.ToSlash(rel),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+			Link:    link,
+		}
+		if info.Mode().IsRegular() {
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			sum := sha256.New()
+			if entry.Size, err = io.Copy(io.MultiWriter(tw, sum), f); err != nil {
+				return err
+			}
+			entry.SHA256 = fmt.Sprintf("%x", sum.Sum(nil))
+		}
+		files = append(files, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, tw.Close()
+}
+
+// archiveAndRemove archives path into dir, which may be in object storage,
+// and then deletes it. Items cleaned by their tool's own command aren't
+// archived.
+func archiveAndRemove(path, dir string) error {
+	if readOnly {
+		return errReadOnly
+	}
+	archive := archiveItem
+	if isRemote(dir) {
+		archive = archiveItemRemote
+	}
+	if _, err := archive(path, dir); err != nil {
+		return fmt.Errorf("archiving failed, nothing was deleted: %w", err)
+	}
+	return removeAll(path)
+}
@@ -0,0 +1,184 @@
+//go:build !readonly
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// archiveFixture writes a target fixture into a temporary directory and
+// returns it, the item and where archives go.
+func archiveFixture(t *testing.T) (project, item, archives string) {
+	t.Helper()
+	dir := t.TempDir()
+	project, err := writeFixture(filepath.Join(dir, "work"), "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return project, filepath.Join(project, "target"), filepath.Join(dir, "archives")
+}
+
+func useCompression(t *testing.T, c compression) {
+	t.Helper()
+	if c.name == "zstd" {
+		if _, err := exec.LookPath("zstd"); err != nil {
+			t.Skip("zstd is not on the PATH")
+		}
+	}
+	saved := archiveCompression
+	t.Cleanup(func() { archiveCompression = saved })
+	archiveCompression = c
+}
+
+// onlyArchive returns the one archive in dir.
+func onlyArchive(t *testing.T, dir string) string {
+	t.Helper()
+	archives, err := filepath.Glob(filepath.Join(dir, "*"+archiveCompression.ext()))
+	if err != nil || len(archives) != 1 {
+		t.Fatalf("archives in %s = %v, %v, want one", dir, archives, err)
+	}
+	return archives[0]
+}
+
+func TestArchiveAndRemove(t *testing.T) {
+	for _, c := range []compression{{name: "zstd"}, {name: "zstd", level: 19}, {name: "gzip"}, {name: "gzip", level: 1}} {
+		t.Run(fmt.Sprintf("%s-%d", c.name, c.level), func(t *testing.T) {
+			useCompression(t, c)
+			_, item, archives := archiveFixture(t)
+
+			if err := archiveAndRemove(item, archives); err != nil {
+				t.Fatalf("archiveAndRemove: %v", err)
+			}
+			if _, err := os.Lstat(item); !os.IsNotExist(err) {
+				t.Fatalf("%s is still there after archiving it", item)
+			}
+			archive := onlyArchive(t, archives)
+			if _, err := os.Stat(archive + manifestSuffix); err != nil {
+				t.Errorf("no manifest next to the archive: %v", err)
+			}
+			if partials, _ := filepath.Glob(filepath.Join(archives, "*"+partialSuffix)); len(partials) > 0 {
+				t.Errorf("partial archives left behind: %v", partials)
+			}
+
+			restored, err := restoreArchive(archive, "", true)
+			if err != nil {
+				t.Fatalf("restoreArchive: %v", err)
+			}
+			if restored != item {
+				t.Errorf("restored to %s, want %s", restored, item)
+			}
+			for name, want := range fixtureFiles["target"] {
+				rel, ok := strings.CutPrefix(name, "target/")
+				if !ok {
+					continue
+				}
+				got, err := os.ReadFile(filepath.Join(item, filepath.FromSlash(rel)))
+				if err != nil || string(got) != want {
+					t.Errorf("restored %s = %q, %v, want %q", rel, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveAndRemoveKeepsItemOnFailure(t *testing.T) {
+	useCompression(t, compression{name: "gzip"})
+	_, item, archives := archiveFixture(t)
+	// The archive directory can't be created over a file
+	if err := os.WriteFile(archives, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := archiveAndRemove(item, archives); err == nil {
+		t.Fatal("archiveAndRemove succeeded without an archive directory")
+	}
+	if _, err := os.Stat(filepath.Join(item, "CACHEDIR.TAG")); err != nil {
+		t.Errorf("the item was deleted although archiving failed: %v", err)
+	}
+}
+
+func TestRestoreRejectsTamperedArchive(t *testing.T) {
+	useCompression(t, compression{name: "gzip"})
+	project, item, archives := archiveFixture(t)
+	if err := archiveAndRemove(item, archives); err != nil {
+		t.Fatal(err)
+	}
+	archive := onlyArchive(t, archives)
+	manifest, err := readManifest(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range manifest.Files {
+		if f.SHA256 != "" {
+			manifest.Files[i].SHA256 = strings.Repeat("0", 64)
+			break
+		}
+	}
+	os.Remove(archive + manifestSuffix)
+	if err := writeManifest(archive, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := restoreArchive(archive, "", true); err == nil || !strings.Contains(err.Error(), "other contents") {
+		t.Fatalf("restoreArchive = %v, want a mismatch", err)
+	}
+	entries, err := os.ReadDir(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() == "target" || strings.HasPrefix(e.Name(), ".devtidy-restore-") {
+			t.Errorf("a failed restore left %s behind", e.Name())
+		}
+	}
+	// Without checking it is restored as it is
+	if _, err := restoreArchive(archive, "", false); err != nil {
+		t.Errorf("restoreArchive without verifying: %v", err)
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	web := archiveName("/a/web/node_modules", ".tar.zst", now, 0)
+	if !strings.HasPrefix(web, "web-node_modules-") || !strings.HasSuffix(web, "-20240501-123000.tar.zst") {
+		t.Errorf("archiveName = %q", web)
+	}
+	if other := archiveName("/b/web/node_modules", ".tar.zst", now, 0); other == web {
+		t.Errorf("items of projects with the same name share the archive %s", web)
+	}
+	if again := archiveName("/a/web/node_modules", ".tar.zst", now, 1); again != strings.TrimSuffix(web, ".tar.zst")+"-2.tar.zst" {
+		t.Errorf("archiveName of a second archive = %q", again)
+	}
+	if gz := archiveName("/a/web/node_modules", ".tar.gz", now, 0); !strings.HasSuffix(gz, ".tar.gz") {
+		t.Errorf("archiveName with gzip = %q", gz)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   int
+		want    compression
+		wantErr bool
+	}{
+		{name: "", want: compression{name: "zstd"}},
+		{name: "zstd", level: 22, want: compression{name: "zstd", level: 22}},
+		{name: "gzip", level: 9, want: compression{name: "gzip", level: 9}},
+		{name: "zstd", level: 23, wantErr: true},
+		{name: "gzip", level: 10, wantErr: true},
+		{name: "gzip", level: -1, wantErr: true},
+		{name: "xz", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCompression(tt.name, tt.level)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCompression(%q, %d) = %v, %v, want %v", tt.name, tt.level, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the modification time; access times aren't read on
+// this platform.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
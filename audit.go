@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// auditReport attributes reclaimable bytes per detector and per top-level
+// directory. Entries are sorted by name so reports diff cleanly between runs.
+type auditReport struct {
+	Root        string        `json:"root"`
+	Items       int           `json:"items"`
+	Bytes       int64         `json:"bytes"`
+	Detectors   []auditBucket `json:"detectors"`
+	Directories []auditBucket `json:"directories"`
+	Skipped     int           `json:"skipped"`
+}
+
+type auditBucket struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Items       int    `json:"items"`
+	Bytes       int64  `json:"bytes"`
+}
+
+func newAuditReport(root string, items []CleanableItem, issues []Issue) auditReport {
+	report := auditReport{Root: root, Skipped: len(issues)}
+	byDetector := make(map[string]*auditBucket)
+	byDirectory := make(map[string]*auditBucket)
+	for _, item := range items {
+		report.Items++
+		report.Bytes += item.Size
+		addToBucket(byDetector, item.Pattern, item.Type, item.Size)
+		addToBucket(byDirectory, topLevelDir(root, item.Path), "", item.Size)
+	}
+	report.Detectors = sortedBuckets(byDetector)
+	report.Directories = sortedBuckets(byDirectory)
+	return report
+}
+
+func addToBucket(buckets map[string]*auditBucket, name, description string, size int64) {
+	bucket, ok := buckets[name]
+	if !ok {
+		bucket = &auditBucket{Name: name, Description: description}
+		buckets[name] = bucket
+	}
+	bucket.Items++
+	bucket.Bytes += size
+}
+
+func sortedBuckets(buckets map[string]*auditBucket) []auditBucket {
+	sorted := make([]auditBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		sorted = append(sorted, *bucket)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// topLevelDir returns the first path component of path below root.
+func topLevelDir(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+}
+
+func (r auditReport) write(w io.Writer, format string) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	fmt.Fprintf(w, "Reclaimable in %s: %s in %d items\n", r.Root, formatSize(r.Bytes), r.Items)
+	if r.Skipped > 0 {
+		fmt.Fprintf(w, "Skipped paths: %d\n", r.Skipped)
+	}
+	fmt.Fprintln(w, "\nBy detector:")
+	for _, b := range r.Detectors {
+		fmt.Fprintf(w, "  %10s  %5d  %s\n", formatSize(b.Bytes), b.Items, b.Name)
+	}
+	fmt.Fprintln(w, "\nBy top-level directory:")
+	for _, b := range r.Directories {
+		fmt.Fprintf(w, "  %10s  %5d  %s\n", formatSize(b.Bytes), b.Items, b.Name)
+	}
+	return nil
+}
+
+func runAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	output := fs.String("output", formatText, "output format: text or json")
+	gitignore := fs.Bool("gitignore", false, "scan files matching .gitignore patterns")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy audit [options] [directory]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Runs detection only and attributes reclaimable bytes per detector and")
+		fmt.Fprintln(fs.Output(), "per top-level directory. Nothing is deleted.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if !validOutputFormat(*output) {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	targetDir := resolveTargetDir(fs.Args())
+	if *gitignore {
+		requireGitignore(targetDir)
+	}
+
+	items, issues := scanItems(targetDir, scanOptions{
+		useGitignore: *gitignore,
+	})
+	sizeItems(items)
+
+	return newAuditReport(targetDir, items, issues).write(os.Stdout, *output)
+}
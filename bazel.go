@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Bazel keeps the outputs of every workspace in an output base under its
+// output user root. Those of workspaces with a remote cache are listed as low
+// risk by the bazel opt-in group, since their outputs are downloaded again
+// rather than rebuilt, and bazel-prune expunges the ones not used for a while.
+// Both clean them with bazel clean --expunge.
+
+const bazelOutputBasePattern = "bazel-output-base"
+
+// bazelOutputBase is a Bazel output base together with the workspace that
+// owns it.
+type bazelOutputBase struct {
+	path      string
+	workspace string
+	lastUsed  time.Time
+	// remoteCache is set when the workspace configures a remote cache
+	remoteCache bool
+}
+
+// item lists the output base.
+func (b bazelOutputBase) item() CleanableItem {
+	desc := "Bazel output base"
+	if b.remoteCache {
+		desc += " (remote cache, low risk)"
+	}
+	return CleanableItem{
+		Path:    b.path,
+		Type:    desc,
+		Pattern: bazelOutputBasePattern,
+		ModTime: b.lastUsed,
+		Info:    "Outputs of the workspace " + displayPath(b.workspace),
+	}
+}
+
+// detectBazelCaches lists the output bases of Bazel's default output user
+// root.
+func detectBazelCaches() []CleanableItem {
+	var items []CleanableItem
+	for _, base := range bazelOutputBases(bazelOutputUserRoot()) {
+		if !activeConfig.excluded(base.path) {
+			items = append(items, base.item())
+		}
+	}
+	return items
+}
+
+// bazelWorkspace returns the workspace that owns the output base at path.
+func bazelWorkspace(path string) string {
+	data, err := os.ReadFile(filepath.Join(path, "DO_NOT_BUILD_HERE"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// bazelOutputUserRoot returns Bazel's default --output_user_root.
+func bazelOutputUserRoot() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = filepath.Base(u.Username)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join("/private/var/tmp", "_bazel_"+name)
+	case "windows":
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, "_bazel_"+name)
+	}
+	cache := os.Getenv("XDG_CACHE_HOME")
+	if cache == "" {
+		home, _ := os.UserHomeDir()
+		cache = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(cache, "bazel", "_bazel_"+name)
+}
+
+// bazelOutputBases lists the output bases below root. Bazel records the owning
+// workspace in DO_NOT_BUILD_HERE; command.log is rewritten by every command.
+func bazelOutputBases(root string) []bazelOutputBase {
+	var bases []bazelOutputBase
+	forEachDir(root, func(path string) {
+		workspace := bazelWorkspace(path)
+		if workspace == "" {
+			return
+		}
+		base := bazelOutputBase{path: path, workspace: workspace}
+		base.remoteCache = usesRemoteCache(base.workspace)
+		for _, p := range []string{path, filepath.Join(path, "server"), filepath.Join(path, "command.log")} {
+			if t := modTimeOf(p); t.After(base.lastUsed) {
+				base.lastUsed = t
+			}
+		}
+		bases = append(bases, base)
+	})
+	return bases
+}
+
+// usesRemoteCache reports whether the workspace's .bazelrc (or a file it
+// imports) configures a remote cache or remote execution, in which case local
+// outputs can be fetched again cheaply.
+func usesRemoteCache(workspace string) bool {
+	seen := make(map[string]bool)
+	var check func(path string) bool
+	check = func(path string) bool {
+		if seen[path] {
+			return false
+		}
+		seen[path] = true
+		f, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			if (fields[0] == "import" || fields[0] == "try-import") && len(fields) > 1 {
+				imported := strings.ReplaceAll(fields[1], "%workspace%", workspace)
+				if check(filepath.Clean(imported)) {
+					return true
+				}
+				continue
+			}
+			for _, field := range fields[1:] {
+				if strings.HasPrefix(field, "--remote_cache=") || strings.HasPrefix(field, "--remote_executor=") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return check(filepath.Join(workspace, ".bazelrc"))
+}
+
+// detectBazelOutputs returns output bases of remote-cached workspaces that
+// have not been used for longer than maxAge.
+func detectBazelOutputs(root string, maxAge time.Duration) []CleanableItem {
+	var items []CleanableItem
+	now := time.Now()
+	for _, base := range bazelOutputBases(root) {
+		if now.Sub(base.lastUsed) <= maxAge || !base.remoteCache {
+			continue
+		}
+		items = append(items, base.item())
+	}
+	return items
+}
+
+// bazelExpunger removes an output base with `bazel clean --expunge`, run from
+// the owning workspace so the right Bazel version and server are used.
+func bazelExpunger(bazel string) func(path string) error {
+	return func(path string) error {
+		cmd := exec.Command(bazel, "--output_base="+path, "clean", "--expunge")
+		cmd.Dir = bazelWorkspace(path)
+		if out, err := runDestructive(cmd); err != nil {
+			return fmt.Errorf("bazel clean --expunge: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+}
+
+func runBazelPrune(args []string) error {
+	fs := flag.NewFlagSet("bazel-prune", flag.ExitOnError)
+	olderThan := fs.String("older-than", "30d", "prune output bases not used for this long")
+	outputUserRoot := fs.String("output-user-root", bazelOutputUserRoot(), "Bazel's --output_user_root")
+	bazel := fs.String("bazel", "bazel", "bazel binary used to expunge output bases")
+	dryRun := fs.Bool("dry-run", false, "only list what would be removed")
+	addReadOnlyFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy bazel-prune [options]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Expunges Bazel output bases that have not been used recently, but only for")
+		fmt.Fprintln(fs.Output(), "workspaces whose .bazelrc configures a remote cache, so outputs can be")
+		fmt.Fprintln(fs.Output(), "downloaded again instead of rebuilt.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	maxAge, err := parseAge(*olderThan)
+	if err != nil {
+		return err
+	}
+
+	items := detectBazelOutputs(*outputUserRoot, maxAge)
+	return cleanDetected(*outputUserRoot, items, *dryRun, bazelExpunger(*bazel))
+}
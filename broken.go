@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// brokenChecks recognize artifacts that no build or install can still use,
+// such as dependencies whose project is gone or output of a build that was
+// killed before writing anything. They return the reason, or "" when the
+// artifact looks intact.
+var brokenChecks = map[string]func(path string) string{
+	"node_modules": func(path string) string {
+		if !fileExists(filepath.Join(filepath.Dir(path), "package.json")) {
+			return "no package.json next to it"
+		}
+		if fileExists(filepath.Join(path, ".staging")) {
+			return "interrupted npm install"
+		}
+		return ""
+	},
+	"target": func(path string) string {
+		if !fileExists(filepath.Join(filepath.Dir(path), "Cargo.toml")) {
+			// Only flag directories that look like cargo's, since target
+			// is a common name
+			if hasCargoLock(path) {
+				return "no Cargo.toml next to it"
+			}
+			return ""
+		}
+		if hasCargoLock(path) && onlyBookkeeping(path) {
+			return "interrupted build, only lock files were written"
+		}
+		return ""
+	},
+	"__pycache__": func(path string) string {
+		entries, err := os.ReadDir(fsPath(filepath.Dir(path)))
+		if err != nil {
+			return ""
+		}
+		for _, e := range entries {
+			if strings.HasSuffix(e.Name(), ".py") {
+				return ""
+			}
+		}
+		return "no Python sources next to it"
+	},
+}
+
+// markBroken sets Broken on the items failing their pattern's check.
+func markBroken(items []CleanableItem) {
+	for i := range items {
+		if check, ok := brokenChecks[items[i].Pattern]; ok {
+			items[i].Broken = check(items[i].Path)
+		}
+	}
+}
+
+// hasCargoLock reports whether a profile directory such as target/debug
+// holds the .cargo-lock cargo takes while building.
+func hasCargoLock(target string) bool {
+	entries, err := os.ReadDir(fsPath(target))
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if e.IsDir() && fileExists(filepath.Join(target, e.Name(), ".cargo-lock")) {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyBookkeeping reports whether dir holds nothing but empty directories,
+// lock files and cargo's cache markers.
+func onlyBookkeeping(dir string) bool {
+	entries, err := os.ReadDir(fsPath(dir))
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		switch {
+		case e.IsDir():
+			if !onlyBookkeeping(path) {
+				return false
+			}
+		case e.Name() == ".cargo-lock", e.Name() == "CACHEDIR.TAG", e.Name() == ".rustc_info.json":
+		default:
+			return false
+		}
+	}
+	return true
+}
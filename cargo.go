@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The cargo group lists what cargo downloads into its home directory:
+// crate archives and their extracted sources from registries, and clones
+// and checkouts of git dependencies. Binaries installed with cargo install
+// and the configuration next to them are never listed.
+
+const (
+	cargoRegistryCachePattern = "cargo-registry-cache"
+	cargoRegistrySrcPattern   = "cargo-registry-src"
+	cargoGitDBPattern         = "cargo-git-db"
+	cargoGitCheckoutsPattern  = "cargo-git-checkouts"
+)
+
+// cargoHome returns $CARGO_HOME, or ~/.cargo.
+func cargoHome() string {
+	if dir := os.Getenv("CARGO_HOME"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cargo")
+}
+
+// detectCargoCaches lists the download directories in the cargo home.
+func detectCargoCaches() []CleanableItem {
+	home := cargoHome()
+	if home == "" {
+		return nil
+	}
+	var items []CleanableItem
+	for _, c := range []struct {
+		rel, pattern, desc, info string
+	}{
+		{"registry/cache", cargoRegistryCachePattern, "Cargo crate archives",
+			"Downloaded .crate files; cargo fetches them again from the registry when needed"},
+		{"registry/src", cargoRegistrySrcPattern, "Cargo crate sources",
+			"Sources extracted from crate archives; cargo extracts them again when needed"},
+		{"git/db", cargoGitDBPattern, "Cargo git clones",
+			"Bare clones of git dependencies; cargo clones them again when needed"},
+		{"git/checkouts", cargoGitCheckoutsPattern, "Cargo git checkouts",
+			"Checked out revisions of git dependencies; cargo checks them out again when needed"},
+	} {
+		if item, ok := cacheItem(filepath.Join(home, filepath.FromSlash(c.rel)), c.pattern, c.desc, c.info); ok {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// cargoCleaner removes a download directory while holding the package cache
+// lock that cargo takes before touching any of them, so a build that is
+// downloading crates right now isn't pulled out from under.
+func cargoCleaner(path string) error {
+	home := filepath.Dir(filepath.Dir(path))
+	rel, err := filepath.Rel(home, path)
+	if err != nil || !(strings.HasPrefix(rel, "registry") || strings.HasPrefix(rel, "git")) {
+		return errors.New("not a cargo download directory")
+	}
+
+	lock, err := os.OpenFile(filepath.Join(home, ".package-cache"), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := tryLockFile(lock); err != nil {
+		if errors.Is(err, errWouldBlock) {
+			return errors.New("cargo is running; try again once it finishes")
+		}
+		return err
+	}
+	defer unlockFile(lock)
+	return removeAll(path)
+}
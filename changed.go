@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Someone may start a build in a listed directory between the scan and the
+// clean. Just before an item is removed, it and the entries up to
+// changedDepth levels below it are checked for modifications since the scan
+// started, and a changed item is skipped rather than pulled out from under
+// the build. Deeper changes aren't looked for, so the check stays cheap on
+// huge trees.
+
+const changedDepth = 2
+
+var errChangedSinceScan = errors.New("changed since scan")
+
+// changedSince reports whether path or an entry up to changedDepth levels
+// below it was modified after t. A zero t checks nothing.
+func changedSince(path string, t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	info, err := os.Lstat(fsPath(path))
+	if err != nil {
+		return false
+	}
+	if info.ModTime().After(t) {
+		return true
+	}
+	if !info.IsDir() {
+		return false
+	}
+	return entriesChangedSince(path, t, changedDepth)
+}
+
+func entriesChangedSince(dir string, t time.Time, depth int) bool {
+	entries, err := os.ReadDir(fsPath(dir))
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(t) {
+			return true
+		}
+		if e.IsDir() && depth > 1 && entriesChangedSince(filepath.Join(dir, e.Name()), t, depth-1) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+)
+
+var errAborted = errors.New("aborted, nothing was deleted")
+
+// batchClean deletes a list of items without the TUI: it prints what will be
+// removed, checks the policy, optionally asks for confirmation and removes
+// the items while holding the locks on roots, the first of which they are
+// recorded under.
+type batchClean struct {
+	roots  []string
+	dryRun bool
+	// trash moves the items to the trash instead of calling remove, freeing
+	// nothing
+	trash bool
+	// archive is where items are archived before remove, if set
+	archive string
+	remove  func(path string) error
+	// confirm is asked before anything is deleted; nil means don't ask
+	confirm func() bool
+	// scanned is when the scan of the items started; items changed since
+	// are skipped. Zero checks nothing.
+	scanned time.Time
+	// softLimits makes deletions above the limits of softLimit take a
+	// typed confirmation, which --yes can't give
+	softLimits bool
+
+	freed    int64
+	trashed  int64
+	cleaned  []CleanableItem
+	failures []Issue
+	// moved are the items moved to the trash that undo can restore
+	moved []trashedItem
+}
+
+// cleanDetected sizes and lists items found by a CI detector, then removes
+// them with remove while holding the lock on root unless dryRun is set.
+func cleanDetected(root string, items []CleanableItem, dryRun bool, remove func(path string) error) error {
+	items = activePolicy.filter(items)
+	sizeItems(items)
+	b := batchClean{roots: []string{root}, dryRun: dryRun, remove: remove}
+	return b.run(items)
+}
+
+func (b *batchClean) run(items []CleanableItem) error {
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+	if err := writeItems(os.Stdout, items, formatText); err != nil {
+		return err
+	}
+	if b.dryRun || readOnly {
+		fmt.Printf("Would free %s from %d items\n", formatSize(total), len(items))
+		return nil
+	}
+	if len(items) == 0 {
+		fmt.Println("Nothing to clean")
+		return nil
+	}
+	if err := activePolicy.allowClean(len(items), total, b.trash); err != nil {
+		return err
+	}
+	if b.trash {
+		fmt.Printf("Will move %s from %d items to the trash\n", formatSize(total), len(items))
+	} else {
+		fmt.Printf("Will free %s from %d items\n", formatSize(total), len(items))
+	}
+	if b.archive != "" && !b.trash {
+		fmt.Printf("Archiving each item into %s before deleting it\n", b.archive)
+	}
+	if b.softLimits && !b.trash {
+		if text, reason, big := softLimit(items); big {
+			if b.confirm == nil {
+				return fmt.Errorf("%s; run without --yes and type %s to confirm, or raise confirm_size and confirm_projects in the config", reason, text)
+			}
+			// Typing the size replaces the y/N question
+			b.confirm = func() bool { return confirmTypedOnTerminal(text, reason) }
+		}
+	}
+	if b.confirm != nil && !b.confirm() {
+		return errAborted
+	}
+
+	locks, err := lockRoots(b.roots)
+	var locked *lockedError
+	if errors.As(err, &locked) {
+		return locked
+	}
+	if err != nil {
+		// Unattended, nobody would see a warning before another instance
+		// cleans the same root, so don't clean at all
+		unlockAll(locks)
+		return fmt.Errorf("couldn't take the cleaning lock, nothing was deleted: %w", err)
+	}
+	defer unlockAll(locks)
+
+	root := b.roots[0]
+	clean := startSpan(nil, "clean", "devtidy.root", root, "devtidy.items", len(items), "devtidy.trash", b.trash)
+	clean.recordFreeSpace("devtidy.free_before", root)
+	defer func() {
+		clean.set("devtidy.bytes", b.freed+b.trashed)
+		clean.set("devtidy.failures", len(b.failures))
+		clean.recordFreeSpace("devtidy.free_after", root)
+		clean.finish()
+	}()
+
+	for _, item := range items {
+		s := startSpan(clean, "remove", "devtidy.path", item.Path, "devtidy.bytes", item.Size)
+		remove := b.remove
+		toolClean, tool := toolCleaners[item.Pattern]
+		if tool && !b.trash {
+			remove = toolClean
+		}
+		var err error
+		var trashed string
+		switch {
+		case !tool && changedSince(item.Path, b.scanned):
+			err = errChangedSinceScan
+		case b.trash:
+			trashed, err = trashItem(item.Path)
+		case b.archive != "" && !tool:
+			err = archiveAndRemove(item.Path, b.archive)
+		default:
+			err = remove(item.Path)
+		}
+		s.fail(err)
+		s.finish()
+		if err != nil {
+			b.failures = append(b.failures, newIssue(item.Path, phaseClean, err))
+			continue
+		}
+		if b.trash {
+			b.trashed += item.Size
+		} else {
+			b.freed += item.Size
+		}
+		b.cleaned = append(b.cleaned, item)
+		if trashed != "" {
+			b.moved = append(b.moved, trashedItem{Item: item, Trashed: trashed})
+		}
+	}
+	if !b.dryRun {
+		if err := indexCleaned(b.cleaned, cleanMethod(b.trash, b.archive)); err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't record the clean in the index: %v\n", err)
+		}
+	}
+	// Only a clean that moved something replaces the record, so the daemon
+	// and the CI cleaners, which delete, leave the last one to undo
+	var purged []trashEntry
+	if len(b.moved) > 0 {
+		if err := saveUndo(root, b.moved); err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't record the clean for devtidy undo: %v\n", err)
+		}
+		if purged, err = recordTrashed(b.moved); err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't record what was moved to the trash: %v\n", err)
+		}
+	}
+	if b.trash {
+		fmt.Printf("Moved %s from %d items to the trash\n", formatSize(b.trashed), len(b.cleaned))
+		if note := trashPurgeNote(purged); note != "" {
+			fmt.Println(note)
+		}
+	} else {
+		fmt.Printf("Freed %s from %d items\n", formatSize(b.freed), len(b.cleaned))
+	}
+	if len(b.failures) > 0 {
+		for _, issue := range b.failures {
+			fmt.Fprintf(os.Stderr, "failed to remove %s: %s\n", displayPath(issue.Path), issue.Reason)
+		}
+		return fmt.Errorf("%d items could not be removed", len(b.failures))
+	}
+	return nil
+}
+
+// confirmOnTerminal asks on stdin. Without a terminal there is nobody to
+// ask, so the answer is no.
+func confirmOnTerminal() bool {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprintln(os.Stderr, "stdin is not a terminal; pass --yes to delete without confirmation")
+		return false
+	}
+	fmt.Print("Delete these items? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// runHeadless scans and cleans without launching the TUI, for cron jobs and
+// CI scripts.
+func runHeadless(targetDirs []string, opts scanOptions, all, yes bool, out runOutputs) error {
+	started := time.Now()
+	items, issues := scanAndSizeRoots(targetDirs, opts)
+	if len(issues) > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d paths during the scan\n", len(issues))
+	}
+
+	switch {
+	case opts.selectExpr != nil:
+		items = matchItems(items, opts.selectExpr)
+	case !all:
+		return errors.New("--clean needs --all or --select to choose what to delete")
+	}
+
+	b := batchClean{roots: targetDirs, dryRun: opts.dryRun, trash: opts.trash, archive: opts.archiveDir, remove: removeAll, scanned: started, softLimits: true}
+	if !yes {
+		b.confirm = confirmOnTerminal
+	}
+	err := b.run(items)
+
+	result := makeRunResult(targetDirs[0], started, b.freed, b.cleaned, b.failures, false)
+	if len(targetDirs) > 1 {
+		result.Roots = targetDirs
+	}
+	out.write(result)
+	return err
+}
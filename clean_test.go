@@ -0,0 +1,34 @@
+//go:build !readonly
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBatchCleanRefusesWithoutLock breaks the lock directory and expects an
+// unattended clean to delete nothing.
+func TestBatchCleanRefusesWithoutLock(t *testing.T) {
+	dir := t.TempDir()
+	notADir := filepath.Join(dir, "state")
+	if err := os.WriteFile(notADir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DEVTIDY_STATE_DIR", notADir)
+
+	target := filepath.Join(dir, "node_modules")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	b := batchClean{roots: []string{dir}, remove: os.RemoveAll}
+	err := b.run([]CleanableItem{{Path: target, Type: "node_modules", Size: 1}})
+	if err == nil || !strings.Contains(err.Error(), "nothing was deleted") {
+		t.Errorf("run = %v, want it to refuse without the lock", err)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("%s was removed without the lock", target)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// When items of a batch fail to delete, a report of the batch follows it:
+// what was freed, and each failed item with why and what to do about it.
+// The failed items stay in the list, still selected, so fixing the cause
+// and pressing c again retries them.
+
+// failureHint suggests what to do about a failed deletion of the kind.
+func failureHint(kind string) string {
+	switch kind {
+	case issuePermission:
+		return "Fix the permissions of the files, or clean them as their owner"
+	case issueInUse:
+		return "Stop the program using it, such as a running build or dev server"
+	case issueCrossDevice:
+		return "The trash is on another filesystem; delete it instead (t)"
+	case issueChanged:
+		return "It changed since the scan; rescan to clean it with what it now holds"
+	}
+	return ""
+}
+
+// renderCleanReport describes a finished batch with failures.
+func renderCleanReport(q *cleanQueue, failures []Issue) string {
+	var freed int64
+	for i, status := range q.status {
+		if status == queueDone {
+			freed += q.items[i].Size
+		}
+	}
+
+	var b strings.Builder
+	verb := "Cleaned"
+	if q.trash {
+		verb = "Moved to the trash"
+	}
+	fmt.Fprintf(&b, "%s %d of %d items, %s.\n", verb, q.count(queueDone), len(q.items), formatSize(freed))
+	b.WriteString("The rest stay selected in the list; fix what is below and press c to retry them.\n\n")
+	for _, issue := range failures {
+		b.WriteString(errorStyle.Render(displayPath(issue.Path)) + "\n")
+		fmt.Fprintf(&b, "    %s\n", issue.Reason)
+		if hint := failureHint(issue.Kind); hint != "" {
+			fmt.Fprintf(&b, "    %s\n", hint)
+		}
+	}
+	return b.String()
+}
+
+func (m Model) showCleanReport(q *cleanQueue, failures []Issue) Model {
+	m.state = stateCleanReport
+	m.detailView.SetContent(renderCleanReport(q, failures))
+	m.detailView.GotoTop()
+	return m
+}
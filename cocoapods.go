@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// CocoaPods installs the dependencies of a project into Pods next to its
+// Podfile, from a cache of downloaded pods shared by every project. The Pods
+// directories are listed with the Xcode group and the cache with the opt-in
+// xcode-cache group.
+
+const cocoaPodsCachePattern = "cocoapods-cache"
+
+// isCocoaPodsProject recognizes the directory pod install runs in.
+func isCocoaPodsProject(project string) bool {
+	return anyExists(project, "Podfile")
+}
+
+// detectCocoaPodsCache lists the cache of downloaded pods if it exists.
+func detectCocoaPodsCache() []CleanableItem {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+	item, ok := cacheItem(filepath.Join(cache, "CocoaPods"), cocoaPodsCachePattern, "CocoaPods cache",
+		"Downloaded pods and their specs; pod install downloads them again when needed")
+	if !ok {
+		return nil
+	}
+	return []CleanableItem{item}
+}
+
+// cocoaPodsCleaner runs pod cache clean, or removes the cache when pod
+// isn't installed.
+func cocoaPodsCleaner(path string) error {
+	pod, err := exec.LookPath("pod")
+	if err != nil {
+		return removeAll(path)
+	}
+	return runToolClean(exec.Command(pod, "cache", "clean", "--all"))
+}
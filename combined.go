@@ -0,0 +1,48 @@
+package main
+
+import "strings"
+
+// With --with-gitignore the built-in patterns and the .gitignore files are
+// scanned for in one run, the gitignore walk going on beside the pattern
+// walk. An item both find is listed once, and each item is labeled with
+// what found it.
+
+// Item sources in combined scans
+const (
+	sourcePattern   = "pattern"
+	sourceGitignore = "gitignore"
+)
+
+// combineSources merges the items of the gitignore walk into those of the
+// pattern walk. Items at the same path become one that keeps the details of
+// the pattern, and items inside another item are dropped, so nothing is
+// counted twice.
+func combineSources(found, ignored []CleanableItem) []CleanableItem {
+	byPath := make(map[string]int, len(found))
+	for i := range found {
+		found[i].Sources = []string{sourcePattern}
+		byPath[found[i].Path] = i
+	}
+	for _, item := range ignored {
+		if i, ok := byPath[item.Path]; ok {
+			found[i].Sources = append(found[i].Sources, sourceGitignore)
+			found[i].Info += "; also matches .gitignore pattern " + item.Pattern
+			continue
+		}
+		item.Sources = []string{sourceGitignore}
+		found = append(found, item)
+	}
+	return dropNested(found)
+}
+
+// sourceLabel describes what found an item of a combined scan.
+func sourceLabel(sources []string) string {
+	labels := make([]string, len(sources))
+	for i, source := range sources {
+		labels[i] = source
+		if source == sourceGitignore {
+			labels[i] = ".gitignore"
+		}
+	}
+	return "found by " + strings.Join(labels, " and ")
+}
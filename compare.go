@@ -0,0 +1,273 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// projectSizes is what a project could give back on each of the two compared
+// roots. Projects are matched by their path relative to the root, like in
+// snapshot diffs, so a project copied to a backup drive lines up with the
+// original.
+type projectSizes struct {
+	Name  string
+	Sizes [2]int64
+}
+
+func (p projectSizes) onBoth() bool { return p.Sizes[0] > 0 && p.Sizes[1] > 0 }
+
+// compareProjects groups the items of both records by project, largest
+// combined size first.
+func compareProjects(records [2]scanRecord) []projectSizes {
+	projects := make(map[string]*projectSizes)
+	for side, record := range records {
+		for rel, item := range relativeItems(record) {
+			name := filepath.ToSlash(filepath.Dir(rel))
+			p, ok := projects[name]
+			if !ok {
+				p = &projectSizes{Name: name}
+				projects[name] = p
+			}
+			p.Sizes[side] += item.Size
+		}
+	}
+
+	rows := make([]projectSizes, 0, len(projects))
+	for _, p := range projects {
+		rows = append(rows, *p)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		si, sj := rows[i].Sizes[0]+rows[i].Sizes[1], rows[j].Sizes[0]+rows[j].Sizes[1]
+		if si != sj {
+			return si > sj
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
+
+type compareScanMsg struct {
+	records [2]scanRecord
+}
+
+func scanBothRoots(roots [2]string, opts scanOptions) tea.Cmd {
+	return func() tea.Msg {
+		var msg compareScanMsg
+		done := make(chan struct{})
+		for side, root := range roots {
+			go func() {
+				items, _ := scanAndSize(root, opts)
+				msg.records[side] = newScanRecord(root, items)
+				done <- struct{}{}
+			}()
+		}
+		<-done
+		<-done
+		return msg
+	}
+}
+
+// compareModel shows the projects of two roots in side-by-side panes with
+// the rows aligned, so the same project is on the same line in both.
+type compareModel struct {
+	roots    [2]string
+	opts     scanOptions
+	spinner  spinner.Model
+	scanning bool
+	rows     []projectSizes
+	totals   [2]int64
+	cursor   int
+	offset   int
+	width    int
+	height   int
+}
+
+var compareKeys = struct {
+	up   key.Binding
+	down key.Binding
+	quit key.Binding
+}{
+	up:   key.NewBinding(key.WithKeys("up", "k")),
+	down: key.NewBinding(key.WithKeys("down", "j")),
+	quit: key.NewBinding(key.WithKeys("q", "ctrl+c", "esc")),
+}
+
+var absentStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+
+func (m compareModel) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, scanBothRoots(m.roots, m.opts))
+}
+
+func (m compareModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m.scrolled(), nil
+
+	case compareScanMsg:
+		m.scanning = false
+		m.rows = compareProjects(msg.records)
+		for _, p := range m.rows {
+			m.totals[0] += p.Sizes[0]
+			m.totals[1] += p.Sizes[1]
+		}
+		return m, nil
+
+	case spinner.TickMsg:
+		if m.scanning {
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, compareKeys.quit):
+			return m, tea.Quit
+		case key.Matches(msg, compareKeys.up):
+			m.cursor = max(m.cursor-1, 0)
+		case key.Matches(msg, compareKeys.down):
+			m.cursor = max(min(m.cursor+1, len(m.rows)-1), 0)
+		}
+		return m.scrolled(), nil
+	}
+	return m, nil
+}
+
+// visibleRows is how many projects fit in a pane below its header.
+func (m compareModel) visibleRows() int {
+	_, v := docStyle.GetFrameSize()
+	return max(m.height-v-7, 1)
+}
+
+// scrolled moves the offset so the cursor stays on screen.
+func (m compareModel) scrolled() compareModel {
+	rows := m.visibleRows()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	return m
+}
+
+func (m compareModel) View() string {
+	if m.scanning {
+		return docStyle.Render(fmt.Sprintf("%s Scanning %s and %s...",
+			m.spinner.View(), displayPath(m.roots[0]), displayPath(m.roots[1])))
+	}
+
+	h, _ := docStyle.GetFrameSize()
+	// each pane has a border and a column of padding on both sides
+	paneWidth := max((m.width-h-1)/2-4, 20)
+	end := min(m.offset+m.visibleRows(), len(m.rows))
+	var panes [2]string
+	for side := range panes {
+		lines := []string{
+			titleStyle.Render(truncatePath(displayPath(m.roots[side]), paneWidth-2)),
+			"Reclaimable: " + formatSize(m.totals[side]),
+			"",
+		}
+		for i := m.offset; i < end; i++ {
+			lines = append(lines, m.renderRow(m.rows[i], side, i == m.cursor, paneWidth))
+		}
+		if len(m.rows) == 0 {
+			lines = append(lines, "Nothing to clean")
+		}
+		panes[side] = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			Padding(0, 1).
+			Width(paneWidth + 2).
+			Render(strings.Join(lines, "\n"))
+	}
+
+	both, bothSizes := 0, [2]int64{}
+	for _, p := range m.rows {
+		if p.onBoth() {
+			both++
+			bothSizes[0] += p.Sizes[0]
+			bothSizes[1] += p.Sizes[1]
+		}
+	}
+	footer := fmt.Sprintf("\n%d projects, %d on both roots (%s on the left, %s on the right)\nj/k: move %s q: quit",
+		len(m.rows), both, formatSize(bothSizes[0]), formatSize(bothSizes[1]), symbols.bullet)
+	return docStyle.Render(lipgloss.JoinHorizontal(lipgloss.Top, panes[0], " ", panes[1]) + footer)
+}
+
+// renderRow renders one project in one pane. Projects missing from the pane's
+// root keep their line, dimmed, so both panes stay aligned.
+func (m compareModel) renderRow(p projectSizes, side int, current bool, width int) string {
+	size := "-"
+	if p.Sizes[side] > 0 {
+		size = formatSize(p.Sizes[side])
+	}
+	name := truncatePath(displayPath(p.Name), width-len(size)-3)
+	line := fmt.Sprintf("%-*s %s", width-len(size)-3, name, size)
+	switch {
+	case current:
+		return selectedStyle.Render("> " + line)
+	case p.Sizes[side] == 0:
+		return absentStyle.Render("  " + line)
+	}
+	return "  " + line
+}
+
+// truncatePath shortens path to width by dropping its beginning.
+func truncatePath(path string, width int) string {
+	runes := []rune(path)
+	if width <= 3 || len(runes) <= width {
+		return path
+	}
+	return "..." + string(runes[len(runes)-width+3:])
+}
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	gitignore := fs.Bool("gitignore", activeConfig.Gitignore, "scan files matching .gitignore patterns")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy compare [options] <root> <other root>")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Scans both roots and shows their projects side by side with what each")
+		fmt.Fprintln(fs.Output(), "could reclaim, lining up projects at the same relative path, e.g. a home")
+		fmt.Fprintln(fs.Output(), "directory and its backup on an external drive.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var roots [2]string
+	for i := range roots {
+		roots[i] = resolveTargetDir([]string{fs.Arg(i)})
+	}
+	if *gitignore {
+		requireGitignore(roots[0])
+		requireGitignore(roots[1])
+	}
+	if detectASCII() {
+		useASCII()
+	}
+
+	m := compareModel{
+		roots:    roots,
+		opts:     scanOptions{useGitignore: *gitignore},
+		spinner:  newSpinner(),
+		scanning: true,
+	}
+	_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
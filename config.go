@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// config holds the user's defaults. Command line flags override them; the
+// system-wide policy always wins over both.
+type config struct {
+	// Directory is scanned when no directory is given.
+	Directory string `toml:"directory"`
+	// Roots are the directories of the workspace, scanned together with
+	// --workspace.
+	Roots []string `toml:"roots"`
+	// Exclude lists paths and globs that are never scanned, matched like pins.
+	Exclude []string `toml:"exclude"`
+	// Groups limits the scan to these pattern groups, or the names of user
+	// patterns; empty means all but the opt-in groups.
+	Groups []string `toml:"groups"`
+	// OptIn adds opt-in groups to the scan.
+	OptIn []string `toml:"opt_in"`
+	// Patterns are added to the built-in ones.
+	Patterns []userPattern `toml:"patterns"`
+	// StateDir is a directory shared with other users for pins and notes.
+	StateDir string `toml:"state_dir"`
+
+	// Defaults for the flags of the same name.
+	Gitignore     bool   `toml:"gitignore"`
+	WithGitignore bool   `toml:"with_gitignore"`
+	MaxDepth      int    `toml:"max_depth"`
+	OlderThan     string `toml:"older_than"`
+	Dormant       string `toml:"dormant"`
+	MinSize       string `toml:"min_size"`
+	ASCII         bool   `toml:"ascii"`
+	DryRun        bool   `toml:"dry_run"`
+	Trash         bool   `toml:"trash"`
+	ArchiveDir    string `toml:"archive_dir"`
+	Compression   string `toml:"compression"`
+	Level         int    `toml:"compression_level"`
+	ReadOnly      bool   `toml:"read_only"`
+	Verify        int    `toml:"verify"`
+	OTLPEndpoint  string `toml:"otlp_endpoint"`
+	JVMKeep       string `toml:"jvm_keep"`
+
+	// ConfirmSize and ConfirmProjects bound what a clean deletes before the
+	// size must be typed to confirm it; see softLimit.
+	ConfirmSize     string `toml:"confirm_size"`
+	ConfirmProjects *int   `toml:"confirm_projects"`
+	// TrashLimit caps what devtidy keeps in the trash; see trashLimit.
+	TrashLimit string `toml:"trash_limit"`
+	// ArchiveKeep and HistoryMaxAge are the retention of archives and of
+	// the scan history; see expiredFiles.
+	ArchiveKeep   int    `toml:"archive_keep"`
+	HistoryMaxAge string `toml:"history_max_age"`
+	// SigningKey is a minisign secret key that signs the cleans recorded in
+	// the index, and VerifyKey the public key devtidy verify-journal checks
+	// them with; see journal.go.
+	SigningKey string `toml:"signing_key"`
+	VerifyKey  string `toml:"verify_key"`
+
+	// RebuildCost is the CPU time rebuilding a GB of a group's items takes,
+	// for devtidy cost.
+	RebuildCost map[string]string `toml:"rebuild_cost"`
+}
+
+var activeConfig config
+
+// userPattern is a cleanable pattern defined in the config file.
+type userPattern struct {
+	Name string `toml:"name"`
+	// Glob is matched against file and directory names, like the built-in
+	// patterns.
+	Glob        string `toml:"glob"`
+	Description string `toml:"description"`
+	// Safety is low, medium or high risk of losing work when deleted.
+	Safety string `toml:"safety"`
+}
+
+var safetyLevels = []string{"low", "medium", "high"}
+
+func (p userPattern) validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("pattern without a name")
+	case p.Glob == "":
+		return fmt.Errorf("pattern %s: no glob", p.Name)
+	case strings.ContainsAny(p.Glob, `/\`):
+		return fmt.Errorf("pattern %s: glob %q must match a name, not a path", p.Name, p.Glob)
+	case builtinPatterns[p.Glob] != "":
+		// It would replace the built-in pattern and leave its group
+		return fmt.Errorf("pattern %s: glob %q is the built-in pattern for %s; use groups to choose which patterns to look for",
+			p.Name, p.Glob, builtinPatterns[p.Glob])
+	case p.Safety != "" && !slices.Contains(safetyLevels, p.Safety):
+		return fmt.Errorf("pattern %s: safety must be one of %s", p.Name, strings.Join(safetyLevels, ", "))
+	}
+	if _, err := filepath.Match(p.Glob, ""); err != nil {
+		return fmt.Errorf("pattern %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// description is what items of the pattern are listed as.
+func (p userPattern) description() string {
+	desc := p.Description
+	if desc == "" {
+		desc = p.Name
+	}
+	if p.Safety != "" {
+		desc += " (" + p.Safety + " risk)"
+	}
+	return desc
+}
+
+// patternGroups sorts builtinPatterns by ecosystem for the groups setting.
+var patternGroups = map[string][]string{
+	"node":      {"node_modules"},
+	"rust":      {"target"},
+	"python":    {"__pycache__", ".pytest_cache", "venv", "env", ".venv"},
+	"build":     {"build", "dist", "cmake-build-debug", "cmake-build-release"},
+	"vendor":    {"vendor"},
+	"elixir":    {"deps", "_build"},
+	"gradle":    {".gradle"},
+	"xcode":     {"DerivedData", "Pods"},
+	"sites":     {"public", "_site", ".cache", "site"},
+	"logs":      {"*.log", "*.tmp"},
+	"indexer":   {".ccls-cache", "clangd", "rust-analyzer"},
+	"packaging": {".flatpak-builder", "parts", "stage", "prime", "cache", "src", "pkg"},
+	// found by detectors rather than by name
+	"runtime":       {stalePattern},
+	"archives":      {archivePattern},
+	"go":            {goBuildCachePattern, goModCachePattern},
+	"node-cache":    {npmCachePattern, yarnCachePattern, pnpmStorePattern},
+	"cargo":         {cargoRegistryCachePattern, cargoRegistrySrcPattern, cargoGitDBPattern, cargoGitCheckoutsPattern},
+	"docker":        {dockerImagesPattern, dockerContainersPattern, dockerVolumesPattern, dockerBuildCachePattern},
+	"jvm":           {gradleWrapperPattern, gradleCachesPattern, mavenRepoPattern, ivyCachePattern},
+	"indexer-cache": {goplsCachePattern, clangdIndexPattern, zoektIndexPattern},
+	"homebrew":      {homebrewPattern},
+	"python-cache":  {pipCachePattern, poetryCachePattern, condaPkgsPattern},
+	"bazel":         {bazelOutputBasePattern},
+	"devtidy":       {devtidyCrashPattern, devtidyHistoryPattern, devtidyTempPattern, devtidyFixturePattern},
+	"xcode-cache":   {xcodeDerivedDataPattern, xcodeDeviceSupportPattern, xcodeArchivePattern, simulatorCachesPattern, cocoaPodsCachePattern},
+	"data": {".postgres-data", "postgres-data", "pgdata", ".mysql-data", "mysql-data",
+		"appendonlydir", "kafka-logs", redisDumpPattern, composeVolumePattern},
+}
+
+// optInGroups find data rather than caches, or caches shared by every
+// project on the machine, so they are only scanned when named in groups or
+// opt_in.
+var optInGroups = []string{"data", "go", "node-cache", "cargo", "docker", "jvm", "xcode-cache", "indexer-cache", "homebrew", "python-cache", "bazel", "devtidy"}
+
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// loadConfig reads the config file. A missing file means no defaults.
+func loadConfig(path string) (config, error) {
+	var c config
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return c, nil
+	}
+	if _, err := toml.DecodeFile(path, &c); err != nil {
+		return c, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	for _, p := range c.Patterns {
+		if err := p.validate(); err != nil {
+			return c, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+	for _, group := range c.Groups {
+		if _, ok := patternGroups[group]; !ok && !c.hasPattern(group) {
+			return c, fmt.Errorf("invalid config %s: unknown group %q (known: %s)", path, group, knownGroups())
+		}
+	}
+	for _, group := range c.OptIn {
+		if !slices.Contains(optInGroups, group) {
+			return c, fmt.Errorf("invalid config %s: unknown opt-in group %q (known: %s)", path, group, strings.Join(optInGroups, ", "))
+		}
+	}
+	if c.Verify < 0 {
+		return c, fmt.Errorf("invalid config %s: verify must not be negative", path)
+	}
+	if c.MaxDepth < 0 {
+		return c, fmt.Errorf("invalid config %s: max_depth must not be negative", path)
+	}
+	if c.MinSize != "" {
+		if _, err := parseSize(c.MinSize); err != nil {
+			return c, fmt.Errorf("invalid config %s: min_size: %w", path, err)
+		}
+	}
+	if c.OlderThan != "" {
+		if _, err := parseAge(c.OlderThan); err != nil {
+			return c, fmt.Errorf("invalid config %s: older_than: %w", path, err)
+		}
+	}
+	if c.Dormant != "" {
+		if _, err := parseAge(c.Dormant); err != nil {
+			return c, fmt.Errorf("invalid config %s: dormant: %w", path, err)
+		}
+	}
+	if c.JVMKeep != "" {
+		if _, err := parseAge(c.JVMKeep); err != nil {
+			return c, fmt.Errorf("invalid config %s: jvm_keep: %w", path, err)
+		}
+	}
+	if c.ConfirmSize != "" {
+		if _, err := parseSize(c.ConfirmSize); err != nil {
+			return c, fmt.Errorf("invalid config %s: confirm_size: %w", path, err)
+		}
+	}
+	if _, err := parseCompression(c.Compression, c.Level); err != nil {
+		return c, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if c.TrashLimit != "" {
+		if _, err := parseSize(c.TrashLimit); err != nil {
+			return c, fmt.Errorf("invalid config %s: trash_limit: %w", path, err)
+		}
+	}
+	if c.ArchiveKeep < 0 {
+		return c, fmt.Errorf("invalid config %s: archive_keep must not be negative", path)
+	}
+	if c.HistoryMaxAge != "" {
+		if _, err := parseAge(c.HistoryMaxAge); err != nil {
+			return c, fmt.Errorf("invalid config %s: history_max_age: %w", path, err)
+		}
+	}
+	if c.ConfirmProjects != nil && *c.ConfirmProjects < 0 {
+		return c, fmt.Errorf("invalid config %s: confirm_projects must not be negative", path)
+	}
+	for group, cost := range c.RebuildCost {
+		if _, err := parseAge(cost); err != nil {
+			return c, fmt.Errorf("invalid config %s: rebuild_cost.%s: %w", path, group, err)
+		}
+	}
+	c.Directory = expandHome(c.Directory)
+	for i, root := range c.Roots {
+		c.Roots[i] = expandHome(root)
+	}
+	c.StateDir = expandHome(c.StateDir)
+	c.ArchiveDir = expandHome(c.ArchiveDir)
+	c.SigningKey = expandHome(c.SigningKey)
+	c.VerifyKey = expandHome(c.VerifyKey)
+	for i, pattern := range c.Exclude {
+		c.Exclude[i] = expandHome(pattern)
+	}
+	return c, nil
+}
+
+func knownGroups() string {
+	var names []string
+	for name := range patternGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+func (c config) groupEnabled(group string) bool {
+	if slices.Contains(optInGroups, group) {
+		return slices.Contains(c.OptIn, group) || slices.Contains(c.Groups, group)
+	}
+	return len(c.Groups) == 0 || slices.Contains(c.Groups, group)
+}
+
+func (c config) hasPattern(name string) bool {
+	return slices.ContainsFunc(c.Patterns, func(p userPattern) bool { return p.Name == name })
+}
+
+// patterns merges the user patterns into the built-in ones and returns those
+// of the enabled groups.
+func (c config) patterns() map[string]string {
+	patterns := make(map[string]string)
+	for pat, desc := range builtinPatterns {
+		for group, pats := range patternGroups {
+			if slices.Contains(pats, pat) && c.groupEnabled(group) {
+				patterns[pat] = desc
+				break
+			}
+		}
+	}
+	for _, p := range c.Patterns {
+		if len(c.Groups) == 0 || slices.Contains(c.Groups, p.Name) {
+			patterns[p.Glob] = p.description()
+		}
+	}
+	return patterns
+}
+
+func (c config) excluded(path string) bool {
+	_, ok := matchPath(c.Exclude, path)
+	return ok
+}
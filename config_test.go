@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUserPatternValidate(t *testing.T) {
+	tests := []struct {
+		pattern userPattern
+		wantErr string
+	}{
+		{userPattern{Name: "out-cache", Glob: ".out-cache"}, ""},
+		{userPattern{Name: "out-cache", Glob: "out-*", Safety: "low"}, ""},
+		{userPattern{Glob: "out"}, "without a name"},
+		{userPattern{Name: "out"}, "no glob"},
+		{userPattern{Name: "out", Glob: "web/out"}, "not a path"},
+		{userPattern{Name: "out", Glob: "out", Safety: "none"}, "safety must be"},
+		{userPattern{Name: "out", Glob: "out["}, "syntax error"},
+		{userPattern{Name: "sources", Glob: "src"}, "built-in pattern for makepkg extracted sources"},
+		{userPattern{Name: "deps", Glob: "node_modules"}, "built-in pattern"},
+	}
+	for _, tt := range tests {
+		err := tt.pattern.validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("validate(%+v) = %v, want an error containing %q", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// devtidy cost weighs what cleaning each ecosystem frees against the CPU
+// time rebuilding it takes, for teams deciding which caches to keep. The
+// cost model is CPU time per GB of artifacts, a rough default per group
+// that rebuild_cost in the config file overrides with what a team measured.
+
+// defaultRebuildCost is the CPU time rebuilding a GB of each group's items
+// takes, roughly. Groups without a cost, like dev databases, get no
+// estimate.
+var defaultRebuildCost = map[string]time.Duration{
+	"node":       2 * time.Minute,
+	"rust":       9 * time.Minute,
+	"python":     3 * time.Minute,
+	"build":      10 * time.Minute,
+	"vendor":     2 * time.Minute,
+	"elixir":     6 * time.Minute,
+	"gradle":     4 * time.Minute,
+	"xcode":      12 * time.Minute,
+	"sites":      5 * time.Minute,
+	"indexer":    15 * time.Minute,
+	"packaging":  10 * time.Minute,
+	"logs":       0,
+	"runtime":    0,
+	"go":         6 * time.Minute,
+	"node-cache": time.Minute,
+	"cargo":      time.Minute,
+	"jvm":        time.Minute,
+}
+
+// rebuildCost returns the CPU time per GB of group, and false when there
+// is no estimate.
+func (c config) rebuildCost(group string) (time.Duration, bool) {
+	if s, ok := c.RebuildCost[group]; ok {
+		d, err := parseAge(s)
+		return d, err == nil
+	}
+	d, ok := defaultRebuildCost[group]
+	return d, ok
+}
+
+// groupOf returns the group a pattern belongs to, or the pattern itself for
+// user patterns in no group.
+func groupOf(pattern string) string {
+	for group, patterns := range patternGroups {
+		if slices.Contains(patterns, pattern) {
+			return group
+		}
+	}
+	return pattern
+}
+
+type costReport struct {
+	Root       string       `json:"root"`
+	Bytes      int64        `json:"bytes"`
+	Ecosystems []costBucket `json:"ecosystems"`
+}
+
+type costBucket struct {
+	Name  string `json:"name"`
+	Items int    `json:"items"`
+	Bytes int64  `json:"bytes"`
+	// PerGB and Rebuild are CPU time; they are left out without an estimate
+	PerGB   *duration `json:"perGB,omitempty"`
+	Rebuild *duration `json:"rebuild,omitempty"`
+}
+
+// duration is a time.Duration written in JSON as text like "9m0s".
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func newCostReport(root string, items []CleanableItem) costReport {
+	report := costReport{Root: root}
+	buckets := make(map[string]*costBucket)
+	for _, item := range items {
+		group := groupOf(item.Pattern)
+		b, ok := buckets[group]
+		if !ok {
+			b = &costBucket{Name: group}
+			buckets[group] = b
+		}
+		b.Items++
+		b.Bytes += item.Size
+		report.Bytes += item.Size
+	}
+	for _, b := range buckets {
+		if perGB, ok := activeConfig.rebuildCost(b.Name); ok {
+			rebuild := duration(time.Duration(float64(perGB) * float64(b.Bytes) / (1 << 30)).Round(time.Second))
+			b.PerGB, b.Rebuild = (*duration)(&perGB), &rebuild
+		}
+		report.Ecosystems = append(report.Ecosystems, *b)
+	}
+	sort.Slice(report.Ecosystems, func(i, j int) bool {
+		return report.Ecosystems[i].Bytes > report.Ecosystems[j].Bytes
+	})
+	return report
+}
+
+// cpuTime describes a rebuild time in CPU-hours, or minutes when shorter.
+func cpuTime(d time.Duration) string {
+	switch {
+	case d >= 10*time.Hour:
+		return fmt.Sprintf("~%.0f CPU-hours", d.Hours())
+	case d >= time.Hour:
+		return fmt.Sprintf("~%.1f CPU-hours", d.Hours())
+	case d >= time.Minute:
+		return fmt.Sprintf("~%.0f CPU-minutes", d.Minutes())
+	}
+	return "<1 CPU-minute"
+}
+
+// guidance sums a bucket up in a sentence.
+func (b costBucket) guidance() string {
+	switch {
+	case b.Rebuild == nil:
+		return fmt.Sprintf("cleaning %s saves %s; set rebuild_cost for an estimate of the rebuild", b.Name, formatSize(b.Bytes))
+	case *b.PerGB == 0:
+		return fmt.Sprintf("cleaning %s saves %s and needs no rebuild", b.Name, formatSize(b.Bytes))
+	}
+	return fmt.Sprintf("cleaning %s saves %s but costs %s to rebuild", b.Name, formatSize(b.Bytes), cpuTime(time.Duration(*b.Rebuild)))
+}
+
+func (r costReport) write(w io.Writer, format string) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	fmt.Fprintf(w, "Reclaimable in %s: %s\n\n", r.Root, formatSize(r.Bytes))
+	fmt.Fprintf(w, "  %-12s %10s %6s %10s %18s\n", "ECOSYSTEM", "SIZE", "ITEMS", "CPU/GB", "REBUILD")
+	for _, b := range r.Ecosystems {
+		perGB, rebuild := "?", "?"
+		if b.Rebuild != nil {
+			perGB, rebuild = time.Duration(*b.PerGB).String(), cpuTime(time.Duration(*b.Rebuild))
+		}
+		fmt.Fprintf(w, "  %-12s %10s %6d %10s %18s\n", b.Name, formatSize(b.Bytes), b.Items, perGB, rebuild)
+	}
+	if len(r.Ecosystems) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, b := range r.Ecosystems {
+		g := b.guidance()
+		fmt.Fprintln(w, strings.ToUpper(g[:1])+g[1:])
+	}
+	return nil
+}
+
+func runCost(args []string) error {
+	fs := flag.NewFlagSet("cost", flag.ExitOnError)
+	output := fs.String("output", formatText, "output format: text or json")
+	gitignore := fs.Bool("gitignore", false, "scan files matching .gitignore patterns")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy cost [options] [directory]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Estimates, per ecosystem, the bytes cleaning would free against the CPU")
+		fmt.Fprintln(fs.Output(), "time rebuilding them takes. Set rebuild_cost in the config file to the CPU")
+		fmt.Fprintln(fs.Output(), "time per GB your builds take. Nothing is deleted.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if !validOutputFormat(*output) {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	targetDir := resolveTargetDir(fs.Args())
+	if *gitignore {
+		requireGitignore(targetDir)
+	}
+
+	items, _ := scanItems(targetDir, scanOptions{
+		useGitignore: *gitignore,
+	})
+	sizeItems(items)
+	return newCostReport(targetDir, items).write(os.Stdout, *output)
+}
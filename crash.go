@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// crashReport captures everything needed to reconstruct a session that
+// died, in particular which deletions may have been cut short.
+type crashReport struct {
+	Time       time.Time `json:"time"`
+	Version    string    `json:"version"`
+	Panic      string    `json:"panic,omitempty"`
+	Stack      string    `json:"stack,omitempty"`
+	Root       string    `json:"root"`
+	State      string    `json:"state"`
+	FreedBytes int64     `json:"freedBytes"`
+	Cleaned    []string  `json:"cleaned"`
+	InProgress []string  `json:"inProgress"`
+	Pending    []string  `json:"pending"`
+	Failed     []string  `json:"failed"`
+	Selected   []string  `json:"selected"`
+	Issues     []Issue   `json:"issues"`
+}
+
+func (s state) String() string {
+	switch s {
+	case stateScanning:
+		return "scanning"
+	case stateSelecting:
+		return "selecting"
+	case stateIssues:
+		return "issues"
+	case stateCleanReport:
+		return "clean report"
+	case statePreview:
+		return "preview"
+	case stateOnboarding:
+		return "onboarding"
+	case statePicking:
+		return "picking"
+	}
+	return "unknown"
+}
+
+func newCrashReport(m Model, panicValue any, stack []byte) crashReport {
+	report := crashReport{
+		Time:       time.Now(),
+		Version:    version,
+		Root:       m.currentDir,
+		State:      m.state.String(),
+		FreedBytes: m.cleanedSize,
+		Issues:     m.issues,
+	}
+	for _, item := range m.cleaned {
+		report.Cleaned = append(report.Cleaned, item.Path)
+	}
+	if panicValue != nil {
+		report.Panic = fmt.Sprint(panicValue)
+		report.Stack = string(stack)
+	}
+	if q := m.queue; q != nil {
+		for i, item := range q.items {
+			switch q.status[i] {
+			case queueRunning:
+				report.InProgress = append(report.InProgress, item.Path)
+			case queuePending:
+				report.Pending = append(report.Pending, item.Path)
+			case queueFailed:
+				report.Failed = append(report.Failed, item.Path)
+			}
+		}
+	}
+	for _, item := range m.items.Selected() {
+		report.Selected = append(report.Selected, item.Path)
+	}
+	return report
+}
+
+// writeCrashReport saves the report into the cache directory, falling back
+// to the working directory, and returns its path.
+func writeCrashReport(report crashReport) (string, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("crash-%s.json", report.Time.Format("20060102-150405"))
+
+	dir, err := cacheDir()
+	if err == nil {
+		err = os.MkdirAll(dir, 0o755)
+	}
+	if err != nil {
+		dir = "."
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// crashGuard wraps the model so that a panic in Update or View becomes a
+// crash report and an orderly exit, which also restores the terminal.
+type crashGuard struct {
+	model Model
+	crash *crashState
+}
+
+type crashState struct {
+	report *crashReport
+	path   string
+	err    error
+}
+
+func newCrashGuard(m Model) crashGuard {
+	return crashGuard{model: m, crash: &crashState{}}
+}
+
+func (g crashGuard) record(panicValue any) {
+	if g.crash.report != nil {
+		return
+	}
+	report := newCrashReport(g.model, panicValue, debug.Stack())
+	g.crash.report = &report
+	g.crash.path, g.crash.err = writeCrashReport(report)
+}
+
+func (g crashGuard) Init() tea.Cmd {
+	return g.model.Init()
+}
+
+func (g crashGuard) Update(msg tea.Msg) (result tea.Model, cmd tea.Cmd) {
+	if g.crash.report != nil {
+		return g, tea.Quit
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			g.record(r)
+			result, cmd = g, tea.Quit
+		}
+	}()
+
+	m, cmd := g.model.Update(msg)
+	g.model = m.(Model)
+	return g, cmd
+}
+
+func (g crashGuard) View() (view string) {
+	if g.crash.report != nil {
+		return "devtidy crashed, exiting..."
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			g.record(r)
+			view = "devtidy crashed, press any key to exit"
+		}
+	}()
+	return g.model.View()
+}
+
+// reportCrash tells the user where the crash report went and which items
+// may have been left half deleted.
+func reportCrash(crash *crashState) {
+	fmt.Fprintln(os.Stderr, errorStyle.Render("devtidy crashed."))
+	if crash.report.Panic != "" {
+		fmt.Fprintf(os.Stderr, "panic: %s\n", crash.report.Panic)
+	}
+	if crash.err != nil {
+		fmt.Fprintf(os.Stderr, "Could not write crash report: %v\n", crash.err)
+	} else {
+		fmt.Fprintf(os.Stderr, "Crash report with the session state: %s\n", crash.path)
+	}
+	if len(crash.report.InProgress) > 0 {
+		fmt.Fprintln(os.Stderr, "\nThese items were being deleted and may be incomplete:")
+		for _, path := range crash.report.InProgress {
+			fmt.Fprintf(os.Stderr, "  %s\n", displayPath(path))
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// devtidy daemon keeps machines tidy unattended: every interval it scans its
+// roots and cleans what the rules match, logging what it reclaimed. The
+// default rules are conservative, only caches and dependency trees that
+// rebuild without losing anything, once nothing in them has changed for 60
+// days. Pinned items and items with a note are never cleaned, and a pass
+// cleans no more than the confirmation limits of the config file allow,
+// leaving the rest for the next.
+
+// safeGroups are the groups whose items the safe rules clean.
+var safeGroups = []string{"node", "rust", "gradle", "xcode", "indexer",
+	"go", "node-cache", "cargo", "jvm", "python-cache", "xcode-cache"}
+
+// safePatterns are patterns of other groups the safe rules clean.
+var safePatterns = []string{"__pycache__", ".pytest_cache"}
+
+// safeRules matches the items of safeGroups and safePatterns.
+type safeRules struct{}
+
+func (safeRules) match(item CleanableItem, _ time.Time) bool {
+	return slices.Contains(safeGroups, groupOf(item.Pattern)) || slices.Contains(safePatterns, item.Pattern)
+}
+
+// daemonRules returns the rules named on the command line: safe, or a query
+// expression.
+func daemonRules(rules string) (queryExpr, error) {
+	if rules == "safe" {
+		return safeRules{}, nil
+	}
+	return parseQuery(rules)
+}
+
+// keepMarked drops pinned items and items with a note, which someone
+// wanted kept.
+func keepMarked(items []CleanableItem) []CleanableItem {
+	pins, _ := loadPins()
+	return slices.DeleteFunc(items, func(item CleanableItem) bool {
+		_, pinned := matchPath(pins, item.Path)
+		return pinned || item.Note != ""
+	})
+}
+
+// daemonPass scans and cleans every root once.
+func daemonPass(roots []string, opts scanOptions, rules queryExpr) {
+	pruneOwnFiles()
+	if !opts.dryRun {
+		logRetention()
+	}
+	for _, root := range roots {
+		started := time.Now()
+		items, issues := scanAndSize(root, opts)
+		if err := indexScan(newScanRecord(root, items)); err != nil {
+			log.Warn("couldn't index the scan", "root", displayPath(root), "err", err)
+		}
+		items = keepMarked(matchItems(items, rules))
+		if len(issues) > 0 {
+			log.Warn("skipped paths during the scan", "root", displayPath(root), "count", len(issues))
+		}
+		if len(items) == 0 {
+			log.Info("nothing to clean", "root", displayPath(root))
+			continue
+		}
+		if !opts.trash {
+			var rest []CleanableItem
+			if items, rest = underSoftLimit(items); len(rest) > 0 {
+				log.Warn("over the confirmation limits, left for the next pass", "root", displayPath(root), "items", len(rest))
+			}
+		}
+		b := batchClean{roots: []string{root}, dryRun: opts.dryRun, trash: opts.trash, remove: removeAll, scanned: started}
+		err := b.run(items)
+		switch {
+		case opts.dryRun:
+		case opts.trash:
+			log.Info("moved to the trash", "root", displayPath(root), "bytes", formatSize(b.trashed), "items", len(b.cleaned))
+		default:
+			log.Info("reclaimed", "root", displayPath(root), "bytes", formatSize(b.freed), "items", len(b.cleaned))
+		}
+		if err != nil {
+			log.Error("clean failed", "root", displayPath(root), "err", err)
+		}
+	}
+}
+
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	interval := fs.String("interval", "24h", "time between runs, e.g. 24h or 7d")
+	rules := fs.String("rules", "safe", "what to clean: safe, or a query expression")
+	olderThan := fs.String("older-than", "60d", "only clean items with no file modified within this age")
+	once := fs.Bool("once", false, "run once and exit, for cron and launchd")
+	trash := fs.Bool("trash", activeConfig.Trash || activePolicy.RequireTrash, "move cleaned items to the trash instead of deleting them")
+	dryRun := fs.Bool("dry-run", false, "only log what would be cleaned")
+	addReadOnlyFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy daemon [options] [directory...]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Scans the directories, or the directory of the config file, every interval")
+		fmt.Fprintln(fs.Output(), "and cleans the items the rules match, logging what it reclaimed. The safe")
+		fmt.Fprintln(fs.Output(), "rules clean caches and dependency trees that rebuild without losing")
+		fmt.Fprintln(fs.Output(), "anything. Pinned items and items with a note are never cleaned.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	every, err := parseAge(*interval)
+	if err != nil || every <= 0 {
+		return fmt.Errorf("invalid --interval %q", *interval)
+	}
+	expr, err := daemonRules(*rules)
+	if err != nil {
+		return fmt.Errorf("invalid --rules: %w", err)
+	}
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		return fmt.Errorf("invalid --older-than: %w", err)
+	}
+	roots := fs.Args()
+	if len(roots) == 0 && activeConfig.Directory != "" {
+		roots = []string{activeConfig.Directory}
+	}
+	if len(roots) == 0 {
+		return errors.New("no directory to look after; name one or set directory in the config file")
+	}
+	roots = resolveTargetDirs(roots)
+
+	opts := scanOptions{
+		olderThan: age,
+		trash:     *trash,
+		dryRun:    *dryRun,
+	}
+	log.Info("starting", "roots", len(roots), "interval", every, "rules", *rules)
+	for {
+		daemonPass(roots, opts, expr)
+		if *once {
+			return nil
+		}
+		log.Info("next run", "at", time.Now().Add(every).Format(time.DateTime))
+		time.Sleep(every)
+	}
+}
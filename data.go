@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Databases and queues started for development keep their data next to the
+// project. Unlike everything else devtidy lists that is data rather than a
+// cache, so the data group is opt-in and every item is marked high risk.
+
+const (
+	redisDumpPattern     = "redis-dump"
+	composeVolumePattern = "compose-volume"
+)
+
+const dataInfo = "Local database data, not a cache: cleaning it loses what is stored there"
+
+// dockerVolumesDir is where Docker keeps named volumes on Linux.
+const dockerVolumesDir = "/var/lib/docker/volumes"
+
+// detectRedisDump is the walker's file callback for Redis snapshots and
+// append-only files.
+func detectRedisDump(path string, e os.DirEntry) (CleanableItem, bool) {
+	if !e.Type().IsRegular() {
+		return CleanableItem{}, false
+	}
+	switch e.Name() {
+	case "dump.rdb":
+		if !hasPrefixBytes(path, "REDIS") {
+			return CleanableItem{}, false
+		}
+	case "appendonly.aof":
+	default:
+		return CleanableItem{}, false
+	}
+	info, err := e.Info()
+	if err != nil {
+		return CleanableItem{}, false
+	}
+	return CleanableItem{
+		Path:    path,
+		Type:    "Redis dev data (high risk)",
+		Pattern: redisDumpPattern,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Info:    dataInfo,
+	}, true
+}
+
+func hasPrefixBytes(path, prefix string) bool {
+	f, err := os.Open(fsPath(path))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(prefix))
+	_, err = io.ReadFull(f, head)
+	return err == nil && string(head) == prefix
+}
+
+var composeFiles = []string{"docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"}
+
+// dataMountTargets are where the usual database images keep their data.
+var dataMountTargets = []string{
+	"/var/lib/postgresql", "/var/lib/mysql", "/var/lib/mariadb", "/data/db",
+	"/var/lib/redis", "/data", "/var/lib/kafka", "/bitnami", "/var/lib/rabbitmq",
+}
+
+// composeFile is what devtidy reads from a compose file: its project name,
+// the named volumes and the bind mounts of services, as source and target.
+type composeFile struct {
+	name    string
+	volumes []string
+	binds   [][2]string
+}
+
+var composeKey = regexp.MustCompile(`^(\s*)([A-Za-z0-9_.-]+):\s*(.*)$`)
+
+// parseCompose reads the few parts of a compose file devtidy needs line by
+// line, which is enough for the short syntax compose files mostly use.
+func parseCompose(r io.Reader) composeFile {
+	var c composeFile
+	section, volumeIndent := "", -1
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if m := composeKey.FindStringSubmatch(line); m != nil && m[1] == "" {
+			section = m[2]
+			if section == "name" {
+				c.name = unquote(m[3])
+			}
+			continue
+		}
+
+		switch section {
+		case "volumes":
+			m := composeKey.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			if volumeIndent < 0 {
+				volumeIndent = len(m[1])
+			}
+			if len(m[1]) == volumeIndent {
+				c.volumes = append(c.volumes, m[2])
+			}
+		case "services":
+			entry, ok := strings.CutPrefix(strings.TrimSpace(line), "- ")
+			if !ok {
+				continue
+			}
+			source, target, ok := strings.Cut(unquote(entry), ":")
+			if ok && (strings.HasPrefix(source, ".") || strings.HasPrefix(source, "/")) {
+				target, _, _ = strings.Cut(target, ":")
+				c.binds = append(c.binds, [2]string{source, target})
+			}
+		}
+	}
+	return c
+}
+
+func unquote(s string) string {
+	return strings.Trim(strings.TrimSpace(s), `"'`)
+}
+
+// composeProjectName is the name Docker Compose gives the project in dir
+// unless the file sets one.
+func composeProjectName(dir string) string {
+	name := strings.ToLower(filepath.Base(dir))
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+func isDataTarget(target string) bool {
+	target = strings.TrimSuffix(target, "/")
+	return slices.ContainsFunc(dataMountTargets, func(t string) bool {
+		return target == t || strings.HasPrefix(target, t+"/")
+	})
+}
+
+// detectComposeVolumes is the walker's file callback for compose files: it
+// lists the bind-mounted data directories of database services and the
+// backing directories of the project's named volumes that can be read.
+func detectComposeVolumes(path string, e os.DirEntry) []CleanableItem {
+	if !e.Type().IsRegular() || !slices.Contains(composeFiles, e.Name()) {
+		return nil
+	}
+	data, err := os.ReadFile(fsPath(path))
+	if err != nil {
+		return nil
+	}
+	c := parseCompose(bytes.NewReader(data))
+	dir := filepath.Dir(path)
+
+	var dirs []string
+	for _, bind := range c.binds {
+		if !isDataTarget(bind[1]) {
+			continue
+		}
+		source := bind[0]
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(dir, source)
+		}
+		dirs = append(dirs, source)
+	}
+	project := c.name
+	if project == "" {
+		project = composeProjectName(dir)
+	}
+	for _, volume := range c.volumes {
+		dirs = append(dirs, filepath.Join(dockerVolumesDir, project+"_"+volume, "_data"))
+	}
+
+	var items []CleanableItem
+	for _, d := range dirs {
+		info, err := os.Stat(fsPath(d))
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		items = append(items, CleanableItem{
+			Path:    d,
+			Type:    "Docker Compose volume (high risk)",
+			Pattern: composeVolumePattern,
+			ModTime: info.ModTime(),
+			Info:    dataInfo,
+		})
+	}
+	return items
+}
+
+// dedupeItems drops items found twice, such as a postgres-data directory that
+// is also the bind mount of a compose service.
+func dedupeItems(items []CleanableItem) []CleanableItem {
+	seen := make(map[string]bool, len(items))
+	return slices.DeleteFunc(items, func(item CleanableItem) bool {
+		if seen[item.Path] {
+			return true
+		}
+		seen[item.Path] = true
+		return false
+	})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fixtureFiles lays out a small but realistic project for the built-in
+// patterns: the sources that produce the artifact and a few files inside it.
+var fixtureFiles = map[string]map[string]string{
+	"node_modules": {
+		"package.json":                          `{"name": "fixture", "dependencies": {"left-pad": "^1.3.0"}}` + "\n",
+		"index.js":                              "require('left-pad')\n",
+		"node_modules/left-pad/package.json":    `{"name": "left-pad", "version": "1.3.0"}` + "\n",
+		"node_modules/left-pad/index.js":        "module.exports = leftPad;\n",
+		"node_modules/.package-lock.json":       `{"lockfileVersion": 3}` + "\n",
+		"node_modules/.bin/left-pad":            "#!/usr/bin/env node\n",
+		"node_modules/@types/node/package.json": `{"name": "@types/node"}` + "\n",
+		"node_modules/@types/node/index.d.ts":   "export {};\n",
+	},
+	"target": {
+		"Cargo.toml":                            "[package]\nname = \"fixture\"\nversion = \"0.1.0\"\n",
+		"src/main.rs":                           "fn main() {}\n",
+		"target/CACHEDIR.TAG":                   "Signature: 8a477f597d28d172789f06886806bc55\n",
+		"target/debug/fixture":                  strings.Repeat("\x7fELF", 256),
+		"target/debug/deps/fixture-0123abcd.d":  "src/main.rs:\n",
+		"target/debug/.fingerprint/fixture/bin": "0123abcd\n",
+	},
+	"__pycache__": {
+		"app.py":                          "print('fixture')\n",
+		"__pycache__/app.cpython-312.pyc": strings.Repeat("\x00", 128),
+	},
+	".pytest_cache": {
+		"test_app.py":                      "def test_app(): pass\n",
+		".pytest_cache/v/cache/lastfailed": "{}\n",
+		".pytest_cache/README.md":          "# pytest cache directory #\n",
+	},
+	".venv": {
+		"requirements.txt": "requests\n",
+		".venv/pyvenv.cfg": "home = /usr/bin\nversion = 3.12.0\n",
+		".venv/bin/python": "",
+		".venv/lib/python3.12/site-packages/requests/__init__.py": "",
+	},
+	"vendor": {
+		"go.mod":                                 "module example.com/fixture\n",
+		"vendor/modules.txt":                     "# github.com/pkg/errors v0.9.1\n",
+		"vendor/github.com/pkg/errors/errors.go": "package errors\n",
+	},
+	"deps": {
+		"mix.exs":            "defmodule Fixture.MixProject do\nend\n",
+		"deps/jason/mix.exs": "defmodule Jason.MixProject do\nend\n",
+	},
+	"_build": {
+		"mix.exs": "defmodule Fixture.MixProject do\nend\n",
+		"_build/dev/lib/fixture/ebin/fixture.app": "{application, fixture, []}.\n",
+	},
+	".gradle": {
+		"build.gradle":                                "plugins { id 'java' }\n",
+		".gradle/8.5/checksums/checksums.lock":        "",
+		".gradle/buildOutputCleanup/cache.properties": "gradle.version=8.5\n",
+	},
+	"build": {
+		"package.json":       `{"name": "fixture", "scripts": {"build": "tsc"}}` + "\n",
+		"build/index.js":     "console.log('fixture');\n",
+		"build/index.js.map": `{"version": 3}` + "\n",
+	},
+	"dist": {
+		"pyproject.toml":            "[project]\nname = \"fixture\"\n",
+		"dist/fixture-0.1.0.tar.gz": strings.Repeat("\x1f\x8b", 64),
+	},
+	"public": {
+		"hugo.toml":              "baseURL = 'https://example.org/'\ntitle = 'Fixture'\n",
+		"content/_index.md":      "# Fixture\n",
+		"public/index.html":      "<html></html>\n",
+		"public/css/site.css":    "body {}\n",
+		"public/posts/index.xml": "<rss></rss>\n",
+	},
+	"_site": {
+		"_config.yml":      "title: Fixture\n",
+		"index.md":         "# Fixture\n",
+		"_site/index.html": "<html></html>\n",
+		"_site/feed.xml":   "<feed></feed>\n",
+	},
+	".cache": {
+		"gatsby-config.js":          "module.exports = {}\n",
+		"src/pages/index.js":        "export default () => null\n",
+		".cache/redux.rest.state":   "{}\n",
+		".cache/webpack/stats.json": "{}\n",
+	},
+	"site": {
+		"mkdocs.yml":       "site_name: Fixture\n",
+		"docs/index.md":    "# Fixture\n",
+		"site/index.html":  "<html></html>\n",
+		"site/sitemap.xml": "<urlset></urlset>\n",
+	},
+	"DerivedData": {
+		"Fixture.xcodeproj/project.pbxproj":                    "// !$*UTF8*$!\n",
+		"DerivedData/Fixture-abc/Build/Products/Debug/Fixture": strings.Repeat("\xcf\xfa\xed\xfe", 64),
+	},
+}
+
+// fixtureFor returns the files of a fixture for pattern. Patterns without a
+// hand-written layout, including those from the config file, get a project
+// with an artifact directory named after the glob, since the scanner only
+// matches directories.
+func fixtureFor(pattern string) map[string]string {
+	if files, ok := fixtureFiles[pattern]; ok {
+		return files
+	}
+	name := strings.NewReplacer("*", "fixture", "?", "x", "[", "", "]", "").Replace(pattern)
+	return map[string]string{
+		"README.md":                        "# fixture\n",
+		filepath.Join(name, "fixture.out"): "fixture output\n",
+	}
+}
+
+// detectorPattern resolves a detector given as a pattern or a user pattern
+// name to its pattern.
+func detectorPattern(detector string) (string, error) {
+	if _, ok := cleanablePatterns[detector]; ok {
+		return detector, nil
+	}
+	for _, p := range activeConfig.Patterns {
+		if p.Name == detector {
+			return p.Glob, nil
+		}
+	}
+	var known []string
+	for pat := range cleanablePatterns {
+		known = append(known, pat)
+	}
+	sort.Strings(known)
+	return "", fmt.Errorf("unknown detector %q (known: %s)", detector, strings.Join(known, ", "))
+}
+
+// writeFixture materializes the fixture for pattern as dir/project.
+func writeFixture(dir, pattern string) (string, error) {
+	project := filepath.Join(dir, "project")
+	for name, content := range fixtureFor(pattern) {
+		path := filepath.Join(project, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return "", err
+		}
+	}
+	return project, nil
+}
+
+func runDevgen(args []string) error {
+	if len(args) == 0 || args[0] != "fixture" {
+		return errors.New("usage: devtidy devgen fixture [options] <detector>")
+	}
+
+	fs := flag.NewFlagSet("devgen fixture", flag.ExitOnError)
+	dir := fs.String("dir", "", "directory to create the fixture in (default: a new temporary directory)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy devgen fixture [options] <detector>")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Creates a fake project with an artifact of the detector, a built-in pattern")
+		fmt.Fprintln(fs.Output(), "such as node_modules or the name of a pattern from the config file, and")
+		fmt.Fprintln(fs.Output(), "prints its path. Scan it to check that the detector finds the artifact.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	pattern, err := detectorPattern(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	root := *dir
+	if root == "" {
+		if root, err = os.MkdirTemp("", "devtidy-fixture-"); err != nil {
+			return err
+		}
+	}
+	project, err := writeFixture(root, pattern)
+	if err != nil {
+		return err
+	}
+	fmt.Println(project)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// TestFixturesAreDetected scans the fixture of every built-in pattern and
+// expects its artifact to be found.
+func TestFixturesAreDetected(t *testing.T) {
+	var patterns []string
+	for pattern := range fixtureFiles {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		t.Run(pattern, func(t *testing.T) {
+			project, err := writeFixture(t.TempDir(), pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			items, issues := scanItems(project, scanOptions{skipToolCaches: true})
+			if len(issues) > 0 {
+				t.Errorf("scan issues: %v", issues)
+			}
+			if !slices.ContainsFunc(items, func(item CleanableItem) bool { return item.Pattern == pattern }) {
+				var found []string
+				for _, item := range items {
+					found = append(found, filepath.Base(item.Path)+" ("+item.Pattern+")")
+				}
+				t.Errorf("the %s fixture wasn't detected; found %v", pattern, found)
+			}
+		})
+	}
+}
+
+func TestFixtureForUserPattern(t *testing.T) {
+	files := fixtureFor("*.egg-info")
+	if _, ok := files[filepath.Join("fixture.egg-info", "fixture.out")]; !ok {
+		t.Errorf("fixtureFor(%q) = %v, want an artifact directory named after the glob", "*.egg-info", files)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// snapshotDiff compares two scan snapshots. Items are matched by their path
+// relative to the scan root, so snapshots of the same tree checked out in
+// different places still line up.
+type snapshotDiff struct {
+	OldBytes int64           `json:"oldBytes"`
+	NewBytes int64           `json:"newBytes"`
+	Added    []CleanableItem `json:"added"`
+	Removed  []CleanableItem `json:"removed"`
+	Types    []deltaBucket   `json:"types"`
+	Projects []deltaBucket   `json:"projects"`
+}
+
+type deltaBucket struct {
+	Name     string `json:"name"`
+	OldBytes int64  `json:"oldBytes"`
+	NewBytes int64  `json:"newBytes"`
+}
+
+func (b deltaBucket) delta() int64 { return b.NewBytes - b.OldBytes }
+
+func relativeItems(record scanRecord) map[string]CleanableItem {
+	items := make(map[string]CleanableItem, len(record.Items))
+	for _, item := range record.Items {
+		rel, err := filepath.Rel(record.Root, item.Path)
+		if err != nil {
+			rel = item.Path
+		}
+		items[filepath.ToSlash(rel)] = item
+	}
+	return items
+}
+
+func newSnapshotDiff(before, after scanRecord) snapshotDiff {
+	var d snapshotDiff
+	oldItems, newItems := relativeItems(before), relativeItems(after)
+	types := make(map[string]*deltaBucket)
+	projects := make(map[string]*deltaBucket)
+	bucket := func(buckets map[string]*deltaBucket, name string) *deltaBucket {
+		b, ok := buckets[name]
+		if !ok {
+			b = &deltaBucket{Name: name}
+			buckets[name] = b
+		}
+		return b
+	}
+
+	for rel, item := range oldItems {
+		d.OldBytes += item.Size
+		bucket(types, item.Pattern).OldBytes += item.Size
+		bucket(projects, filepath.ToSlash(filepath.Dir(rel))).OldBytes += item.Size
+		if _, ok := newItems[rel]; !ok {
+			d.Removed = append(d.Removed, item)
+		}
+	}
+	for rel, item := range newItems {
+		d.NewBytes += item.Size
+		bucket(types, item.Pattern).NewBytes += item.Size
+		bucket(projects, filepath.ToSlash(filepath.Dir(rel))).NewBytes += item.Size
+		if _, ok := oldItems[rel]; !ok {
+			d.Added = append(d.Added, item)
+		}
+	}
+
+	bySize := func(items []CleanableItem) []CleanableItem {
+		if items == nil {
+			return []CleanableItem{}
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Size > items[j].Size })
+		return items
+	}
+	d.Added, d.Removed = bySize(d.Added), bySize(d.Removed)
+	d.Types, d.Projects = sortedDeltas(types), sortedDeltas(projects)
+	return d
+}
+
+// sortedDeltas orders buckets by the largest change first, dropping the ones
+// that did not change.
+func sortedDeltas(buckets map[string]*deltaBucket) []deltaBucket {
+	sorted := []deltaBucket{}
+	for _, b := range buckets {
+		if b.delta() != 0 {
+			sorted = append(sorted, *b)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		di, dj := abs(sorted[i].delta()), abs(sorted[j].delta())
+		if di != dj {
+			return di > dj
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// formatDelta prints a signed size such as +1.2 GB or -300.0 MB.
+func formatDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + formatSize(-delta)
+	}
+	return "+" + formatSize(delta)
+}
+
+func (d snapshotDiff) write(w io.Writer, format string) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+
+	fmt.Fprintf(w, "Reclaimable: %s -> %s (%s)\n", formatSize(d.OldBytes), formatSize(d.NewBytes), formatDelta(d.NewBytes-d.OldBytes))
+	fmt.Fprintf(w, "\nNew artifacts (%d):\n", len(d.Added))
+	for _, item := range d.Added {
+		fmt.Fprintf(w, "  %11s  %-28s %s\n", formatDelta(item.Size), item.Type, displayPath(item.Path))
+	}
+	fmt.Fprintf(w, "\nRemoved artifacts (%d):\n", len(d.Removed))
+	for _, item := range d.Removed {
+		fmt.Fprintf(w, "  %11s  %-28s %s\n", formatDelta(-item.Size), item.Type, displayPath(item.Path))
+	}
+	for _, section := range []struct {
+		title   string
+		buckets []deltaBucket
+	}{
+		{"By type", d.Types},
+		{"By project", d.Projects},
+	} {
+		fmt.Fprintf(w, "\n%s:\n", section.title)
+		for _, b := range section.buckets {
+			fmt.Fprintf(w, "  %11s  %10s -> %-10s  %s\n", formatDelta(b.delta()), formatSize(b.OldBytes), formatSize(b.NewBytes), displayPath(b.Name))
+		}
+	}
+	return nil
+}
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	output := fs.String("output", formatText, "output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy diff [options] <old snapshot> <new snapshot>")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Compares two snapshots from devtidy scan --save and reports new and")
+		fmt.Fprintln(fs.Output(), "removed artifacts and size changes per type and per project.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !validOutputFormat(*output) {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	before, err := readScanRecord(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := readScanRecord(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	return newSnapshotDiff(before, after).write(os.Stdout, *output)
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes available to the current user on the volume
+// holding path.
+func freeSpace(path string) (uint64, bool) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, false
+	}
+	var available, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &available, &total, &totalFree); err != nil {
+		return 0, false
+	}
+	return available, true
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The docker group asks the Docker daemon what it keeps that nothing uses:
+// dangling images, stopped containers, unused volumes and the build cache.
+// Each kind is listed as one item under a docker:// path, since none of it
+// can be reached through the filesystem, and cleaned with its prune command.
+
+const (
+	dockerImagesPattern     = "docker-images"
+	dockerContainersPattern = "docker-containers"
+	dockerVolumesPattern    = "docker-volumes"
+	dockerBuildCachePattern = "docker-build-cache"
+)
+
+// dockerPathPrefix starts the paths of Docker items.
+const dockerPathPrefix = "docker://"
+
+var errDockerTrash = errors.New("Docker objects can't be moved to the trash; clean them with trash mode off")
+
+func isDockerPath(path string) bool {
+	return strings.HasPrefix(path, dockerPathPrefix)
+}
+
+// dockerObject is an image, container, volume or build cache record as
+// listed by docker.
+type dockerObject struct {
+	name string
+	size int64
+}
+
+// dockerKind is one kind of unused Docker objects.
+type dockerKind struct {
+	pattern string
+	name    string // the path below dockerPathPrefix
+	desc    string
+	info    string
+	list    func() []dockerObject
+	// reclaimable is how much the prune frees, when docker can tell better
+	// than the sum of the listed objects
+	reclaimable func() (int64, bool)
+	prune       [][]string
+}
+
+var dockerKinds = []dockerKind{
+	{
+		pattern: dockerImagesPattern,
+		name:    "images",
+		desc:    "Dangling Docker images",
+		info:    "Untagged images left behind by rebuilds; layers shared with other images stay",
+		list:    dockerDanglingImages,
+		prune:   [][]string{{"image", "prune", "--force"}},
+	},
+	{
+		pattern: dockerContainersPattern,
+		name:    "containers",
+		desc:    "Stopped Docker containers",
+		info:    "Containers that exited or never started, with anything written inside them",
+		list:    dockerStoppedContainers,
+		prune:   [][]string{{"container", "prune", "--force"}},
+	},
+	{
+		pattern: dockerVolumesPattern,
+		name:    "volumes",
+		desc:    "Unused Docker volumes (high risk)",
+		info:    "Volumes no container uses; they may hold databases or other data that can't be recreated",
+		list:    func() []dockerObject { return dockerVerboseUsage("Local Volumes space usage:", 0, 2, 1) },
+		// --all is needed for named volumes since Docker 23, and unknown
+		// before, when prune removed them anyway
+		prune: [][]string{{"volume", "prune", "--force", "--all"}, {"volume", "prune", "--force"}},
+	},
+	{
+		pattern:     dockerBuildCachePattern,
+		name:        "build-cache",
+		desc:        "Docker build cache",
+		info:        "Layers cached by docker build; the next builds are slower until it refills",
+		list:        func() []dockerObject { return dockerVerboseUsage("Build cache usage:", 0, 2, -1) },
+		reclaimable: func() (int64, bool) { return dockerReclaimable("Build Cache") },
+		prune:       [][]string{{"builder", "prune", "--force", "--all"}},
+	},
+}
+
+// dockerRunning reports whether docker is installed and its daemon answers.
+func dockerRunning() bool {
+	return toolOutput("docker", "version", "--format", "{{.Server.Version}}") != ""
+}
+
+// detectDocker lists every kind of unused objects the daemon has any of.
+func detectDocker() []CleanableItem {
+	if !dockerRunning() {
+		return nil
+	}
+	var items []CleanableItem
+	for _, kind := range dockerKinds {
+		objects := kind.list()
+		var size int64
+		for _, o := range objects {
+			size += o.size
+		}
+		if kind.reclaimable != nil {
+			if n, ok := kind.reclaimable(); ok {
+				size = n
+			}
+		}
+		if len(objects) == 0 && size == 0 {
+			continue
+		}
+		items = append(items, CleanableItem{
+			Path:    dockerPathPrefix + kind.name,
+			Type:    kind.desc,
+			Pattern: kind.pattern,
+			Size:    size,
+			Info:    fmt.Sprintf("%s (%d listed)", kind.info, len(objects)),
+		})
+	}
+	return items
+}
+
+func dockerKindOf(path string) (dockerKind, bool) {
+	for _, kind := range dockerKinds {
+		if path == dockerPathPrefix+kind.name {
+			return kind, true
+		}
+	}
+	return dockerKind{}, false
+}
+
+// dockerCleaner prunes the kind of objects at path. Prune removes whatever
+// is unused by then, which may be more or less than was listed.
+func dockerCleaner(path string) error {
+	kind, ok := dockerKindOf(path)
+	if !ok {
+		return fmt.Errorf("unknown Docker item %s", path)
+	}
+	var err error
+	for _, args := range kind.prune {
+		if err = runToolClean(exec.Command("docker", args...)); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// loadDockerListing previews a Docker item with the objects it stands for.
+func loadDockerListing(path string) tea.Cmd {
+	return func() tea.Msg {
+		kind, ok := dockerKindOf(path)
+		if !ok || !dockerRunning() {
+			return previewMsg{path: path, err: errors.New("the Docker daemon isn't reachable")}
+		}
+		var entries []previewEntry
+		for _, o := range kind.list() {
+			entries = append(entries, previewEntry{name: o.name, size: o.size})
+		}
+		return previewMsg{path: path, entries: entries}
+	}
+}
+
+func dockerDanglingImages() []dockerObject {
+	out := toolOutput("docker", "image", "ls", "--filter", "dangling=true", "--format", "{{.ID}}\t{{.CreatedSince}}\t{{.Size}}")
+	var objects []dockerObject
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 3 {
+			objects = append(objects, dockerObject{
+				name: fields[0] + " (created " + fields[1] + ")",
+				size: parseDockerSize(fields[2]),
+			})
+		}
+	}
+	return objects
+}
+
+func dockerStoppedContainers() []dockerObject {
+	out := toolOutput("docker", "container", "ls", "--all", "--size",
+		"--filter", "status=exited", "--filter", "status=created", "--filter", "status=dead",
+		"--format", "{{.Names}}\t{{.Image}}\t{{.Size}}")
+	var objects []dockerObject
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 3 {
+			// the size is "12kB (virtual 80MB)"; only the first part is the
+			// container's own
+			size, _, _ := strings.Cut(fields[2], " ")
+			objects = append(objects, dockerObject{
+				name: fields[0] + " (" + fields[1] + ")",
+				size: parseDockerSize(size),
+			})
+		}
+	}
+	return objects
+}
+
+// dockerColumns splits the rows of docker's tables, whose columns are
+// separated by at least two spaces.
+var dockerColumns = regexp.MustCompile(`\s{2,}`)
+
+// dockerVerboseUsage reads one table of docker system df -v: the name and
+// size columns of the rows whose column unused holds 0, or of every row
+// when unused is negative.
+func dockerVerboseUsage(title string, name, size, unused int) []dockerObject {
+	out := toolOutput("docker", "system", "df", "--verbose")
+	var objects []dockerObject
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, title) {
+			continue
+		}
+		// a blank line and the header of the table follow the title
+		rows := lines[i+1:]
+		for len(rows) > 0 && strings.TrimSpace(rows[0]) == "" {
+			rows = rows[1:]
+		}
+		for _, row := range rows[min(1, len(rows)):] {
+			if strings.TrimSpace(row) == "" {
+				break
+			}
+			cols := dockerColumns.Split(strings.TrimSpace(row), -1)
+			if len(cols) <= max(name, size, unused) {
+				continue
+			}
+			if unused >= 0 && cols[unused] != "0" {
+				continue
+			}
+			objects = append(objects, dockerObject{name: cols[name], size: parseDockerSize(cols[size])})
+		}
+	}
+	return objects
+}
+
+// dockerReclaimable is what docker system df reports as reclaimable for
+// the given type of objects.
+func dockerReclaimable(typ string) (int64, bool) {
+	out := toolOutput("docker", "system", "df", "--format", "{{json .}}")
+	for _, line := range strings.Split(out, "\n") {
+		var row struct {
+			Type        string
+			Reclaimable string
+		}
+		if json.Unmarshal([]byte(line), &row) != nil || row.Type != typ {
+			continue
+		}
+		// "1.2GB (40%)"
+		size, _, _ := strings.Cut(row.Reclaimable, " ")
+		return parseDockerSize(size), true
+	}
+	return 0, false
+}
+
+// parseDockerSize reads sizes as docker prints them, in decimal units like
+// 12.3kB or 1.5GB. Anything else counts as 0.
+func parseDockerSize(s string) int64 {
+	s = strings.TrimSpace(s)
+	multiplier := float64(1)
+	for i, unit := range []string{"kB", "MB", "GB", "TB", "PB"} {
+		if num, ok := strings.CutSuffix(s, unit); ok {
+			s = num
+			for range i + 1 {
+				multiplier *= 1000
+			}
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSuffix(s, "B"), 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return int64(n * multiplier)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
+	"github.com/muesli/termenv"
+)
+
+type checkLevel int
+
+const (
+	checkOK checkLevel = iota
+	checkWarn
+	checkFail
+)
+
+// doctorCheck is the outcome of one diagnostic, with a fix for anything that
+// isn't OK.
+type doctorCheck struct {
+	name   string
+	level  checkLevel
+	detail string
+	fix    string
+}
+
+func okCheck(name, detail string) doctorCheck {
+	return doctorCheck{name: name, detail: detail}
+}
+
+// runDoctorChecks inspects the environment devtidy runs in. It loads the
+// policy and config itself, so it can report them even when they are so
+// broken that devtidy refuses to start.
+func runDoctorChecks() []doctorCheck {
+	checks := []doctorCheck{checkTerminal(), checkLocale()}
+
+	p, err := loadPolicy(policyPath())
+	switch {
+	case err != nil:
+		checks = append(checks, doctorCheck{name: "policy", level: checkFail, detail: err.Error(),
+			fix: "ask an administrator to fix " + policyPath()})
+	case p.path == "":
+		checks = append(checks, okCheck("policy", "none"))
+	default:
+		checks = append(checks, okCheck("policy", p.path))
+	}
+
+	path, err := configPath()
+	if err == nil {
+		activeConfig, err = loadConfig(path)
+	}
+	switch {
+	case err != nil:
+		checks = append(checks, doctorCheck{name: "config", level: checkFail, detail: err.Error(),
+			fix: "correct the file, or remove it to use the defaults"})
+	case fileExists(path):
+		checks = append(checks, okCheck("config", path))
+	default:
+		checks = append(checks, okCheck("config", "none, using the defaults"))
+	}
+
+	if readOnly {
+		checks = append(checks, okCheck("trash", "not needed, deleting is disabled"))
+	} else if backend, err := trashBackend(); err != nil {
+		c := doctorCheck{name: "trash", level: checkWarn, detail: err.Error(),
+			fix: "cleaned items can only be deleted permanently; use --dry-run first to review them"}
+		if p.RequireTrash {
+			c.level = checkFail
+			c.fix = "the policy requires the trash, so cleaning is blocked until it works"
+		}
+		checks = append(checks, c)
+	} else {
+		checks = append(checks, okCheck("trash", backend))
+	}
+
+	if dir, err := cacheDir(); err != nil {
+		checks = append(checks, doctorCheck{name: "cache", level: checkFail, detail: err.Error(),
+			fix: "set $XDG_CACHE_HOME or $HOME"})
+	} else {
+		checks = append(checks, checkWritable("cache", dir, func() error { return os.MkdirAll(dir, 0o755) },
+			"last scans and crash reports can't be saved; fix the permissions of "+dir))
+	}
+
+	if dir, shared, err := stateDir(); err != nil {
+		checks = append(checks, doctorCheck{name: "state", level: checkFail, detail: err.Error(),
+			fix: "set $XDG_CONFIG_HOME or $HOME"})
+	} else {
+		fix := "pins, notes and the ignore list can't be saved; fix the permissions of " + dir
+		if shared {
+			fix = "pins, notes and the ignore list can't be saved; add yourself to the group owning " + dir
+		}
+		checks = append(checks, checkWritable("state", dir, func() error { return makeStateDir(dir, shared) }, fix))
+	}
+
+	if dir, _, err := lockDir(); err != nil {
+		checks = append(checks, doctorCheck{name: "locks", level: checkFail, detail: err.Error(),
+			fix: "--clean and the daemon refuse to clean without the cleaning lock; create /var/lock/devtidy writable by everyone, or set state_dir"})
+	} else {
+		checks = append(checks, okCheck("locks", dir))
+	}
+
+	if _, err := loadNotes(); err != nil {
+		checks = append(checks, doctorCheck{name: "notes", level: checkFail, detail: err.Error(),
+			fix: "correct or remove the notes file; notes can't be edited until then"})
+	}
+	return checks
+}
+
+func checkTerminal() doctorCheck {
+	if !term.IsTerminal(os.Stdout.Fd()) {
+		return doctorCheck{name: "terminal", level: checkWarn, detail: "stdout is not a terminal",
+			fix: "run devtidy from a terminal, or use --json or --clean in scripts"}
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return doctorCheck{name: "terminal", level: checkWarn, detail: "TERM=dumb, falling back to ASCII",
+			fix: "set TERM to your terminal, e.g. xterm-256color"}
+	}
+	switch profile := lipgloss.ColorProfile(); profile {
+	case termenv.TrueColor:
+		return okCheck("terminal", "true color")
+	case termenv.ANSI256:
+		return okCheck("terminal", "256 colors")
+	default:
+		return doctorCheck{name: "terminal", level: checkWarn, detail: "fewer than 256 colors, falling back to ASCII",
+			fix: "set TERM to a 256-color terminal, e.g. xterm-256color"}
+	}
+}
+
+func checkLocale() doctorCheck {
+	if !localeSupportsUTF8() {
+		return doctorCheck{name: "locale", level: checkWarn, detail: "not UTF-8, falling back to ASCII",
+			fix: "set LANG to a UTF-8 locale, e.g. en_US.UTF-8"}
+	}
+	return okCheck("locale", "UTF-8")
+}
+
+// checkWritable creates dir with mkdir and writes a file into it.
+func checkWritable(name, dir string, mkdir func() error, fix string) doctorCheck {
+	err := mkdir()
+	if err == nil {
+		var f *os.File
+		if f, err = os.CreateTemp(dir, ".doctor-*"); err == nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		return doctorCheck{name: name, level: checkFail, detail: err.Error(), fix: fix}
+	}
+	return okCheck(name, dir+" is writable")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy doctor")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Checks the terminal, the policy and config files, trash support and")
+		fmt.Fprintln(fs.Output(), "the cache and state directories, and suggests fixes for any problem.")
+	}
+	fs.Parse(args)
+
+	checks := runDoctorChecks()
+	failed := 0
+	for _, c := range checks {
+		mark := successStyle.Render(symbols.check)
+		switch c.level {
+		case checkWarn:
+			mark = errorStyle.Render("!")
+		case checkFail:
+			mark = errorStyle.Render("x")
+			failed++
+		}
+		fmt.Printf("%s %-9s %s\n", mark, c.name, c.detail)
+		if c.fix != "" {
+			fmt.Printf("  %-9s fix: %s\n", "", c.fix)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A project is dormant when none of its sources changed for a while. Build
+// output is rewritten by every build, so its mtimes say nothing about
+// whether anyone still works on the project; only the files outside of
+// artifacts and .git are looked at.
+
+// keepDormant keeps the items of projects whose sources are all older than
+// cutoff and sets Dormant on them.
+func keepDormant(items []CleanableItem, cutoff time.Time) []CleanableItem {
+	cache := make(map[string]string)
+	projects := make(map[string]time.Time)
+	for i := range items {
+		projects[projectOf(items[i].Path, cache)] = time.Time{}
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	semaphore := make(chan struct{}, max(runtime.NumCPU()/2, 2))
+	for project := range projects {
+		wg.Add(1)
+		go func(project string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			last := lastSourceChange(project, cutoff)
+			mu.Lock()
+			projects[project] = last
+			mu.Unlock()
+		}(project)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	dormant := items[:0]
+	for _, item := range items {
+		last := projects[projectOf(item.Path, cache)]
+		if last.After(cutoff) {
+			continue
+		}
+		item.Dormant = formatIdle(now.Sub(last))
+		dormant = append(dormant, item)
+	}
+	return dormant
+}
+
+// lastSourceChange returns when a source file of project was last modified.
+// It stops at the first one modified after cutoff and returns its mtime, so
+// active projects are cheap to rule out.
+func lastSourceChange(project string, cutoff time.Time) time.Time {
+	var last time.Time
+	filepath.WalkDir(fsPath(project), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != fsPath(project) && (d.Name() == ".git" || isArtifact(d.Name(), p)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+		if last.After(cutoff) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return last
+}
+
+// isArtifact reports whether the directory name at path matches one of the
+// cleanable patterns.
+func isArtifact(name, path string) bool {
+	for pat := range cleanablePatterns {
+		var match bool
+		if strings.Contains(pat, "*") {
+			match, _ = filepath.Match(pat, name)
+		} else {
+			match = name == pat
+		}
+		if match && gateAllows(pat, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatIdle describes how long a project has been idle in months, or in
+// days for the first two months.
+func formatIdle(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	switch {
+	case days < 60:
+		return fmt.Sprintf("%d days", days)
+	case days < 730:
+		return fmt.Sprintf("%d months", days/30)
+	}
+	return fmt.Sprintf("%d years", days/365)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// An item nothing but a .gitignore line matched says little about what it
+// is. E looks inside: the extension most files have and the well-known
+// files among them make a guess like "contains 12,304 .js files and
+// package metadata — looks like a JS dependency tree", which replaces the
+// generic label of gitignore items.
+
+// explainLimit bounds the files counted, so explaining a huge tree
+// answers quickly.
+const explainLimit = 200_000
+
+// knownFiles are files that tell what a tree holds.
+var knownFiles = map[string]string{
+	"package.json":     "package metadata",
+	"pyvenv.cfg":       "a virtual environment config",
+	"CMakeCache.txt":   "a CMake cache",
+	".rustc_info.json": "Cargo build metadata",
+	"CACHEDIR.TAG":     "a cache directory tag",
+	"METADATA":         "package metadata",
+	"go.mod":           "Go module metadata",
+}
+
+// contentKinds guess what a tree is from its most common extension, when no
+// known file does.
+var contentKinds = []struct {
+	exts []string
+	kind string
+}{
+	{[]string{".js", ".cjs", ".mjs", ".ts"}, "JavaScript"},
+	{[]string{".pyc", ".pyo"}, "Python bytecode caches"},
+	{[]string{".o", ".obj", ".a", ".lib", ".so", ".dylib", ".dll", ".d"}, "compiler output"},
+	{[]string{".rlib", ".rmeta"}, "Rust build output"},
+	{[]string{".class", ".jar"}, "JVM build output"},
+	{[]string{".css", ".html", ".map", ".woff", ".woff2"}, "bundled web assets"},
+	{[]string{".log"}, "logs"},
+	{[]string{".tmp", ".swp"}, "temporary files"},
+	{[]string{".zip", ".gz", ".tgz", ".tar", ".xz", ".whl"}, "downloaded archives"},
+}
+
+// treeContents is what explaining found in a tree.
+type treeContents struct {
+	files     int
+	exts      map[string]int
+	known     []string
+	truncated bool
+}
+
+func readContents(path string) treeContents {
+	c := treeContents{exts: make(map[string]int)}
+	filepath.WalkDir(fsPath(path), func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if c.files >= explainLimit {
+			c.truncated = true
+			return filepath.SkipAll
+		}
+		c.files++
+		c.exts[strings.ToLower(filepath.Ext(d.Name()))]++
+		if _, ok := knownFiles[d.Name()]; ok && !slices.Contains(c.known, d.Name()) {
+			c.known = append(c.known, d.Name())
+		}
+		return nil
+	})
+	sort.Strings(c.known)
+	return c
+}
+
+// commonExt returns the extension most files have and how many do.
+func (c treeContents) commonExt() (string, int) {
+	var ext string
+	count := 0
+	for e, n := range c.exts {
+		if n > count || (n == count && e < ext) {
+			ext, count = e, n
+		}
+	}
+	return ext, count
+}
+
+// guess names what the tree looks like, or returns "" without a clue.
+func (c treeContents) guess() string {
+	has := func(name string) bool { return slices.Contains(c.known, name) }
+	switch {
+	case has("pyvenv.cfg"):
+		return "a Python virtual environment"
+	case has(".rustc_info.json"):
+		return "a Cargo target directory"
+	case has("CMakeCache.txt"):
+		return "a CMake build directory"
+	}
+	ext, _ := c.commonExt()
+	for _, k := range contentKinds {
+		if !slices.Contains(k.exts, ext) {
+			continue
+		}
+		if k.kind != "JavaScript" {
+			return k.kind
+		}
+		if has("package.json") {
+			return "a JS dependency tree"
+		}
+		return "bundled JavaScript"
+	}
+	if has("CACHEDIR.TAG") {
+		return "a cache directory"
+	}
+	return ""
+}
+
+// describe sums the contents up in a phrase.
+func (c treeContents) describe() string {
+	if c.files == 0 {
+		return "contains no files"
+	}
+	ext, count := c.commonExt()
+	files := countFiles(count, ext+" file")
+	if ext == "" {
+		files = countFiles(count, "file") + " without an extension"
+	}
+	if count < c.files {
+		files = fmt.Sprintf("%s, mostly %s", countFiles(c.files, "file"), files)
+	}
+	if c.truncated {
+		files = "at least " + files
+	}
+	desc := "contains " + files
+	var known []string
+	for _, name := range c.known {
+		if what := knownFiles[name]; !slices.Contains(known, what) {
+			known = append(known, what)
+		}
+	}
+	if len(known) > 0 {
+		desc += " and " + strings.Join(known, ", ")
+	}
+	if guess := c.guess(); guess != "" {
+		desc += " — looks like " + guess
+	}
+	return desc
+}
+
+// countFiles writes n with thousands separators and the noun after it.
+func countFiles(n int, noun string) string {
+	if n != 1 {
+		noun += "s"
+	}
+	return groupDigits(n) + " " + noun
+}
+
+// groupDigits writes n with thousands separators.
+func groupDigits(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+type explainMsg struct {
+	path string
+	desc string
+}
+
+func explainItem(path string) tea.Cmd {
+	return func() tea.Msg {
+		return explainMsg{path: path, desc: readContents(path).describe()}
+	}
+}
+
+// explain looks inside the highlighted item.
+func (m Model) explain() (Model, tea.Cmd) {
+	item, ok := m.list.SelectedItem().(CleanableItem)
+	if !ok {
+		return m, nil
+	}
+	m.statusMsg = "Looking inside " + displayPath(item.Path) + "..."
+	return m, explainItem(item.Path)
+}
+
+// showExplanation labels gitignore items with what explaining found.
+func (m Model) showExplanation(msg explainMsg) (Model, tea.Cmd) {
+	m.statusMsg = displayPath(msg.path) + " " + msg.desc
+	item, ok := m.items.Get(msg.path)
+	if !ok || item.Info != gitignoreInfo {
+		return m, nil
+	}
+	m.items.Update(msg.path, func(item *CleanableItem) {
+		item.Type = strings.ToUpper(msg.desc[:1]) + msg.desc[1:]
+	})
+	return m, m.refreshList()
+}
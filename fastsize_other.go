@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// fastDirSize has no native fast path outside Linux, so directories are
+// always walked.
+func fastDirSize(path string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Gitignore mode applies every .gitignore in the tree to the files and
+// directories beneath it, along with .git/info/exclude of each repository,
+// the way git does: later and deeper patterns win, ! re-includes, and a
+// nested repository starts over with its own files.
+
+type ignoreRule struct {
+	line string
+	// elems are the glob's path elements; unanchored rules have one
+	elems    []string
+	negate   bool
+	anchored bool
+	// dirOnly rules end in / and don't match files
+	dirOnly bool
+}
+
+// parseIgnoreFile returns the rules in the ignore file at path, or nil if
+// there is none.
+func parseIgnoreFile(path string) []ignoreRule {
+	file, err := os.Open(fsPath(path))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreLine parses one line of an ignore file, reporting false for
+// blank lines and comments.
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are dropped unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{line: line}
+	glob := line
+	if rest, ok := strings.CutPrefix(glob, "!"); ok {
+		rule.negate = true
+		glob = rest
+	}
+	if rest, ok := strings.CutSuffix(glob, "/"); ok {
+		rule.dirOnly = true
+		glob = rest
+	}
+	// A separator at the start or in the middle ties the pattern to the
+	// directory of its file; otherwise it matches names at any depth
+	if rest, ok := strings.CutPrefix(glob, "/"); ok {
+		rule.anchored = true
+		glob = rest
+	}
+	if strings.Contains(glob, "/") {
+		rule.anchored = true
+	}
+	if glob == "" {
+		return ignoreRule{}, false
+	}
+
+	rule.elems = strings.Split(glob, "/")
+	// a/** matches everything inside a, but not a itself
+	if n := len(rule.elems); n > 1 && rule.elems[n-1] == "**" {
+		rule.elems = append(rule.elems[:n-1], "*", "**")
+	}
+	return rule, true
+}
+
+// matches reports whether rel, relative to the directory of the rule's file,
+// matches the rule.
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		return matchIgnoreGlob(r.elems[0], filepath.Base(rel))
+	}
+	return matchIgnoreElements(r.elems, splitPath(rel))
+}
+
+// matchIgnoreElements matches path elements like matchElements, with git's
+// glob syntax for each element.
+func matchIgnoreElements(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(path); i >= 0; i-- {
+				if matchIgnoreElements(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 || !matchIgnoreGlob(pattern[0], path[0]) {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// matchIgnoreGlob matches a name against one element of a gitignore glob.
+// Backslash always escapes, even on Windows, and [!...] negates a class as
+// well as [^...]. A ** inside an element is an ordinary *.
+func matchIgnoreGlob(glob, name string) bool {
+	glob = strings.ReplaceAll(glob, "[!", "[^")
+	for strings.Contains(glob, "**") {
+		glob = strings.ReplaceAll(glob, "**", "*")
+	}
+	ok, err := path.Match(glob, name)
+	return err == nil && ok
+}
+
+// ignoreScope is a directory whose ignore rules apply beneath it.
+type ignoreScope struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// ignoreDir is what a directory contributes: whether it is a repository and
+// the rules of its ignore files.
+type ignoreDir struct {
+	repo   bool
+	scopes []ignoreScope
+}
+
+// gitignoreMatcher answers whether directories under root are ignored,
+// reading every ignore file once.
+type gitignoreMatcher struct {
+	root string
+	mu   sync.Mutex
+	dirs map[string]ignoreDir
+}
+
+func newGitignoreMatcher(root string) *gitignoreMatcher {
+	return &gitignoreMatcher{root: root, dirs: make(map[string]ignoreDir)}
+}
+
+// dir reads the ignore files in dir: the repository's exclude file first
+// when dir is a repository, then its .gitignore.
+func (g *gitignoreMatcher) dir(dir string) ignoreDir {
+	if d, ok := g.dirs[dir]; ok {
+		return d
+	}
+	// .git is a file in submodules and worktrees
+	d := ignoreDir{repo: fileExists(filepath.Join(dir, ".git"))}
+	if rules := parseIgnoreFile(filepath.Join(dir, ".git", "info", "exclude")); rules != nil {
+		d.scopes = append(d.scopes, ignoreScope{dir, rules})
+	}
+	if rules := parseIgnoreFile(filepath.Join(dir, ".gitignore")); rules != nil {
+		d.scopes = append(d.scopes, ignoreScope{dir, rules})
+	}
+	g.dirs[dir] = d
+	return d
+}
+
+// match returns the rule ignoring the file or directory at path, if one
+// does. It is safe for concurrent use.
+func (g *gitignoreMatcher) match(path string, isDir bool) (ignoreRule, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	rel, err := filepath.Rel(g.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ignoreRule{}, false
+	}
+
+	// Collect the rules from the root down to the parent of path; a
+	// repository nested below the root doesn't see the files above it
+	var scopes []ignoreScope
+	dir := g.root
+	elems := splitPath(rel)
+	for i := range elems {
+		if i > 0 {
+			dir = filepath.Join(dir, elems[i-1])
+		}
+		d := g.dir(dir)
+		if d.repo && i > 0 {
+			scopes = nil
+		}
+		scopes = append(scopes, d.scopes...)
+	}
+
+	var (
+		matched ignoreRule
+		ignored bool
+	)
+	for _, scope := range scopes {
+		sub, _ := filepath.Rel(scope.dir, path)
+		for _, rule := range scope.rules {
+			if rule.matches(sub, isDir) {
+				matched, ignored = rule, !rule.negate
+			}
+		}
+	}
+	return matched, ignored
+}
+
+// dropNested removes the items inside other items. Git can't re-include
+// anything below an ignored directory, and the outer item covers it.
+func dropNested(items []CleanableItem) []CleanableItem {
+	paths := make(map[string]bool, len(items))
+	for _, item := range items {
+		paths[item.Path] = true
+	}
+	return slices.DeleteFunc(items, func(item CleanableItem) bool {
+		for dir := filepath.Dir(item.Path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if paths[dir] {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseIgnoreLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want ignoreRule
+		ok   bool
+	}{
+		{line: "", ok: false},
+		{line: "   ", ok: false},
+		{line: "# comment", ok: false},
+		{line: "/", ok: false},
+		{line: "dist", want: ignoreRule{elems: []string{"dist"}}, ok: true},
+		{line: "dist  ", want: ignoreRule{line: "dist", elems: []string{"dist"}}, ok: true},
+		{line: `dist\ `, want: ignoreRule{elems: []string{`dist\ `}}, ok: true},
+		{line: "build/\r", want: ignoreRule{line: "build/", elems: []string{"build"}, dirOnly: true}, ok: true},
+		{line: "!keep", want: ignoreRule{elems: []string{"keep"}, negate: true}, ok: true},
+		{line: "/out", want: ignoreRule{elems: []string{"out"}, anchored: true}, ok: true},
+		{line: "docs/_build", want: ignoreRule{elems: []string{"docs", "_build"}, anchored: true}, ok: true},
+		{line: "**/tmp", want: ignoreRule{elems: []string{"**", "tmp"}, anchored: true}, ok: true},
+		{line: "cache/**", want: ignoreRule{elems: []string{"cache", "*", "**"}, anchored: true}, ok: true},
+	}
+	for _, tt := range tests {
+		if tt.ok && tt.want.line == "" {
+			tt.want.line = tt.line
+		}
+		got, ok := parseIgnoreLine(tt.line)
+		if ok != tt.ok || (ok && (got.line != tt.want.line || !slices.Equal(got.elems, tt.want.elems) ||
+			got.negate != tt.want.negate || got.anchored != tt.want.anchored || got.dirOnly != tt.want.dirOnly)) {
+			t.Errorf("parseIgnoreLine(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMatchIgnoreElements(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "docs/_build", path: "docs/_build", want: true},
+		{pattern: "docs/_build", path: "src/docs/_build", want: false},
+		{pattern: "**/tmp", path: "tmp", want: true},
+		{pattern: "**/tmp", path: "a/b/tmp", want: true},
+		{pattern: "a/**/b", path: "a/b", want: true},
+		{pattern: "a/**/b", path: "a/x/y/b", want: true},
+		{pattern: "cache/*/**", path: "cache", want: false},
+		{pattern: "cache/*/**", path: "cache/x/y", want: true},
+		{pattern: "out/*.o", path: "out/main.o", want: true},
+		{pattern: "out/[!a]*", path: "out/build", want: true},
+		{pattern: "out/[!a]*", path: "out/all", want: false},
+		{pattern: "out/x**y", path: "out/xzy", want: true},
+		{pattern: `out/\*`, path: "out/*", want: true},
+		{pattern: `out/\*`, path: "out/a", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchIgnoreElements(splitPath(tt.pattern), splitPath(tt.path)); got != tt.want {
+			t.Errorf("matchIgnoreElements(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGitignoreMatcher(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".git/info/exclude": "scratch/\n",
+		".gitignore":        "dist/\n*.log\n!keep.log\n/top\n",
+		"web/.gitignore":    ".cache/\n!dist/\n",
+		"vendor/lib/.git":   "gitdir: ../../.git/modules/lib\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := newGitignoreMatcher(root)
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: "dist", isDir: true, want: true},
+		{path: "dist", isDir: false, want: false},
+		{path: "app/dist", isDir: true, want: true},
+		{path: "scratch", isDir: true, want: true},
+		{path: "debug.log", want: true},
+		{path: "keep.log", want: false},
+		{path: "top", isDir: true, want: true},
+		{path: "app/top", isDir: true, want: false},
+		{path: "web/.cache", isDir: true, want: true},
+		{path: "web/dist", isDir: true, want: false},
+		// A nested repository doesn't see the rules above it
+		{path: "vendor/lib/dist", isDir: true, want: false},
+	}
+	for _, tt := range tests {
+		_, got := g.match(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir)
+		if got != tt.want {
+			t.Errorf("match(%q, dir %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The go group is opt-in like every group of global caches: --clean --all
+// on a project directory shouldn't make every Go build on the machine start
+// from scratch.
+
+const (
+	goBuildCachePattern = "go-build-cache"
+	goModCachePattern   = "go-mod-cache"
+)
+
+// goCacheDirs returns GOCACHE and GOMODCACHE as go reports them, or the
+// defaults go would use when it isn't installed.
+func goCacheDirs() (build, mod string) {
+	if out := toolOutput("go", "env", "GOCACHE", "GOMODCACHE"); out != "" {
+		lines := strings.Split(out, "\n")
+		if len(lines) == 2 {
+			return strings.TrimSpace(lines[0]), strings.TrimSpace(lines[1])
+		}
+	}
+
+	build = os.Getenv("GOCACHE")
+	if build == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			build = filepath.Join(dir, "go-build")
+		}
+	}
+	mod = os.Getenv("GOMODCACHE")
+	if mod == "" {
+		gopath := filepath.SplitList(os.Getenv("GOPATH"))
+		if len(gopath) > 0 && gopath[0] != "" {
+			mod = filepath.Join(gopath[0], "pkg", "mod")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			mod = filepath.Join(home, "go", "pkg", "mod")
+		}
+	}
+	return build, mod
+}
+
+// detectGoCaches lists the build and module caches that exist.
+func detectGoCaches() []CleanableItem {
+	build, mod := goCacheDirs()
+	var items []CleanableItem
+	// GOCACHE=off isn't a path, so it lists nothing
+	if item, ok := cacheItem(build, goBuildCachePattern, "Go build cache",
+		"Compiled packages and test results; the next builds are slower until it refills"); ok {
+		items = append(items, item)
+	}
+	if item, ok := cacheItem(mod, goModCachePattern, "Go module cache",
+		"Downloaded modules; they are fetched again from the module proxy when needed"); ok {
+		items = append(items, item)
+	}
+	return items
+}
+
+// goCleaner empties a Go cache with go clean, pointing go at the listed
+// directory in case the environment changed since the scan. Without go the
+// directory is removed directly; the module cache is read-only, so it is
+// made writable first.
+func goCleaner(flag, env string) func(path string) error {
+	return func(path string) error {
+		goBin, err := exec.LookPath("go")
+		if err != nil {
+			return removeAllWritable(path)
+		}
+		cmd := exec.Command(goBin, "clean", flag)
+		cmd.Env = append(os.Environ(), env+"="+path)
+		return runToolClean(cmd)
+	}
+}
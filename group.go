@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// With grouping on, the list shows a header for every project or type
+// followed by its items. A group can be sorted on its own, and groups can be
+// collapsed one by one or all at once. What was collapsed and how groups are
+// sorted is kept for the session, through rescans and other directories.
+
+// grouping is how the list is grouped; o cycles through them.
+type grouping int
+
+const (
+	groupNone grouping = iota
+	groupByProject
+	groupByType
+)
+
+var groupingNames = []string{"none", "project", "type"}
+
+func (g grouping) String() string { return groupingNames[g] }
+
+func (g grouping) next() grouping { return (g + 1) % grouping(len(groupingNames)) }
+
+var headerStyle = lipgloss.NewStyle().Bold(true)
+
+// groupHeader is the list row above the items of a group. Toggling it
+// selects or deselects all of them, and enter collapses or expands it.
+type groupHeader struct {
+	// key is the path of the project, or the type
+	key       string
+	byType    bool
+	items     int
+	selected  int
+	size      int64
+	collapsed bool
+	// order is the sort order picked for the group, if any
+	order *sortOrder
+}
+
+func (h groupHeader) Title() string {
+	mark := symbols.expanded
+	if h.collapsed {
+		mark = symbols.collapsed
+	}
+	return headerStyle.Render(mark + " " + h.name())
+}
+
+// name is what the group is listed as.
+func (h groupHeader) name() string {
+	if h.byType {
+		return h.key
+	}
+	return displayPath(h.key)
+}
+
+func (h groupHeader) Description() string {
+	desc := fmt.Sprintf("%d items - %s", h.items, formatSize(h.size))
+	if h.selected > 0 {
+		desc += fmt.Sprintf(" %s %d selected", symbols.bullet, h.selected)
+	}
+	if h.order != nil {
+		desc += fmt.Sprintf(" %s sorted by %s", symbols.bullet, h.order)
+	}
+	return desc
+}
+
+func (h groupHeader) FilterValue() string { return h.name() }
+
+// groupKey returns the key of the group item belongs to.
+func (m *Model) groupKey(item CleanableItem) string {
+	if m.grouping == groupByType {
+		return item.Type
+	}
+	return projectOf(item.Path, m.projects)
+}
+
+// groupedListItems lists a header per group followed by its items, leaving
+// out the items of collapsed groups. Groups appear in the order of their
+// first item, so the current sort order still applies, and the items of a
+// group sorted on its own follow its order.
+func (m *Model) groupedListItems() []list.Item {
+	headers := make(map[string]*groupHeader)
+	var order []string
+	members := make(map[string][]CleanableItem)
+	for _, item := range m.items.All() {
+		key := m.groupKey(item)
+		h, ok := headers[key]
+		if !ok {
+			h = &groupHeader{key: key, byType: m.grouping == groupByType, collapsed: m.collapsed[key]}
+			if own, sorted := m.groupSorts[key]; sorted {
+				h.order = &own
+			}
+			headers[key] = h
+			order = append(order, key)
+		}
+		h.items++
+		h.size += item.Size
+		if item.Selected {
+			h.selected++
+		}
+		members[key] = append(members[key], item)
+	}
+
+	var listItems []list.Item
+	for _, key := range order {
+		h := headers[key]
+		listItems = append(listItems, *h)
+		if h.collapsed {
+			continue
+		}
+		if h.order != nil {
+			sortItems(members[key], *h.order)
+		}
+		for _, item := range members[key] {
+			listItems = append(listItems, item)
+		}
+	}
+	return listItems
+}
+
+// cycleGrouping switches between no grouping, grouping by project and by
+// type.
+func (m Model) cycleGrouping() (Model, tea.Cmd) {
+	m.grouping = m.grouping.next()
+	current, _ := m.list.SelectedItem().(CleanableItem)
+	cmd := m.refreshList()
+	m.selectPath(current.Path)
+	m.statusMsg = "Grouped by " + m.grouping.String()
+	if m.grouping == groupNone {
+		m.statusMsg = "Not grouped"
+	}
+	return m, cmd
+}
+
+// toggleCollapsed collapses or expands the group under the cursor.
+func (m Model) toggleCollapsed(h groupHeader) (Model, tea.Cmd) {
+	m.collapsed[h.key] = !h.collapsed
+	cmd := m.refreshList()
+	m.selectPath(h.key)
+	return m, cmd
+}
+
+// toggleAllCollapsed collapses every group, or expands them all when they
+// are all collapsed already.
+func (m Model) toggleAllCollapsed() (Model, tea.Cmd) {
+	var keys []string
+	for _, item := range m.items.All() {
+		if key := m.groupKey(item); !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	collapse := slices.ContainsFunc(keys, func(key string) bool { return !m.collapsed[key] })
+	for _, key := range keys {
+		m.collapsed[key] = collapse
+	}
+	current := m.list.SelectedItem()
+	cmd := m.refreshList()
+	switch it := current.(type) {
+	case groupHeader:
+		m.selectPath(it.key)
+	case CleanableItem:
+		m.selectPath(m.groupKey(it))
+		if !collapse {
+			m.selectPath(it.Path)
+		}
+	}
+	return m, cmd
+}
+
+// cycleGroupSort switches the group under the cursor to the next sort
+// order, starting from that of the list.
+func (m Model) cycleGroupSort(h groupHeader) (Model, tea.Cmd) {
+	order := m.sortOrder
+	if h.order != nil {
+		order = *h.order
+	}
+	m.groupSorts[h.key] = order.next()
+	cmd := m.refreshList()
+	m.selectPath(h.key)
+	return m, cmd
+}
+
+// groupItems returns the paths of the items in the group of h, including
+// those hidden by collapsing it.
+func (m *Model) groupItems(h groupHeader) []string {
+	var paths []string
+	for _, item := range m.items.All() {
+		if m.groupKey(item) == h.key {
+			paths = append(paths, item.Path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Every scan the UI or devtidy scan finishes is also kept in a history in
+// the cache directory. devtidy growth picks two of them and shows where the
+// reclaimable space grew in between, one directory level at a time.
+
+// scanHistoryLimit is how many scans the history keeps, over all roots.
+const scanHistoryLimit = 100
+
+func scanHistoryDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history"), nil
+}
+
+// archiveScan adds record to the history, dropping the oldest scans beyond
+// the limit.
+func archiveScan(record scanRecord) error {
+	dir, err := scanHistoryDir()
+	if err != nil {
+		return err
+	}
+	// The names sort by time
+	name := record.Time.UTC().Format("20060102T150405.000000000") + ".json"
+	if err := writeScanRecord(filepath.Join(dir, name), record); err != nil {
+		return err
+	}
+
+	names, err := historyFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names[:max(len(names)-scanHistoryLimit, 0)] {
+		os.Remove(name)
+	}
+	return nil
+}
+
+// historyFiles lists the scans in the history, oldest first.
+func historyFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".json" {
+			names = append(names, filepath.Join(dir, e.Name()))
+		}
+	}
+	return names, nil
+}
+
+// historyEntry is a scan in the history and the file holding it.
+type historyEntry struct {
+	path   string
+	record scanRecord
+}
+
+// scanHistory returns the scans of root in the history, oldest first.
+func scanHistory(root string) ([]historyEntry, error) {
+	dir, err := scanHistoryDir()
+	if err != nil {
+		return nil, err
+	}
+	names, err := historyFiles(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var history []historyEntry
+	for _, name := range names {
+		record, err := readScanRecord(name)
+		if err != nil || !samePath(record.Root, root) {
+			continue
+		}
+		history = append(history, historyEntry{path: name, record: record})
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].record.Time.Before(history[j].record.Time)
+	})
+	return history, nil
+}
+
+// pickScans chooses the scans to compare: the last one taken by to, and the
+// last one taken by from, or the oldest one when the history doesn't reach
+// back that far.
+func pickScans(history []historyEntry, from, to time.Time) (before, after historyEntry, err error) {
+	last := -1
+	for i, entry := range history {
+		if !entry.record.Time.After(to) {
+			last = i
+		}
+	}
+	if last < 1 {
+		return before, after, errors.New("need at least two scans of this directory; the UI and devtidy scan add one each time they finish")
+	}
+	first := 0
+	for i, entry := range history[:last] {
+		if !entry.record.Time.After(from) {
+			first = i
+		}
+	}
+	return history[first], history[last], nil
+}
+
+// growthNode is a directory or an artifact below the scan root with what it
+// held in both scans. Chains of directories with a single child are merged
+// into one node so drilling down doesn't stop at every level.
+type growthNode struct {
+	deltaBucket
+	// Type is set on artifacts, which are the leaves of the tree
+	Type     string
+	children map[string]*growthNode
+}
+
+func (n *growthNode) child(name string) *growthNode {
+	if n.children == nil {
+		n.children = make(map[string]*growthNode)
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &growthNode{deltaBucket: deltaBucket{Name: name}}
+		n.children[name] = c
+	}
+	return c
+}
+
+func (n *growthNode) add(size int64, after bool) {
+	if after {
+		n.NewBytes += size
+	} else {
+		n.OldBytes += size
+	}
+}
+
+func (n *growthNode) leaf() bool { return len(n.children) == 0 }
+
+func newGrowthTree(before, after scanRecord) *growthNode {
+	root := &growthNode{}
+	for side, record := range []scanRecord{before, after} {
+		for rel, item := range relativeItems(record) {
+			node := root
+			node.add(item.Size, side == 1)
+			for _, elem := range splitPath(rel) {
+				node = node.child(elem)
+				node.add(item.Size, side == 1)
+			}
+			node.Type = item.Type
+		}
+	}
+	root.compact()
+	return root
+}
+
+func (n *growthNode) compact() {
+	for name, c := range n.children {
+		for !c.leaf() && len(c.children) == 1 {
+			for _, only := range c.children {
+				only.Name = c.Name + "/" + only.Name
+				c = only
+			}
+		}
+		n.children[name] = c
+		c.compact()
+	}
+}
+
+// rows lists the children that changed, largest change first.
+func (n *growthNode) rows() []*growthNode {
+	var rows []*growthNode
+	for _, c := range n.children {
+		if c.delta() != 0 {
+			rows = append(rows, c)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		di, dj := abs(rows[i].delta()), abs(rows[j].delta())
+		if di != dj {
+			return di > dj
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
+
+// byType sums the artifacts below n per type.
+func (n *growthNode) byType() []deltaBucket {
+	types := make(map[string]*deltaBucket)
+	var walk func(*growthNode)
+	walk = func(n *growthNode) {
+		if n.leaf() {
+			b, ok := types[n.Type]
+			if !ok {
+				b = &deltaBucket{Name: n.Type}
+				types[n.Type] = b
+			}
+			b.OldBytes += n.OldBytes
+			b.NewBytes += n.NewBytes
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sortedDeltas(types)
+}
+
+// growthModel drills down into the tree: enter opens a directory, backspace
+// goes back up and t switches to the totals per type below the current one.
+type growthModel struct {
+	root   string
+	scans  [2]scanRecord
+	trail  []*growthNode
+	rows   []*growthNode
+	types  []deltaBucket
+	byType bool
+	cursor int
+	offset int
+	width  int
+	height int
+}
+
+var growthKeys = struct {
+	up    key.Binding
+	down  key.Binding
+	open  key.Binding
+	back  key.Binding
+	types key.Binding
+	quit  key.Binding
+}{
+	up:    key.NewBinding(key.WithKeys("up", "k")),
+	down:  key.NewBinding(key.WithKeys("down", "j")),
+	open:  key.NewBinding(key.WithKeys("enter", "right", "l")),
+	back:  key.NewBinding(key.WithKeys("backspace", "left", "h")),
+	types: key.NewBinding(key.WithKeys("t")),
+	quit:  key.NewBinding(key.WithKeys("q", "ctrl+c", "esc")),
+}
+
+func newGrowthModel(root string, before, after scanRecord) growthModel {
+	m := growthModel{root: root, scans: [2]scanRecord{before, after}}
+	return m.enter(newGrowthTree(before, after))
+}
+
+func (m growthModel) current() *growthNode { return m.trail[len(m.trail)-1] }
+
+func (m growthModel) enter(node *growthNode) growthModel {
+	m.trail = append(m.trail[:len(m.trail):len(m.trail)], node)
+	return m.refreshed()
+}
+
+func (m growthModel) refreshed() growthModel {
+	m.rows, m.types = m.current().rows(), m.current().byType()
+	m.cursor, m.offset = 0, 0
+	return m
+}
+
+func (m growthModel) rowCount() int {
+	if m.byType {
+		return len(m.types)
+	}
+	return len(m.rows)
+}
+
+func (m growthModel) Init() tea.Cmd { return nil }
+
+func (m growthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m.scrolled(), nil
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, growthKeys.quit):
+			return m, tea.Quit
+		case key.Matches(msg, growthKeys.up):
+			m.cursor = max(m.cursor-1, 0)
+		case key.Matches(msg, growthKeys.down):
+			m.cursor = max(min(m.cursor+1, m.rowCount()-1), 0)
+		case key.Matches(msg, growthKeys.open):
+			if !m.byType && m.cursor < len(m.rows) && !m.rows[m.cursor].leaf() {
+				m = m.enter(m.rows[m.cursor])
+			}
+		case key.Matches(msg, growthKeys.back):
+			if len(m.trail) > 1 {
+				from := m.current()
+				m.trail = m.trail[:len(m.trail)-1]
+				m = m.refreshed()
+				for i, row := range m.rows {
+					if row == from {
+						m.cursor = i
+					}
+				}
+			}
+		case key.Matches(msg, growthKeys.types):
+			m.byType = !m.byType
+			m.cursor, m.offset = 0, 0
+		}
+		return m.scrolled(), nil
+	}
+	return m, nil
+}
+
+// visibleRows is how many rows fit below the header.
+func (m growthModel) visibleRows() int {
+	_, v := docStyle.GetFrameSize()
+	return max(m.height-v-7, 1)
+}
+
+// scrolled moves the offset so the cursor stays on screen.
+func (m growthModel) scrolled() growthModel {
+	rows := m.visibleRows()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	return m
+}
+
+// location is the path of the current directory below the root.
+func (m growthModel) location() string {
+	var names []string
+	for _, node := range m.trail[1:] {
+		names = append(names, node.Name)
+	}
+	return filepath.Join(append([]string{m.root}, names...)...)
+}
+
+func (m growthModel) View() string {
+	node := m.current()
+	const stamp = "2006-01-02 15:04"
+	lines := []string{
+		titleStyle.Render("Growth of " + displayPath(m.location())),
+		fmt.Sprintf("%s -> %s: %s -> %s (%s)",
+			m.scans[0].Time.Local().Format(stamp), m.scans[1].Time.Local().Format(stamp),
+			formatSize(node.OldBytes), formatSize(node.NewBytes), formatDelta(node.delta())),
+		"",
+	}
+
+	end := min(m.offset+m.visibleRows(), m.rowCount())
+	for i := m.offset; i < end; i++ {
+		var b deltaBucket
+		var name string
+		if m.byType {
+			b = m.types[i]
+			name = b.Name
+		} else {
+			row := m.rows[i]
+			b = row.deltaBucket
+			name = row.Name + "/"
+			if row.leaf() {
+				name = row.Name + "  " + row.Type
+			}
+		}
+		line := fmt.Sprintf("%11s  %10s -> %-10s  %s", formatDelta(b.delta()), formatSize(b.OldBytes), formatSize(b.NewBytes), name)
+		if i == m.cursor {
+			lines = append(lines, selectedStyle.Render("> "+line))
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	if m.rowCount() == 0 {
+		lines = append(lines, "Nothing changed here")
+	}
+
+	help := fmt.Sprintf("j/k: move %[1]s enter: open %[1]s backspace: back %[1]s t: by type %[1]s q: quit", symbols.bullet)
+	if m.byType {
+		help = fmt.Sprintf("j/k: move %[1]s t: by directory %[1]s q: quit", symbols.bullet)
+	}
+	return docStyle.Render(strings.Join(lines, "\n") + "\n\n" + help)
+}
+
+func runGrowth(args []string) error {
+	fs := flag.NewFlagSet("growth", flag.ExitOnError)
+	fromFlag := fs.String("from", "7d", "compare with the last scan at least this old")
+	toFlag := fs.String("to", "", "compare the last scan at least this old instead of the newest")
+	list := fs.Bool("list", false, "list the scans of the directory in the history and exit")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy growth [options] [directory]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Compares two earlier scans of the directory and shows which directories")
+		fmt.Fprintln(fs.Output(), "and artifact types grew in between, a level at a time. Every scan that")
+		fmt.Fprintln(fs.Output(), "the UI or devtidy scan finishes is kept for it in the cache directory.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	now := time.Now()
+	from, err := parseAge(*fromFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+	var to time.Duration
+	if *toFlag != "" {
+		if to, err = parseAge(*toFlag); err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+	}
+
+	root := resolveTargetDir(fs.Args())
+	history, err := scanHistory(root)
+	if err != nil {
+		return err
+	}
+	if *list {
+		for _, entry := range history {
+			fmt.Printf("%s  %10s  %s\n", entry.record.Time.Local().Format(time.DateTime), formatSize(totalSize(entry.record.Items)), entry.path)
+		}
+		return nil
+	}
+
+	before, after, err := pickScans(history, now.Add(-from), now.Add(-to))
+	if err != nil {
+		return err
+	}
+	if detectASCII() {
+		useASCII()
+	}
+	_, err = tea.NewProgram(newGrowthModel(root, before.record, after.record), tea.WithAltScreen()).Run()
+	return err
+}
+
+func totalSize(items []CleanableItem) int64 {
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+	return total
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The homebrew group lists what brew cleanup would remove: downloads of
+// outdated formulae and casks in Homebrew's cache, and the old versions of
+// upgraded ones. It is listed as the cache directory, sized by what brew
+// says it would free, and cleaned with brew cleanup itself, which leaves the
+// downloads of current versions alone.
+
+const homebrewPattern = "homebrew-cache"
+
+// homebrewCleanup is what brew cleanup --dry-run reports: each path it would
+// remove and the total it would free.
+type homebrewCleanup struct {
+	entries []previewEntry
+	total   int64
+}
+
+var (
+	// Would remove: /path/foo--1.0.tar.gz (1.2MB)
+	// Would remove: /path/Cellar/foo/1.0 (12 files, 3.4MB)
+	brewWouldRemove = regexp.MustCompile(`^Would remove: (.+) \((?:[\d,]+ files?, )?([\d.]+\s*[KMGT]?B)\)$`)
+	brewWouldFree   = regexp.MustCompile(`would free approximately ([\d.]+\s*[KMGT]?B)`)
+)
+
+// homebrewDryRun asks brew what brew cleanup would remove.
+func homebrewDryRun() homebrewCleanup {
+	var c homebrewCleanup
+	for _, line := range strings.Split(toolOutput("brew", "cleanup", "--dry-run"), "\n") {
+		line = strings.TrimSpace(line)
+		if m := brewWouldRemove.FindStringSubmatch(line); m != nil {
+			size, _ := parseSize(m[2])
+			c.entries = append(c.entries, previewEntry{name: m[1], size: size})
+		} else if m := brewWouldFree.FindStringSubmatch(line); m != nil {
+			c.total, _ = parseSize(m[1])
+		}
+	}
+	if c.total == 0 {
+		for _, e := range c.entries {
+			c.total += e.size
+		}
+	}
+	return c
+}
+
+// detectHomebrew lists Homebrew's cache when brew cleanup would free
+// anything.
+func detectHomebrew() []CleanableItem {
+	cache := toolOutput("brew", "--cache")
+	if cache == "" {
+		return nil
+	}
+	item, ok := cacheItem(cache, homebrewPattern, "Homebrew cache",
+		"Downloads of outdated formulae and casks, and old versions of upgraded ones; brew cleanup removes them and keeps current downloads")
+	if !ok {
+		return nil
+	}
+	cleanup := homebrewDryRun()
+	if cleanup.total == 0 {
+		return nil
+	}
+	item.Size = cleanup.total
+	return []CleanableItem{item}
+}
+
+// homebrewCleaner runs brew cleanup, which removes whatever is outdated by
+// then.
+func homebrewCleaner(string) error {
+	return runToolClean(exec.Command("brew", "cleanup"))
+}
+
+// loadHomebrewListing previews the Homebrew item with what brew cleanup
+// would remove.
+func loadHomebrewListing(path string) tea.Cmd {
+	return func() tea.Msg {
+		if toolOutput("brew", "--cache") == "" {
+			return previewMsg{path: path, err: errors.New("brew isn't installed")}
+		}
+		return previewMsg{path: path, entries: homebrewDryRun().entries}
+	}
+}
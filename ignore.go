@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The ignore list holds paths and globs that are never scanned, like
+// exclude in the config file, but kept in the state directory so that on a
+// shared one a team protects the same paths. It is a plain text file in the
+// format of the pins file.
+
+func loadIgnoreList() ([]string, error) {
+	return readStateList("ignore")
+}
+
+// updateIgnoreList adds patterns to the ignore list as it is now, or removes
+// them, and returns the list saved.
+func updateIgnoreList(patterns []string, remove bool) ([]string, error) {
+	var list []string
+	err := updateStateFile("ignore", func(data []byte) ([]byte, error) {
+		var err error
+		if list, err = parseStateList(data); err != nil {
+			return nil, err
+		}
+		for _, p := range patterns {
+			list = slices.DeleteFunc(list, func(s string) bool { return s == p })
+			if !remove {
+				list = append(list, p)
+			}
+		}
+		return formatStateList("Paths and globs devtidy never scans", list), nil
+	})
+	return list, err
+}
+
+func runIgnore(args []string) error {
+	fs := flag.NewFlagSet("ignore", flag.ExitOnError)
+	remove := fs.Bool("remove", false, "remove the paths and globs from the ignore list")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy ignore [options] [path or glob...]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Adds paths and globs to the ignore list in the state directory, which")
+		fmt.Fprintln(fs.Output(), "are never scanned, or lists it when none are given.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	list, err := loadIgnoreList()
+	if fs.NArg() > 0 {
+		patterns := make([]string, 0, fs.NArg())
+		for _, p := range fs.Args() {
+			p = expandHome(p)
+			// Globs are kept as given, since those without a separator
+			// match names anywhere
+			if !strings.ContainsAny(p, "*?[") {
+				if p, err = filepath.Abs(p); err != nil {
+					return err
+				}
+			}
+			patterns = append(patterns, p)
+		}
+		list, err = updateIgnoreList(patterns, *remove)
+	}
+	if err != nil {
+		return err
+	}
+	for _, p := range list {
+		fmt.Println(p)
+	}
+	return nil
+}
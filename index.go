@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Every scan, including those of the daemon, and every clean is also
+// recorded in an index, a bbolt database in the cache directory, so
+// devtidy query --index can answer questions across every root and every
+// scan of a machine, like which node_modules over 1 GB were seen in the last
+// month, without reading the scan history. Indexing is best effort: a
+// database another devtidy holds, or one that fails, never holds up a scan
+// or a clean.
+//
+// The schema, version 1, has four buckets, every value being JSON:
+//
+//	meta    "version" -> "1"
+//	items   path -> indexedItem: the item as last scanned, with when it was
+//	        first and last seen; cleaning it removes it
+//	scans   time "\x00" root -> indexedScan: the root, host, item count
+//	        and reclaimable size of a scan
+//	cleans  time "\x00" path -> indexedClean: an item cleaned, its size and
+//	        whether it was deleted, archived or moved to the trash, signed
+//	        with signing_key
+//
+// Times in keys are UTC in RFC 3339 with all nine digits of nanoseconds, so
+// keys sort by time. history_max_age expires scans and cleans like the scan
+// history, and items not seen by a scan since.
+
+const indexVersion = "1"
+
+var (
+	itemsBucket  = []byte("items")
+	scansBucket  = []byte("scans")
+	cleansBucket = []byte("cleans")
+	metaBucket   = []byte("meta")
+)
+
+// indexLockTimeout is how long to wait for a database another devtidy has
+// open.
+const indexLockTimeout = 2 * time.Second
+
+// indexedItem is an item in the index.
+type indexedItem struct {
+	CleanableItem
+	Host      string    `json:"host,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// indexedItemJSON stores the fields of the index next to those of the item;
+// the MarshalJSON of CleanableItem would otherwise be promoted and drop them.
+type indexedItemJSON struct {
+	itemJSON
+	Host      string    `json:"host,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+func (e indexedItem) MarshalJSON() ([]byte, error) {
+	item := itemJSON{itemFields(e.CleanableItem), pathBytes(e.Path)}
+	return json.Marshal(indexedItemJSON{item, e.Host, e.FirstSeen, e.LastSeen})
+}
+
+func (e *indexedItem) UnmarshalJSON(data []byte) error {
+	var v indexedItemJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*e = indexedItem{CleanableItem(v.itemFields), v.Host, v.FirstSeen, v.LastSeen}
+	if v.PathBytes != nil {
+		e.Path = string(v.PathBytes)
+	}
+	return nil
+}
+
+// indexedScan is a scan in the index.
+type indexedScan struct {
+	Root  string    `json:"root"`
+	Host  string    `json:"host,omitempty"`
+	Time  time.Time `json:"time"`
+	Items int       `json:"items"`
+	Size  int64     `json:"size"`
+}
+
+// indexedClean is a cleaned item in the index.
+type indexedClean struct {
+	Path string    `json:"path"`
+	Type string    `json:"type"`
+	Size int64     `json:"size"`
+	Time time.Time `json:"time"`
+	// How is deleted, archived or trashed
+	How string `json:"how"`
+	// Prev and Signature chain and sign the record with signing_key; see
+	// journal.go.
+	Prev      string `json:"prev,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// indexPath is index.db in devtidy's cache directory, or in a shared state
+// directory, where the whole team's scans and cleans are recorded.
+func indexPath() (string, error) {
+	if dir, shared, err := stateDir(); err == nil && shared {
+		return filepath.Join(dir, "index.db"), nil
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "index.db"), nil
+}
+
+// openIndex opens the index for writing, creating it and its buckets if
+// needed.
+func openIndex() (*bolt.DB, error) {
+	if readOnly {
+		return nil, errReadOnly
+	}
+	path, err := indexPath()
+	if err != nil {
+		return nil, err
+	}
+	mode := os.FileMode(0o644)
+	if _, shared, err := stateDir(); err == nil && shared {
+		if err := makeStateDir(filepath.Dir(path), true); err != nil {
+			return nil, err
+		}
+		mode = sharedFileMode
+	} else if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	_, statErr := os.Stat(path)
+	db, err := bolt.Open(path, mode, &bolt.Options{Timeout: indexLockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("opening the index %s: %w", path, err)
+	}
+	if os.IsNotExist(statErr) {
+		// bolt creates it with the umask applied
+		os.Chmod(path, mode)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{itemsBucket, scansBucket, cleansBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		meta := tx.Bucket(metaBucket)
+		v := meta.Get([]byte("version"))
+		if v == nil {
+			return meta.Put([]byte("version"), []byte(indexVersion))
+		}
+		return checkIndexVersion(path, v)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func checkIndexVersion(path string, v []byte) error {
+	if string(v) != indexVersion {
+		return fmt.Errorf("the index %s has schema version %s, not %s; delete it to start again", path, v, indexVersion)
+	}
+	return nil
+}
+
+// viewIndex runs fn in a transaction of the index opened read-only, so
+// reading never creates or changes it, not even in read-only mode. A
+// missing index is empty and fn isn't called.
+func viewIndex(fn func(tx *bolt.Tx) error) error {
+	path, err := indexPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: indexLockTimeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("opening the index %s: %w", path, err)
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{itemsBucket, scansBucket, cleansBucket, metaBucket} {
+			if tx.Bucket(name) == nil {
+				return fmt.Errorf("%s is not a devtidy index: it has no %s bucket", path, name)
+			}
+		}
+		if err := checkIndexVersion(path, tx.Bucket(metaBucket).Get([]byte("version"))); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// indexKey is a key sorting by t.
+func indexKey(t time.Time, name string) []byte {
+	return []byte(t.UTC().Format("2006-01-02T15:04:05.000000000Z") + "\x00" + name)
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// indexScan records a scan and the items it found.
+func indexScan(record scanRecord) error {
+	if readOnly {
+		return nil
+	}
+	db, err := openIndex()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		items := tx.Bucket(itemsBucket)
+		scan := indexedScan{Root: record.Root, Host: record.Host, Time: record.Time, Items: len(record.Items)}
+		for _, item := range record.Items {
+			scan.Size += item.Size
+			entry := indexedItem{CleanableItem: item, Host: record.Host, FirstSeen: record.Time, LastSeen: record.Time}
+			if entry.Root == "" {
+				entry.Root = record.Root
+			}
+			var seen indexedItem
+			if data := items.Get([]byte(item.Path)); data != nil && json.Unmarshal(data, &seen) == nil {
+				entry.FirstSeen = seen.FirstSeen
+			}
+			if err := putJSON(items, []byte(item.Path), entry); err != nil {
+				return err
+			}
+		}
+		return putJSON(tx.Bucket(scansBucket), indexKey(record.Time, record.Root), scan)
+	})
+}
+
+// indexCleaned records the items of a clean, which the index no longer
+// lists. how is deleted, archived or trashed. With signing_key set the
+// records are signed; a key that can't be read leaves them unsigned and is
+// reported.
+func indexCleaned(items []CleanableItem, how string) error {
+	if readOnly || len(items) == 0 {
+		return nil
+	}
+	key, keyErr := journalKey()
+	db, err := openIndex()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	now := time.Now()
+	err = db.Update(func(tx *bolt.Tx) error {
+		cleans := tx.Bucket(cleansBucket)
+		prev := lastSignature(cleans)
+		for _, item := range items {
+			k := indexKey(now, item.Path)
+			clean := indexedClean{Path: item.Path, Type: item.Type, Size: item.Size, Time: now, How: how}
+			if key != nil {
+				clean.Prev = prev
+				message, err := signedMessage(k, clean)
+				if err != nil {
+					return err
+				}
+				clean.Signature = key.sign(message)
+				prev = clean.Signature
+			}
+			if err := putJSON(cleans, k, clean); err != nil {
+				return err
+			}
+			if err := tx.Bucket(itemsBucket).Delete([]byte(item.Path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && keyErr != nil {
+		err = fmt.Errorf("not signed: %w", keyErr)
+	}
+	return err
+}
+
+// indexCleanedCmd records the items of a clean from the UI in the
+// background. It is best effort.
+func indexCleanedCmd(items []CleanableItem, how string) tea.Cmd {
+	return func() tea.Msg {
+		indexCleaned(items, how)
+		return nil
+	}
+}
+
+// cleanMethod is how a clean with these options gets rid of items, for
+// indexCleaned.
+func cleanMethod(trash bool, archive string) string {
+	switch {
+	case trash:
+		return "trashed"
+	case archive != "":
+		return "archived"
+	}
+	return "deleted"
+}
+
+// indexedItems returns the items of the index last seen since then.
+func indexedItems(since time.Time) ([]CleanableItem, error) {
+	var items []CleanableItem
+	err := viewIndex(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).ForEach(func(_, data []byte) error {
+			var entry indexedItem
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			if !entry.LastSeen.Before(since) {
+				items = append(items, entry.CleanableItem)
+			}
+			return nil
+		})
+	})
+	return items, err
+}
+
+// indexedCleans returns the items cleaned since then, oldest first.
+func indexedCleans(since time.Time) ([]CleanableItem, error) {
+	var items []CleanableItem
+	err := viewIndex(func(tx *bolt.Tx) error {
+		c := tx.Bucket(cleansBucket).Cursor()
+		for k, data := c.Seek(indexKey(since, "")); k != nil; k, data = c.Next() {
+			var clean indexedClean
+			if err := json.Unmarshal(data, &clean); err != nil {
+				return err
+			}
+			items = append(items, CleanableItem{Path: clean.Path, Type: clean.Type, Size: clean.Size, ModTime: clean.Time, Info: clean.How})
+		}
+		return nil
+	})
+	return items, err
+}
+
+// pruneIndex drops the scans and cleans before then, and the items last
+// seen before then, and returns how many.
+func pruneIndex(before time.Time) (int, error) {
+	if readOnly {
+		return 0, errReadOnly
+	}
+	db, err := openIndex()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	var pruned int
+	err = db.Update(func(tx *bolt.Tx) error {
+		// Scans and cleans are keyed by time, items by path
+		end := string(indexKey(before, ""))
+		olderKey := func(k, _ []byte) bool { return string(k) < end }
+		buckets := []struct {
+			name    []byte
+			expired func(k, data []byte) bool
+		}{
+			{scansBucket, olderKey},
+			{cleansBucket, olderKey},
+			{itemsBucket, func(_, data []byte) bool { return lastSeenBefore(data, before) }},
+		}
+		for _, bucket := range buckets {
+			b := tx.Bucket(bucket.name)
+			// Deleting under a cursor can skip the next key
+			var expired [][]byte
+			c := b.Cursor()
+			for k, data := c.First(); k != nil; k, data = c.Next() {
+				if bucket.expired(k, data) {
+					expired = append(expired, append([]byte(nil), k...))
+				}
+			}
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			pruned += len(expired)
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// lastSeenBefore reports whether the indexed item in data was last seen
+// before t. Items that can't be read are kept.
+func lastSeenBefore(data []byte, t time.Time) bool {
+	var entry indexedItem
+	return json.Unmarshal(data, &entry) == nil && entry.LastSeen.Before(t)
+}
+
+// rebuildIndex records the scans of the history that the index doesn't
+// hold yet, oldest first, so it covers the scans made before it existed.
+func rebuildIndex() (int, error) {
+	dir, err := scanHistoryDir()
+	if err != nil {
+		return 0, err
+	}
+	names, err := historyFiles(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	indexed := make(map[string]bool)
+	err = viewIndex(func(tx *bolt.Tx) error {
+		return tx.Bucket(scansBucket).ForEach(func(k, _ []byte) error {
+			indexed[string(k)] = true
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	var added int
+	for _, name := range names {
+		record, err := readScanRecord(name)
+		if err != nil || indexed[string(indexKey(record.Time, record.Root))] {
+			continue
+		}
+		if err := indexScan(record); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, nil
+}
+
+func runIndex(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	rebuild := fs.Bool("rebuild", false, "add the scans of the history the index doesn't hold yet")
+	addReadOnlyFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy index [options]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Shows what the index of scans and cleans holds; query it with")
+		fmt.Fprintln(fs.Output(), "devtidy query --index.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *rebuild {
+		if readOnly {
+			return errReadOnly
+		}
+		added, err := rebuildIndex()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added %d scans from the history\n", added)
+	}
+	var scans, items, cleans int
+	var size, cleaned int64
+	err := viewIndex(func(tx *bolt.Tx) error {
+		scans = tx.Bucket(scansBucket).Stats().KeyN
+		tx.Bucket(itemsBucket).ForEach(func(_, data []byte) error {
+			var entry indexedItem
+			if json.Unmarshal(data, &entry) == nil {
+				items++
+				size += entry.Size
+			}
+			return nil
+		})
+		return tx.Bucket(cleansBucket).ForEach(func(_, data []byte) error {
+			var clean indexedClean
+			if json.Unmarshal(data, &clean) == nil {
+				cleans++
+				cleaned += clean.Size
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	path, _ := indexPath()
+	fmt.Printf("Index: %s\n", displayPath(path))
+	fmt.Printf("Scans: %d\n", scans)
+	fmt.Printf("Items: %d (%s)\n", items, formatSize(size))
+	fmt.Printf("Cleaned: %d (%s)\n", cleans, formatSize(cleaned))
+	return nil
+}
@@ -0,0 +1,103 @@
+//go:build !readonly
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestIndexScan(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	first := time.Now().Add(-48 * time.Hour)
+	last := time.Now()
+	item := CleanableItem{Path: "/work/app/node_modules", Type: "node_modules", Size: 100}
+	for _, at := range []time.Time{first, last} {
+		if err := indexScan(scanRecord{Root: "/work", Host: "build1", Time: at, Items: []CleanableItem{item}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := indexedItems(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Path != item.Path || items[0].Root != "/work" {
+		t.Fatalf("items seen in the last hour = %v, want %s", items, item.Path)
+	}
+	err = viewIndex(func(tx *bolt.Tx) error {
+		var entry indexedItem
+		if err := json.Unmarshal(tx.Bucket(itemsBucket).Get([]byte(item.Path)), &entry); err != nil {
+			return err
+		}
+		if !entry.FirstSeen.Equal(first) || !entry.LastSeen.Equal(last) || entry.Host != "build1" {
+			t.Errorf("indexed %+v, want first seen %v and last seen %v on build1", entry, first, last)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := indexCleaned([]CleanableItem{item}, "deleted"); err != nil {
+		t.Fatal(err)
+	}
+	cleans, err := indexedCleans(time.Time{})
+	if err != nil || len(cleans) != 1 || cleans[0].Path != item.Path || cleans[0].Info != "deleted" {
+		t.Errorf("cleans = %v, %v, want %s deleted", cleans, err, item.Path)
+	}
+	if items, _ := indexedItems(time.Time{}); len(items) != 0 {
+		t.Errorf("a cleaned item is still listed: %v", items)
+	}
+}
+
+func TestReadingAMissingIndex(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	saved := readOnly
+	t.Cleanup(func() { readOnly = saved })
+	readOnly = true
+
+	items, err := indexedItems(time.Time{})
+	if err != nil || len(items) != 0 {
+		t.Errorf("indexedItems = %v, %v, want none", items, err)
+	}
+	if err := runIndex(nil); err != nil {
+		t.Errorf("runIndex: %v", err)
+	}
+	path, _ := indexPath()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("reading created the index: %v", err)
+	}
+}
+
+func TestPruneIndex(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	now := time.Now()
+	old := now.Add(-60 * 24 * time.Hour)
+	if err := indexScan(scanRecord{Root: "/work", Time: old, Items: []CleanableItem{{Path: "/work/a/node_modules"}, {Path: "/work/b/target"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexScan(scanRecord{Root: "/work", Time: now, Items: []CleanableItem{{Path: "/work/b/target"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := pruneIndex(now.Add(-30 * 24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The old scan and the item only it saw
+	if pruned != 2 {
+		t.Errorf("pruned %d records, want 2", pruned)
+	}
+	items, err := indexedItems(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Path != "/work/b/target" {
+		t.Errorf("items left = %v, want only /work/b/target", items)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Language servers and code search tools keep indexes that they rebuild on
+// their own, at the cost of a slow first start. The ones inside projects are
+// listed like any other artifact; those shared by every project are the
+// opt-in indexer-cache group.
+
+const (
+	goplsCachePattern  = "gopls-cache"
+	clangdIndexPattern = "clangd-index"
+	zoektIndexPattern  = "zoekt-index"
+)
+
+// detectIndexerCaches lists the indexes in the home cache directory that
+// exist.
+func detectIndexerCaches() []CleanableItem {
+	cache, _ := os.UserCacheDir()
+	home, _ := os.UserHomeDir()
+	gopls := os.Getenv("GOPLSCACHE")
+	if gopls == "" && cache != "" {
+		gopls = filepath.Join(cache, "gopls")
+	}
+	var items []CleanableItem
+	for _, c := range []struct {
+		path, pattern, desc, info string
+	}{
+		{gopls, goplsCachePattern, "Indexer cache (gopls)",
+			"Type information gopls saved about Go packages; it is computed again when a workspace is opened"},
+		{filepath.Join(cache, "clangd"), clangdIndexPattern, "Indexer cache (clangd)",
+			"The background index of files outside any project; clangd indexes them again"},
+		{filepath.Join(home, ".zoekt"), zoektIndexPattern, "Indexer cache (zoekt)",
+			"Search indexes of repositories; searches find nothing in them until they are indexed again"},
+	} {
+		// without a home or cache directory the paths are relative, which
+		// cacheItem refuses
+		if item, ok := cacheItem(c.path, c.pattern, c.desc, c.info); ok {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// inDirNamed gates a pattern to directories whose parent is named name.
+func inDirNamed(name string) func(project string) bool {
+	return func(project string) bool { return filepath.Base(project) == name }
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Issue phases
+const (
+	phaseScan  = "scan"
+	phaseClean = "clean"
+)
+
+// Issue kinds
+const (
+	issuePermission  = "permission"
+	issueSymlink     = "symlink"
+	issueInUse       = "in-use"
+	issueCrossDevice = "cross-device"
+	issueChanged     = "changed"
+	issueError       = "error"
+)
+
+// Issue records a path that was skipped during the scan or failed to delete.
+type Issue struct {
+	Path   string `json:"path"`
+	Phase  string `json:"phase"`
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+}
+
+// issueLog collects issues from concurrent walkers. A nil log discards everything.
+type issueLog struct {
+	mu     sync.Mutex
+	issues []Issue
+}
+
+func (l *issueLog) add(issue Issue) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.issues = append(l.issues, issue)
+	l.mu.Unlock()
+}
+
+func (l *issueLog) list() []Issue {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Issue(nil), l.issues...)
+}
+
+func newIssue(path, phase string, err error) Issue {
+	return Issue{
+		Path:   path,
+		Phase:  phase,
+		Kind:   classifyError(err),
+		Reason: errorReason(err),
+	}
+}
+
+func classifyError(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return issuePermission
+	case errors.Is(err, syscall.EBUSY), errors.Is(err, syscall.ETXTBSY):
+		return issueInUse
+	case errors.Is(err, syscall.EXDEV):
+		return issueCrossDevice
+	case errors.Is(err, errChangedSinceScan):
+		return issueChanged
+	}
+	return issueError
+}
+
+// errorReason strips the path from fs errors since it is shown separately.
+func errorReason(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+func countIssues(issues []Issue, phase string) int {
+	count := 0
+	for _, issue := range issues {
+		if issue.Phase == phase {
+			count++
+		}
+	}
+	return count
+}
+
+func renderIssues(issues []Issue) string {
+	if len(issues) == 0 {
+		return "No paths were skipped and no deletions failed."
+	}
+
+	var b strings.Builder
+	sections := []struct {
+		phase string
+		title string
+	}{
+		{phaseScan, "Skipped during scan"},
+		{phaseClean, "Failed deletions"},
+	}
+	for _, section := range sections {
+		n := countIssues(issues, section.phase)
+		if n == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(fmt.Sprintf("%s (%d)\n", section.title, n))
+		for _, issue := range issues {
+			if issue.Phase != section.phase {
+				continue
+			}
+			b.WriteString(fmt.Sprintf("  [%s] %s\n", issue.Kind, displayPath(issue.Path)))
+			b.WriteString(fmt.Sprintf("      %s\n", issue.Reason))
+		}
+	}
+	return b.String()
+}
+
+// exportIssues writes the issues as JSON into dir and returns the file path.
+func exportIssues(dir string, issues []Issue) (string, error) {
+	if issues == nil {
+		issues = []Issue{}
+	}
+	data, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("devtidy-issues-%s.json", time.Now().Format("20060102-150405"))
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// itemSet is the single source of truth for scanned items. The list model only
+// displays snapshots of it, taken through Model.refreshList.
+type itemSet struct {
+	items []CleanableItem
+	index map[string]int
+}
+
+func newItemSet(items []CleanableItem) itemSet {
+	s := itemSet{items: items}
+	s.reindex()
+	return s
+}
+
+func (s *itemSet) reindex() {
+	s.index = make(map[string]int, len(s.items))
+	for i, item := range s.items {
+		s.index[item.Path] = i
+	}
+}
+
+func (s *itemSet) Len() int { return len(s.items) }
+
+// All returns the items in display order. Callers must not modify the slice.
+func (s *itemSet) All() []CleanableItem { return s.items }
+
+func (s *itemSet) Get(path string) (CleanableItem, bool) {
+	i, ok := s.index[path]
+	if !ok {
+		return CleanableItem{}, false
+	}
+	return s.items[i], true
+}
+
+// Update applies fn to the item at path and reports whether it exists.
+func (s *itemSet) Update(path string, fn func(*CleanableItem)) bool {
+	i, ok := s.index[path]
+	if ok {
+		fn(&s.items[i])
+	}
+	return ok
+}
+
+func (s *itemSet) SetSelected(path string, selected bool) {
+	s.Update(path, func(item *CleanableItem) { item.Selected = selected })
+}
+
+// Selected returns copies of all selected items.
+func (s *itemSet) Selected() []CleanableItem {
+	var selected []CleanableItem
+	for _, item := range s.items {
+		if item.Selected {
+			selected = append(selected, item)
+		}
+	}
+	return selected
+}
+
+func (s *itemSet) SelectedCount() int {
+	count := 0
+	for _, item := range s.items {
+		if item.Selected {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *itemSet) TotalSize() int64 {
+	var total int64
+	for _, item := range s.items {
+		if !item.Cleaned {
+			total += item.Size
+		}
+	}
+	return total
+}
+
+func (s *itemSet) SelectedSize() int64 {
+	var total int64
+	for _, item := range s.items {
+		if item.Selected {
+			total += item.Size
+		}
+	}
+	return total
+}
+
+// SelectWhere selects exactly the items matching expr and returns how many
+// matched.
+func (s *itemSet) SelectWhere(expr queryExpr) int {
+	now := time.Now()
+	count := 0
+	for i := range s.items {
+		s.items[i].Selected = expr.match(s.items[i], now)
+		if s.items[i].Selected {
+			count++
+		}
+	}
+	return count
+}
+
+// RemoveWhere drops every item matching fn.
+func (s *itemSet) RemoveWhere(fn func(CleanableItem) bool) {
+	remaining := s.items[:0]
+	for _, item := range s.items {
+		if !fn(item) {
+			remaining = append(remaining, item)
+		}
+	}
+	s.items = remaining
+	s.reindex()
+}
+
+// ApplyPins marks the items matching pins and moves them to the top, keeping
+// the existing order within pinned and unpinned items.
+func (s *itemSet) ApplyPins(pins []string) {
+	for i := range s.items {
+		_, s.items[i].Pinned = matchPath(pins, s.items[i].Path)
+	}
+	sort.SliceStable(s.items, func(i, j int) bool {
+		return s.items[i].Pinned && !s.items[j].Pinned
+	})
+	s.reindex()
+}
+
+// ApplyNotes sets the note of every item from notes.
+func (s *itemSet) ApplyNotes(notes map[string]string) {
+	applyNotes(s.items, notes)
+}
+
+func (s *itemSet) SortBySize() {
+	s.Sort(sortBySize)
+}
+
+// sortOrder is how the list is ordered; s cycles through them.
+type sortOrder int
+
+const (
+	sortBySize sortOrder = iota // largest first
+	sortByPath
+	sortByType
+	sortByModTime // most recently modified first
+)
+
+var sortOrderNames = []string{"size", "path", "type", "modified"}
+
+func (o sortOrder) String() string { return sortOrderNames[o] }
+
+func (o sortOrder) next() sortOrder { return (o + 1) % sortOrder(len(sortOrderNames)) }
+
+// Sort orders the items, keeping pinned items first.
+func (s *itemSet) Sort(order sortOrder) {
+	sortItems(s.items, order)
+	s.reindex()
+}
+
+// sortItems orders items in place, keeping pinned items first.
+func sortItems(items []CleanableItem, order sortOrder) {
+	less := func(a, b CleanableItem) bool {
+		switch order {
+		case sortByPath:
+			return a.Path < b.Path
+		case sortByType:
+			if a.Type != b.Type {
+				return a.Type < b.Type
+			}
+			return a.Size > b.Size
+		case sortByModTime:
+			return a.ModTime.After(b.ModTime)
+		}
+		return a.Size > b.Size
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		return less(a, b)
+	})
+}
+
+func (s *itemSet) listItems() []list.Item {
+	listItems := make([]list.Item, len(s.items))
+	for i, item := range s.items {
+		listItems[i] = item
+	}
+	return listItems
+}
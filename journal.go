@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/blake2b"
+)
+
+// The cleans in the index are the journal of what devtidy removed. With
+// signing_key set to a minisign secret key, every clean is signed when it is
+// recorded, so a journal kept on regulated build machines is tamper-evident:
+// devtidy verify-journal checks the signatures with the public key.
+//
+// A record is signed over its key and its JSON without the signature. It
+// also names the signature of the record written before it, so removing a
+// record from the middle of the journal breaks the chain. Only the oldest
+// signed record may follow one that is gone, since history_max_age expires
+// the oldest records; removing the newest ones can't be told from devtidy
+// not having cleaned anything since.
+//
+// Signatures are those of minisign's default prehashed mode, Ed25519 over
+// the BLAKE2b-512 hash of the message, as on the second line of a .minisig
+// file. Secret keys must not be encrypted, since the daemon signs
+// unattended; create one with minisign -G -W.
+
+// minisignKey is a minisign key pair, or only the public key.
+type minisignKey struct {
+	id      [8]byte
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+// readMinisignFile returns the decoded key or signature line of a minisign
+// file, which follows an untrusted comment.
+func readMinisignFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a minisign key: %w", path, err)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("%s is not a minisign key: it is empty", path)
+}
+
+// loadSecretKey reads an unencrypted minisign secret key.
+func loadSecretKey(path string) (minisignKey, error) {
+	var k minisignKey
+	data, err := readMinisignFile(path)
+	if err != nil {
+		return k, err
+	}
+	// Algorithm, KDF, checksum algorithm, KDF salt and limits, key ID,
+	// secret key and checksum
+	if len(data) != 2+2+2+32+8+8+8+64+32 || string(data[:2]) != "Ed" {
+		return k, fmt.Errorf("%s is not a minisign secret key", path)
+	}
+	if string(data[2:4]) != "\x00\x00" {
+		return k, fmt.Errorf("the minisign key %s is encrypted; devtidy signs unattended, so create one without a password with minisign -G -W", path)
+	}
+	keynum := data[54:]
+	copy(k.id[:], keynum[:8])
+	k.private = ed25519.PrivateKey(bytes.Clone(keynum[8:72]))
+	sum := blake2b.Sum256(append(append([]byte("Ed"), keynum[:8]...), keynum[8:72]...))
+	if !bytes.Equal(sum[:], keynum[72:]) {
+		return k, fmt.Errorf("the minisign key %s is damaged: its checksum doesn't match", path)
+	}
+	k.public = k.private.Public().(ed25519.PublicKey)
+	return k, nil
+}
+
+// loadPublicKey reads a minisign public key.
+func loadPublicKey(path string) (minisignKey, error) {
+	var k minisignKey
+	data, err := readMinisignFile(path)
+	if err != nil {
+		return k, err
+	}
+	if len(data) != 2+8+32 || string(data[:2]) != "Ed" {
+		return k, fmt.Errorf("%s is not a minisign public key", path)
+	}
+	copy(k.id[:], data[2:10])
+	k.public = ed25519.PublicKey(bytes.Clone(data[10:]))
+	return k, nil
+}
+
+// String is the key ID as minisign prints it.
+func (k minisignKey) String() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(k.id[:]))
+}
+
+func (k minisignKey) sign(message []byte) string {
+	hash := blake2b.Sum512(message)
+	sig := append(append([]byte("ED"), k.id[:]...), ed25519.Sign(k.private, hash[:])...)
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func (k minisignKey) verify(message []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("the signature is malformed")
+	}
+	if !bytes.Equal(sig[2:10], k.id[:]) {
+		return fmt.Errorf("signed with key %016X, not %s", binary.LittleEndian.Uint64(sig[2:10]), k)
+	}
+	signed := message
+	switch string(sig[:2]) {
+	case "ED":
+		hash := blake2b.Sum512(message)
+		signed = hash[:]
+	case "Ed":
+	default:
+		return errors.New("the signature is malformed")
+	}
+	if !ed25519.Verify(k.public, signed, sig[10:]) {
+		return errors.New("the signature doesn't match: the record was changed")
+	}
+	return nil
+}
+
+// journalKey returns the key to sign cleans with, or nil when signing_key
+// isn't set.
+func journalKey() (*minisignKey, error) {
+	if activeConfig.SigningKey == "" {
+		return nil, nil
+	}
+	k, err := loadSecretKey(activeConfig.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("signing_key: %w", err)
+	}
+	return &k, nil
+}
+
+// signedMessage is what the signature of a clean covers.
+func signedMessage(key []byte, clean indexedClean) ([]byte, error) {
+	clean.Signature = ""
+	data, err := json.Marshal(clean)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(bytes.Clone(key), '\n'), data...), nil
+}
+
+// lastSignature returns the signature of the newest clean in the bucket.
+func lastSignature(cleans *bolt.Bucket) string {
+	_, data := cleans.Cursor().Last()
+	var clean indexedClean
+	if data == nil || json.Unmarshal(data, &clean) != nil {
+		return ""
+	}
+	return clean.Signature
+}
+
+// journalReport is what verify-journal found.
+type journalReport struct {
+	records, signed, unsigned int
+	problems                  []string
+}
+
+// verifyJournal checks the signatures and the chain of the cleans.
+func verifyJournal(k minisignKey) (journalReport, error) {
+	var r journalReport
+	type record struct {
+		key   string
+		clean indexedClean
+	}
+	var records []record
+	err := viewIndex(func(tx *bolt.Tx) error {
+		return tx.Bucket(cleansBucket).ForEach(func(key, data []byte) error {
+			var clean indexedClean
+			if err := json.Unmarshal(data, &clean); err != nil {
+				r.problems = append(r.problems, fmt.Sprintf("%q: unreadable record: %v", key, err))
+				return nil
+			}
+			records = append(records, record{string(key), clean})
+			return nil
+		})
+	})
+	if err != nil {
+		return r, err
+	}
+
+	signatures := make(map[string]bool)
+	for _, rec := range records {
+		if rec.clean.Signature != "" {
+			signatures[rec.clean.Signature] = true
+		}
+	}
+	// The first signed record starts the chain: it follows an unsigned one,
+	// or one that expired. Any other record must follow one that is there.
+	signing := false
+	for _, rec := range records {
+		r.records++
+		name := rec.clean.Time.Format("2006-01-02 15:04:05") + " " + displayPath(rec.clean.Path)
+		if rec.clean.Signature == "" {
+			r.unsigned++
+			// Records from before signing was turned on are expected
+			if signing {
+				r.problems = append(r.problems, name+": not signed")
+			}
+			continue
+		}
+		first := !signing
+		signing = true
+		message, err := signedMessage([]byte(rec.key), rec.clean)
+		if err == nil {
+			err = k.verify(message, rec.clean.Signature)
+		}
+		if err != nil {
+			r.problems = append(r.problems, name+": "+err.Error())
+			continue
+		}
+		r.signed++
+		if !first && !signatures[rec.clean.Prev] {
+			r.problems = append(r.problems, name+": the record before it was removed or changed")
+		}
+	}
+	return r, nil
+}
+
+func runVerifyJournal(args []string) error {
+	fs := flag.NewFlagSet("verify-journal", flag.ExitOnError)
+	keyPath := fs.String("key", activeConfig.VerifyKey, "minisign public key to check the signatures with")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy verify-journal [options]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Checks the signatures of the cleans recorded in the index, signed with")
+		fmt.Fprintln(fs.Output(), "signing_key from the config file, and that none was removed in between.")
+		fmt.Fprintln(fs.Output(), "Without --key or verify_key, the public half of signing_key is used.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var k minisignKey
+	var err error
+	switch {
+	case *keyPath != "":
+		k, err = loadPublicKey(expandHome(*keyPath))
+	case activeConfig.SigningKey != "":
+		k, err = loadSecretKey(activeConfig.SigningKey)
+	default:
+		return errors.New("no key to verify with: pass --key or set verify_key or signing_key in the config file")
+	}
+	if err != nil {
+		return err
+	}
+
+	r, err := verifyJournal(k)
+	if err != nil {
+		return err
+	}
+	for _, problem := range r.problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("%d cleans recorded, %d signed with key %s, %d unsigned\n", r.records, r.signed, k, r.unsigned)
+	if len(r.problems) > 0 {
+		return fmt.Errorf("the journal doesn't verify: %d problems", len(r.problems))
+	}
+	if r.records > 0 && r.signed == 0 {
+		return errors.New("none of the cleans is signed")
+	}
+	return nil
+}
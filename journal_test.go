@@ -0,0 +1,152 @@
+//go:build !readonly
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/blake2b"
+)
+
+// writeMinisignKeys writes an unencrypted minisign key pair, as minisign
+// -G -W does, and returns the paths of the secret and the public key.
+func writeMinisignKeys(t *testing.T, dir string) (secret, public string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	sum := blake2b.Sum256(append(append([]byte("Ed"), id...), priv...))
+	sk := append([]byte("Ed\x00\x00B2"), make([]byte, 32+8+8)...)
+	sk = append(append(append(sk, id...), priv...), sum[:]...)
+	pk := append(append([]byte("Ed"), id...), pub...)
+
+	secret, public = filepath.Join(dir, "minisign.key"), filepath.Join(dir, "minisign.pub")
+	for path, data := range map[string][]byte{secret: sk, public: pk} {
+		content := "untrusted comment: minisign key\n" + base64.StdEncoding.EncodeToString(data) + "\n"
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return secret, public
+}
+
+func TestMinisignKeys(t *testing.T) {
+	secret, public := writeMinisignKeys(t, t.TempDir())
+	sk, err := loadSecretKey(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := loadPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sk.public, pk.public) || sk.String() != "0807060504030201" {
+		t.Errorf("keys = %s %x and %s %x, want the same pair", sk, sk.public, pk, pk.public)
+	}
+	sig := sk.sign([]byte("message"))
+	if err := pk.verify([]byte("message"), sig); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if err := pk.verify([]byte("massage"), sig); err == nil {
+		t.Error("a changed message verified")
+	}
+
+	data, _ := readMinisignFile(secret)
+	data[2], data[3] = 'S', 'c'
+	os.WriteFile(secret, []byte(base64.StdEncoding.EncodeToString(data)), 0o600)
+	if _, err := loadSecretKey(secret); err == nil || !strings.Contains(err.Error(), "encrypted") {
+		t.Errorf("loadSecretKey of an encrypted key = %v", err)
+	}
+	if _, err := loadSecretKey(public); err == nil {
+		t.Error("loadSecretKey accepted a public key")
+	}
+}
+
+func TestVerifyJournal(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	secret, public := writeMinisignKeys(t, dir)
+	saved := activeConfig
+	t.Cleanup(func() { activeConfig = saved })
+
+	// A clean from before signing was turned on
+	if err := indexCleaned([]CleanableItem{{Path: "/work/old/dist"}}, "deleted"); err != nil {
+		t.Fatal(err)
+	}
+	activeConfig.SigningKey = secret
+	for _, batch := range [][]CleanableItem{
+		{{Path: "/work/a/node_modules", Size: 10}, {Path: "/work/b/target", Size: 20}},
+		{{Path: "/work/c/build", Size: 30}},
+	} {
+		if err := indexCleaned(batch, "deleted"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k, err := loadPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := verifyJournal(k)
+	if err != nil || len(r.problems) > 0 || r.signed != 3 || r.unsigned != 1 {
+		t.Fatalf("verifyJournal = %+v, %v, want 3 signed and 1 unsigned cleans", r, err)
+	}
+
+	// Changing a record or removing one in the middle shows
+	path, _ := indexPath()
+	edit := func(fn func(b *bolt.Bucket, keys [][]byte) error) {
+		t.Helper()
+		db, err := bolt.Open(path, 0o644, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		err = db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(cleansBucket)
+			var keys [][]byte
+			b.ForEach(func(k, _ []byte) error {
+				keys = append(keys, append([]byte(nil), k...))
+				return nil
+			})
+			return fn(b, keys)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit(func(b *bolt.Bucket, keys [][]byte) error {
+		var clean indexedClean
+		json.Unmarshal(b.Get(keys[1]), &clean)
+		clean.Size = 1
+		return putJSON(b, keys[1], clean)
+	})
+	if r, _ := verifyJournal(k); len(r.problems) != 1 || !strings.Contains(r.problems[0], "changed") {
+		t.Errorf("problems with a changed record = %q", r.problems)
+	}
+	edit(func(b *bolt.Bucket, keys [][]byte) error { return b.Delete(keys[2]) })
+	if r, _ := verifyJournal(k); len(r.problems) != 2 || !strings.Contains(r.problems[1], "removed") {
+		t.Errorf("problems with a removed record = %q", r.problems)
+	}
+
+	// The oldest records expire
+	edit(func(b *bolt.Bucket, keys [][]byte) error {
+		for _, k := range keys[:2] {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if r, _ := verifyJournal(k); len(r.problems) > 0 || r.signed != 1 {
+		t.Errorf("verifyJournal after expiry = %+v, want one signed clean", r)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Jumping moves the cursor to the next item whose path below the root
+// contains the typed text, as it is typed. Unlike filtering the list stays
+// whole, so the neighbours of a match stay in view.
+
+// openJump starts typing a jump from the item under the cursor.
+func (m Model) openJump() (Model, tea.Cmd) {
+	m.jumping = true
+	m.jumpFrom = m.list.Index()
+	m.statusMsg = ""
+	m.command.Prompt = "jump: "
+	m.command.Placeholder = "part of a path; tab: next match"
+	m.command.SetValue("")
+	m.commandActive = true
+	return m, m.command.Focus()
+}
+
+// updateJump handles a key typed while jumping: enter keeps the cursor where
+// it is, esc returns to where the jump started and tab goes on to the next
+// match.
+func (m Model) updateJump(msg tea.KeyMsg) (Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		return m.closeJump(), nil
+	case tea.KeyEsc:
+		m.list.Select(m.jumpFrom)
+		return m.closeJump(), nil
+	case tea.KeyTab:
+		m.jumpTo(m.list.Index() + 1)
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.command, cmd = m.command.Update(msg)
+	m.jumpTo(m.jumpFrom)
+	return m, cmd
+}
+
+func (m Model) closeJump() Model {
+	m.jumping = false
+	return m.closeCommand()
+}
+
+// jumpTo moves the cursor to the first match at or after index, wrapping
+// around at the end of the list.
+func (m *Model) jumpTo(index int) {
+	fragment := strings.ToLower(m.command.Value())
+	visible := m.list.VisibleItems()
+	if fragment == "" || len(visible) == 0 {
+		return
+	}
+	for n := range visible {
+		i := (index + n) % len(visible)
+		if strings.Contains(strings.ToLower(m.jumpPath(visible[i])), fragment) {
+			m.list.Select(i)
+			m.statusMsg = ""
+			return
+		}
+	}
+	m.statusMsg = errorStyle.Render(fmt.Sprintf("No path contains %q", m.command.Value()))
+}
+
+// jumpPath is the path of a list entry below the root, so the root's own
+// path doesn't match everything.
+func (m Model) jumpPath(listItem list.Item) string {
+	var path string
+	switch it := listItem.(type) {
+	case CleanableItem:
+		path = it.Path
+	case groupHeader:
+		if it.byType {
+			return it.key
+		}
+		path = it.key
+	}
+	if rel, err := filepath.Rel(m.currentDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
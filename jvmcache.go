@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The jvm group lists what Gradle, Maven and Ivy download into the home
+// directory. With --jvm-keep only the artifacts nobody read within that age
+// are listed and cleaned, so the dependencies of active projects stay.
+
+const (
+	gradleWrapperPattern = "gradle-wrapper"
+	gradleCachesPattern  = "gradle-caches"
+	mavenRepoPattern     = "maven-repository"
+	ivyCachePattern      = "ivy-cache"
+)
+
+// jvmKeep keeps artifacts read within this age when cleaning; 0 cleans
+// everything.
+var jvmKeep time.Duration
+
+// gradleUserHome returns $GRADLE_USER_HOME, or ~/.gradle.
+func gradleUserHome() string {
+	if dir := os.Getenv("GRADLE_USER_HOME"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".gradle")
+}
+
+var localRepositoryTag = regexp.MustCompile(`<localRepository>\s*([^<]+?)\s*</localRepository>`)
+
+// mavenRepository returns the local repository set in ~/.m2/settings.xml, or
+// ~/.m2/repository.
+func mavenRepository() string {
+	home, _ := os.UserHomeDir()
+	m2 := filepath.Join(home, ".m2")
+	if data, err := os.ReadFile(filepath.Join(m2, "settings.xml")); err == nil {
+		if m := localRepositoryTag.FindSubmatch(data); m != nil {
+			return expandHome(strings.ReplaceAll(string(m[1]), "${user.home}", home))
+		}
+	}
+	return filepath.Join(m2, "repository")
+}
+
+// detectJVMCaches lists the Gradle, Maven and Ivy caches that exist.
+func detectJVMCaches() []CleanableItem {
+	home, _ := os.UserHomeDir()
+	gradle := gradleUserHome()
+	var items []CleanableItem
+	for _, c := range []struct {
+		path, pattern, desc, info string
+	}{
+		{filepath.Join(gradle, "wrapper", "dists"), gradleWrapperPattern, "Gradle wrapper distributions",
+			"Gradle versions downloaded by gradlew; each is downloaded again by the next build using it"},
+		{filepath.Join(gradle, "caches"), gradleCachesPattern, "Gradle caches",
+			"Dependencies and build caches of every Gradle project; the next builds download and rebuild them"},
+		{mavenRepository(), mavenRepoPattern, "Maven local repository",
+			"Downloaded dependencies; artifacts installed with mvn install are only here until rebuilt"},
+		{filepath.Join(home, ".ivy2", "cache"), ivyCachePattern, "Ivy cache",
+			"Dependencies downloaded by Ivy, Ant and sbt; fetched again when needed"},
+	} {
+		item, ok := cacheItem(c.path, c.pattern, c.desc, c.info)
+		if !ok {
+			continue
+		}
+		if jvmKeep > 0 {
+			units := unusedArtifacts(item.Path, item.Pattern, time.Now().Add(-jvmKeep))
+			if len(units) == 0 {
+				continue
+			}
+			for _, u := range units {
+				item.Size += u.size
+			}
+			item.Info += fmt.Sprintf("; only what nobody read for %s is cleaned (%d artifacts)", keepAge(jvmKeep), len(units))
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// artifact is a unit of a JVM cache that is kept or removed as a whole.
+type artifact struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// artifactUnits returns the directories of a cache that are kept or removed
+// as a whole: a distribution of the wrapper, a module version in the Gradle
+// and Ivy caches, a directory holding a Maven artifact's files, and any other
+// top-level directory of the Gradle caches.
+func artifactUnits(root, pattern string) []string {
+	var units []string
+	add := func(dir string, depth int) {
+		filepath.WalkDir(fsPath(dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(fsPath(dir), path)
+			if rel == "." {
+				return nil
+			}
+			if strings.Count(rel, string(filepath.Separator))+1 == depth {
+				units = append(units, filepath.Join(dir, rel))
+				return fs.SkipDir
+			}
+			return nil
+		})
+	}
+	switch pattern {
+	case gradleCachesPattern:
+		entries, _ := os.ReadDir(fsPath(root))
+		for _, e := range entries {
+			path := filepath.Join(root, e.Name())
+			switch {
+			case !e.IsDir():
+			case e.Name() == "modules-2":
+				add(filepath.Join(path, "files-2.1"), 3)
+			default:
+				units = append(units, path)
+			}
+		}
+	case mavenRepoPattern:
+		filepath.WalkDir(fsPath(root), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if strings.HasSuffix(d.Name(), ".pom") || strings.HasSuffix(d.Name(), ".jar") {
+				units = append(units, filepath.Dir(path))
+				return fs.SkipDir
+			}
+			return nil
+		})
+	case ivyCachePattern:
+		add(root, 2)
+	default:
+		add(root, 1)
+	}
+	return units
+}
+
+// unusedArtifacts returns the units of a cache whose files were all last read
+// before cutoff, with their sizes.
+func unusedArtifacts(root, pattern string, cutoff time.Time) []artifact {
+	var unused []artifact
+	for _, unit := range artifactUnits(root, pattern) {
+		a := artifact{path: unit}
+		// Only files count: walking a cache reads its directories, which
+		// would make every one of them look used
+		filepath.WalkDir(fsPath(unit), func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				if t := accessTime(info); t.After(a.lastUsed) {
+					a.lastUsed = t
+				}
+				a.size += info.Size()
+			}
+			return nil
+		})
+		if a.lastUsed.Before(cutoff) {
+			unused = append(unused, a)
+		}
+	}
+	return unused
+}
+
+// keepAge describes d in days when it is at least one.
+func keepAge(d time.Duration) string {
+	if days := int(d.Hours() / 24); days >= 1 {
+		return fmt.Sprintf("%d days", days)
+	}
+	return d.String()
+}
+
+// jvmCleaner removes a JVM cache, or with --jvm-keep the artifacts in it
+// nobody read since.
+func jvmCleaner(pattern string) func(path string) error {
+	return func(path string) error {
+		if jvmKeep <= 0 {
+			return removeAll(path)
+		}
+		var errs []error
+		for _, a := range unusedArtifacts(path, pattern, time.Now().Add(-jvmKeep)) {
+			if err := removeAll(a.path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// scanRecord is a finished scan as persisted between runs
+type scanRecord struct {
+	Root  string          `json:"root"`
+	Host  string          `json:"host,omitempty"`
+	Time  time.Time       `json:"time"`
+	Items []CleanableItem `json:"items"`
+	// Plan lists the paths chosen for cleaning when the record is a plan
+	Plan []string `json:"plan,omitempty"`
+}
+
+func newScanRecord(root string, items []CleanableItem) scanRecord {
+	return scanRecord{
+		Root:  root,
+		Host:  hostname(),
+		Time:  time.Now(),
+		Items: append([]CleanableItem(nil), items...),
+	}
+}
+
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "devtidy"), nil
+}
+
+func lastScanPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "last-scan.json"), nil
+}
+
+func writeLastScan(record scanRecord) error {
+	path, err := lastScanPath()
+	if err != nil {
+		return err
+	}
+	if err := writeScanRecord(path, record); err != nil {
+		return err
+	}
+	// The index is best effort, see indexScan
+	indexScan(record)
+	return archiveScan(record)
+}
+
+func writeScanRecord(path string, record scanRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so a concurrent reader never sees a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readScanRecord(path string) (scanRecord, error) {
+	var record scanRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record, err
+	}
+	err = json.Unmarshal(data, &record)
+	return record, err
+}
+
+// saveLastScan persists the results in the background. It is best effort:
+// failing to cache a scan must not interrupt the session.
+func saveLastScan(root string, items []CleanableItem) tea.Cmd {
+	record := newScanRecord(root, items)
+	return func() tea.Msg {
+		writeLastScan(record)
+		return nil
+	}
+}
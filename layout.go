@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Below these sizes, as in a small editor pane, the selection screen shows
+// one line per item and only the essential controls, so the list still
+// gets most of the window.
+const (
+	compactWidth  = 70
+	compactHeight = 30
+)
+
+// compact reports whether the window is too small for the full layout.
+// Until its size is known it isn't.
+func (m Model) compact() bool {
+	return m.windowHeight > 0 && (m.windowWidth < compactWidth || m.windowHeight < compactHeight)
+}
+
+// compactDocStyle leaves out the blank lines around the compact layout.
+var compactDocStyle = lipgloss.NewStyle().Margin(0, 1)
+
+// frame is the style around the selection screen.
+func (m Model) frame() lipgloss.Style {
+	if m.compact() {
+		return compactDocStyle
+	}
+	return docStyle
+}
+
+// compactDelegate renders an item as its size and title on a single line,
+// cut to the width of the list.
+type compactDelegate struct{}
+
+func (compactDelegate) Height() int                         { return 1 }
+func (compactDelegate) Spacing() int                        { return 0 }
+func (compactDelegate) Update(tea.Msg, *list.Model) tea.Cmd { return nil }
+
+func (compactDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	var size int64
+	var title string
+	switch it := item.(type) {
+	case CleanableItem:
+		size, title = it.Size, it.Title()
+	case groupHeader:
+		size, title = it.size, it.Title()
+	default:
+		return
+	}
+	cursor := "  "
+	if index == m.Index() {
+		cursor = selectedStyle.Render("> ")
+	}
+	line := fmt.Sprintf("%s%9s  %s", cursor, formatSize(size), title)
+	fmt.Fprint(w, lipgloss.NewStyle().MaxWidth(m.Width()).Render(line))
+}
+
+// resize lays the screens out for a window of the given size, switching
+// between the full and the compact layout.
+func (m Model) resize(width, height int) Model {
+	wasCompact := m.compact()
+	m.windowWidth, m.windowHeight = width, height
+	h, v := docStyle.GetFrameSize()
+	m.detailView.Width = max(width-h, 1)
+	m.detailView.Height = max(height-v-4, 1)
+	compact := m.compact()
+	if compact != wasCompact {
+		if compact {
+			m.list.SetDelegate(compactDelegate{})
+		} else {
+			m.list.SetDelegate(newDelegate())
+		}
+		m.list.SetShowHelp(!compact)
+		m.list.SetShowPagination(!compact)
+	}
+	h, v = m.frame().GetFrameSize()
+	m.list.SetSize(max(width-h, 1), max(height-v-3, 1))
+	return m
+}
+
+// compactFooter is the footer of the selection screen in the compact
+// layout: the selection, the mode and a few keys.
+func (m Model) compactFooter() string {
+	status := fmt.Sprintf("Selected: %d (%s)", m.countSelectedItems(), formatSize(m.calculateTotalSelectedSize()))
+	if m.stream != nil {
+		status += " | Scanning"
+	}
+	if m.calculatingSizes {
+		status += fmt.Sprintf(" | Sizing %d/%d", m.completedSizeJobs, m.totalSizeJobs)
+	}
+	if readOnly {
+		status += " | READ-ONLY"
+	} else if m.dryRun {
+		status += " | DRY RUN"
+	} else if m.trash {
+		status += " | TRASH"
+	} else if m.opts.archiveDir != "" {
+		status += " | ARCHIVE"
+	}
+	if m.visual {
+		status += " | VISUAL"
+	}
+	if m.commandActive {
+		status += "\n" + m.command.View()
+	} else if m.statusMsg != "" {
+		status += "\n" + m.statusMsg
+	}
+	if m.cleaning {
+		status += "\n" + m.queueView()
+	}
+	controls := []string{"space: select", "c: clean", "/: filter", "q: quit"}
+	status += "\n" + strings.Join(controls, " "+symbols.bullet+" ")
+	// wrapped lines would push the list off the screen
+	h, _ := m.frame().GetFrameSize()
+	return "\n" + lipgloss.NewStyle().MaxWidth(max(m.windowWidth-h, 1)).Render(status)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var errWouldBlock = errors.New("lock is held by another process")
+
+// rootLock is an advisory lock that keeps two devtidy instances from
+// cleaning the same root, or one inside the other, at once. The OS drops it
+// if the process dies. Locks live in a directory every user of the machine
+// shares, so two users, or a user and a daemon running as root, see each
+// other's; see lockDir.
+//
+// Every lock file has a .root file beside it naming its root, which isn't
+// locked, so it can be read on every OS. After taking its lock an instance
+// looks at the other locks held: when one is on a root inside or above its
+// own, it gives its lock up. Of two instances locking overlapping roots at
+// once, the later always sees the other's lock, so at most one goes on.
+type rootLock struct {
+	file *os.File
+}
+
+// lockedError reports that another instance is already cleaning root.
+type lockedError struct {
+	root string
+	pid  int
+}
+
+func (e *lockedError) Error() string {
+	if e.pid > 0 {
+		return fmt.Sprintf("another instance (pid %d) is cleaning %s", e.pid, e.root)
+	}
+	return fmt.Sprintf("another instance is cleaning %s", e.root)
+}
+
+// lockDir is the directory of the locks and the mode of the files in it:
+// the locks directory of a shared state directory, whose group is that of
+// its users, or else a system-wide directory anyone can create locks in.
+func lockDir() (string, os.FileMode, error) {
+	if dir, shared, err := stateDir(); err == nil && shared {
+		dir = filepath.Join(dir, "locks")
+		return dir, sharedFileMode, makeStateDir(dir, true)
+	}
+	var firstErr error
+	for _, dir := range systemLockDirs() {
+		err := makePublicDir(dir)
+		if err == nil {
+			return dir, 0o666, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", 0, fmt.Errorf("no directory for the cleaning locks: %w", firstErr)
+}
+
+func systemLockDirs() []string {
+	if runtime.GOOS == "windows" {
+		return []string{
+			filepath.Join(os.Getenv("ProgramData"), "devtidy", "locks"),
+			filepath.Join(os.TempDir(), "devtidy-locks"),
+		}
+	}
+	return []string{"/var/lock/devtidy", filepath.Join(os.TempDir(), "devtidy-locks")}
+}
+
+// makePublicDir creates dir writable by everyone, with the sticky bit so
+// nobody can remove another user's files. An existing one is left alone.
+func makePublicDir(dir string) error {
+	if info, err := os.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	// The umask narrows the mode MkdirAll sets
+	return os.Chmod(dir, os.ModeSticky|0o777)
+}
+
+func lockPath(root string) (string, os.FileMode, error) {
+	dir, mode, err := lockDir()
+	if err != nil {
+		return "", 0, err
+	}
+	sum := sha256.Sum256([]byte(filepath.Clean(root)))
+	return filepath.Join(dir, fmt.Sprintf("%x.lock", sum[:8])), mode, nil
+}
+
+// createShared creates the file at path with mode, whatever the umask, so
+// other users can open it too. It reports whether it created the file.
+func createShared(path string, mode os.FileMode) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return nil, false, err
+	}
+	os.Chmod(path, mode)
+	return file, true, nil
+}
+
+// openLockFile opens the lock file at path, creating it if needed. A lock
+// file of another user that we can't write is opened for reading, which is
+// enough to lock it.
+func openLockFile(path string, mode os.FileMode) (*os.File, error) {
+	file, _, err := createShared(path, mode)
+	if !os.IsExist(err) {
+		return file, err
+	}
+	file, err = os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsPermission(err) {
+		file, err = os.OpenFile(path, os.O_RDONLY, 0)
+	}
+	return file, err
+}
+
+// lockRoot takes the cleaning lock for root without blocking.
+func lockRoot(root string) (*rootLock, error) {
+	path, mode, err := lockPath(root)
+	if err != nil {
+		return nil, err
+	}
+	// The name of a lock file only depends on its root, so an existing
+	// .root file already names it
+	if f, created, err := createShared(path+".root", mode); created {
+		_, err = f.WriteString(filepath.Clean(root))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path + ".root")
+			return nil, err
+		}
+	} else if !os.IsExist(err) {
+		return nil, err
+	}
+	file, err := openLockFile(path, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tryLockFile(file); err != nil {
+		defer file.Close()
+		if errors.Is(err, errWouldBlock) {
+			return nil, &lockedError{root: root, pid: readLockOwner(path)}
+		}
+		return nil, err
+	}
+
+	// Record the owner so competing instances can name it
+	file.Truncate(0)
+	file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"+root+"\n"), 0)
+	lock := &rootLock{file: file}
+	if err := overlappingLock(root, path); err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// overlappingLock looks for a lock held elsewhere on a root inside or above
+// root, whose own lock is at path.
+func overlappingLock(root, path string) error {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*.lock"))
+	if err != nil {
+		return err
+	}
+	root = filepath.Clean(root)
+	for _, other := range matches {
+		if other == path {
+			continue
+		}
+		data, err := os.ReadFile(other + ".root")
+		if err != nil {
+			continue
+		}
+		otherRoot := string(data)
+		if !isBelow(root, otherRoot) && !isBelow(otherRoot, root) {
+			continue
+		}
+		if held(other) {
+			return &lockedError{root: otherRoot, pid: readLockOwner(other)}
+		}
+	}
+	return nil
+}
+
+// held reports whether the lock at path is taken by someone else.
+func held(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	if err := tryLockFile(file); err != nil {
+		return errors.Is(err, errWouldBlock)
+	}
+	unlockFile(file)
+	return false
+}
+
+// lockRoots takes the cleaning locks of all roots, or none of them when one
+// is held elsewhere. Other errors leave the roots they happened for
+// unlocked; the first is returned with the locks taken, for the UI to clean
+// without them.
+func lockRoots(roots []string) ([]*rootLock, error) {
+	var locks []*rootLock
+	var firstErr error
+	for _, root := range roots {
+		lock, err := lockRoot(root)
+		var locked *lockedError
+		if errors.As(err, &locked) {
+			unlockAll(locks)
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if lock != nil {
+			locks = append(locks, lock)
+		}
+	}
+	return locks, firstErr
+}
+
+func readLockOwner(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.SplitN(string(data), "\n", 2)[0])
+	return pid
+}
+
+func (l *rootLock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+	unlockFile(l.file)
+	return l.file.Close()
+}
+
+func unlockAll(locks []*rootLock) {
+	for _, l := range locks {
+		l.Unlock()
+	}
+}
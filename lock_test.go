@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLockRootContention(t *testing.T) {
+	t.Setenv("DEVTIDY_STATE_DIR", t.TempDir())
+	root := t.TempDir()
+
+	first, err := lockRoot(root)
+	if err != nil {
+		t.Fatalf("lockRoot: %v", err)
+	}
+	_, err = lockRoot(root)
+	var locked *lockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second lockRoot = %v, want a lockedError", err)
+	}
+	if locked.pid != os.Getpid() || !strings.Contains(err.Error(), "is cleaning "+root) {
+		t.Errorf("lockedError = %q, want it to name pid %d and %s", err, os.Getpid(), root)
+	}
+
+	// Another root isn't held up
+	other, err := lockRoot(t.TempDir())
+	if err != nil {
+		t.Errorf("lockRoot of another root: %v", err)
+	}
+	other.Unlock()
+
+	if err := first.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := lockRoot(root)
+	if err != nil {
+		t.Fatalf("lockRoot after unlocking: %v", err)
+	}
+	again.Unlock()
+}
+
+func TestLockDirIsShared(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DEVTIDY_STATE_DIR", dir)
+	lock, err := lockRoot(t.TempDir())
+	if err != nil {
+		t.Fatalf("lockRoot: %v", err)
+	}
+	defer lock.Unlock()
+
+	path := lock.file.Name()
+	if filepath.Dir(path) != filepath.Join(dir, "locks") {
+		t.Errorf("lock file = %s, want it in %s", path, filepath.Join(dir, "locks"))
+	}
+	for _, p := range []string{path, path + ".root"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != sharedFileMode {
+			t.Errorf("%s has mode %v, want %v so the other users can lock it", p, info.Mode().Perm(), sharedFileMode)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// fsPath returns the path to hand to the operating system. Unix paths are
+// used as they are.
+func fsPath(path string) string {
+	return path
+}
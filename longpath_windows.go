@@ -0,0 +1,22 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// fsPath turns an absolute path into an extended-length path so names longer
+// than MAX_PATH and names ending in spaces or dots, which Win32 would
+// otherwise normalize away, reach the filesystem unchanged.
+func fsPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) || !filepath.IsAbs(path) {
+		return path
+	}
+	path = filepath.Clean(path)
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + path[2:]
+	}
+	return `\\?\` + path
+}
@@ -1,67 +1,111 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
-	"sort"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
 )
 
 type CleanableItem struct {
-	Path     string
-	Type     string
-	Size     int64
-	Info     string
-	Selected bool
+	Path     string    `json:"path"`
+	Type     string    `json:"type"`
+	Pattern  string    `json:"pattern"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Info     string    `json:"info"`
+	Selected bool      `json:"-"`
+	Cleaned  bool      `json:"-"`
+	Pinned   bool      `json:"-"`
+	Kept     bool      `json:"-"` // deselected by hand, which R records as a keep rule
+	Note     string    `json:"note,omitempty"`
+	Broken   string    `json:"broken,omitempty"`  // why the artifact is unusable, if it is
+	Dormant  string    `json:"dormant,omitempty"` // how long its project has been idle, with --dormant
+	Sources  []string  `json:"sources,omitempty"` // what found it, with --with-gitignore
+	Root     string    `json:"root,omitempty"`    // the directory it was found under, when several were scanned
 }
 
 func (i CleanableItem) Title() string {
+	path := displayPath(i.Path)
+	if i.Pinned {
+		path = symbols.pin + " " + path
+	}
+	if i.Cleaned {
+		return cleanedStyle.Render(symbols.cleaned + " " + path)
+	}
 	if i.Selected {
-		return selectedStyle.Render("✓ " + i.Path)
+		return selectedStyle.Render(symbols.check + " " + path)
 	}
-	return i.Path
+	if i.Pinned {
+		return pinnedStyle.Render(path)
+	}
+	return path
 }
 
 func (i CleanableItem) Description() string {
 	desc := fmt.Sprintf("%s - %s", i.Type, formatSize(i.Size))
+	if i.Broken != "" {
+		desc += " • broken, safe to clean: " + i.Broken
+	}
+	if i.Dormant != "" {
+		desc += " • safe to clean — project looks dormant, no source changes for " + i.Dormant
+	}
+	if len(i.Sources) > 0 {
+		desc += " • " + sourceLabel(i.Sources)
+	}
+	if i.Note != "" {
+		desc += " • " + i.Note
+	}
+	if i.Cleaned {
+		return cleanedStyle.Render(desc)
+	}
 	if i.Selected {
 		return selectedStyle.Render(desc)
 	}
 	return desc
 }
 
-func (i CleanableItem) FilterValue() string { return i.Path }
+func (i CleanableItem) FilterValue() string { return displayPath(i.Path) }
 
 type state int
 
 const (
 	stateScanning state = iota
 	stateSelecting
-	stateCleaning
-	stateComplete
+	stateIssues
+	stateCleanReport
+	statePreview
+	stateOnboarding
+	statePicking
 )
 
-type scanCompleteMsg []CleanableItem
-type cleanCompleteMsg struct{}
-type cleanProgressMsg struct {
-	item  string
-	done  int
-	total int
+type scanCompleteMsg struct {
+	stream *scanStream
+	items  []CleanableItem
+	issues []Issue
+	// stopped is set when the scan was cancelled before it was done
+	stopped bool
 }
+type cleanCompleteMsg struct{}
 type sizeUpdateMsg struct {
 	path string
 	size int64
@@ -70,34 +114,153 @@ type allSizesCompleteMsg struct {
 	items []CleanableItem
 }
 
+// scanOptions controls how the target directory is walked
+type scanOptions struct {
+	useGitignore bool
+	// withGitignore adds the gitignore scan to the pattern scan
+	withGitignore bool
+	// selectExpr preselects matching items once the scan completes
+	selectExpr queryExpr
+	// verifySample is how many cleaned items get their freed bytes measured
+	verifySample int
+	// snapshot replaces the scan with saved results
+	snapshot *scanRecord
+	// planPath makes cleaning save the selection there instead of deleting
+	planPath string
+	// maxDepth limits how deep the walk goes; 0 means no limit
+	maxDepth int
+	// olderThan drops items with a file modified more recently than this
+	olderThan time.Duration
+	// dormant keeps only the items of projects whose sources are older than
+	// this
+	dormant time.Duration
+	// minSize drops items smaller than this many bytes once they are sized
+	minSize int64
+	// dryRun reports what cleaning would free instead of deleting
+	dryRun bool
+	// trash moves cleaned items to the trash instead of deleting them
+	trash bool
+	// archiveDir is where cleaned items are archived before being deleted;
+	// empty means they aren't
+	archiveDir string
+	// exclude lists paths and globs never scanned below this root, in
+	// addition to those of the config
+	exclude []string
+	// ctx stops the scan early when cancelled; nil never does
+	ctx context.Context
+	// stream receives the items of the pattern walk as they are found
+	stream *scanStream
+	// progress counts the directories the walk reads
+	progress *scanProgress
+	// skipToolCaches leaves out the global caches of the opt-in groups,
+	// already listed for another root
+	skipToolCaches bool
+	// given holds the filters given as flags, which win over the settings
+	// remembered for a root
+	given rootSettings
+}
+
 // Model represents the application state
 type Model struct {
 	state             state
 	list              list.Model
-	items             []CleanableItem
+	items             itemSet
 	spinner           spinner.Model
 	progress          progress.Model
 	cleaning          bool
+	queue             *cleanQueue
+	stream            *scanStream // the scan in progress
+	partialScan       bool        // the scan was stopped early
+	locks             []*rootLock
 	totalSize         int64
 	cleanedSize       int64
+	trashedSize       int64 // moved to the trash, so not freed
+	cleanedCount      int
+	cleaned           []CleanableItem
+	rootFreed         int64    // cleaned or trashed under the current root
+	roots             []string // every root opened this session, in order
+	sessionStart      time.Time
+	openingRoot       bool         // the input line is typing a directory to open
+	confirmText       string       // the input line must hold this to start cleaning
+	baseOpts          scanOptions  // opts as given, before the settings of a root
+	rootSettings      rootSettings // remembered for the current root
+	picker            picker
+	checks            []sizeCheck
+	rootSize          int64 // -1 until measured
+	windowWidth       int
+	windowHeight      int
+	onboarding        bool // show the first-run introduction after the scan
+	dryRun            bool
+	trash             bool // move cleaned items to the trash
+	sortOrder         sortOrder
+	grouping          grouping
+	projects          map[string]string    // directory -> owning project, see projectOf
+	collapsed         map[string]bool      // groups whose items are hidden
+	groupSorts        map[string]sortOrder // groups sorted on their own
+	freeSpace         uint64
+	freeSpaceKnown    bool
 	currentDir        string
-	useGitignore      bool
+	targets           []string // the roots scanned together, currentDir first
+	opts              scanOptions
 	scanStartTime     time.Time
 	scanDuration      time.Duration
 	scannedItems      int
 	err               error
 	calculatingSizes  bool
-	pendingSizes      map[string]int64
+	unsized           map[string]bool // paths whose size isn't known yet
+	sizing            map[string]bool // paths being sized right now
+	recentlySelected  []string        // newest first, sized before the rest
 	totalSizeJobs     int
 	completedSizeJobs int
+	issues            []Issue
+	detailView        viewport.Model
+	statusMsg         string
+	previewPath       string
+	previews          map[string]previewMsg
+	preselect         queryExpr
+	pins              []string
+	notes             map[string]string // nil if the notes file is unreadable
+	notePath          string            // the path whose note is being edited
+	command           textinput.Model
+	commandActive     bool
+	visual            bool
+	visualAnchor      int
+	count             int
+	jumping           bool // the input line is typing a jump
+	jumpFrom          int  // list index the jump started from
 }
 
 // Key mappings
 var keys = struct {
-	toggle key.Binding
-	clean  key.Binding
-	quit   key.Binding
-	help   key.Binding
+	toggle      key.Binding
+	clean       key.Binding
+	quit        key.Binding
+	help        key.Binding
+	issues      key.Binding
+	export      key.Binding
+	back        key.Binding
+	preview     key.Binding
+	visual      key.Binding
+	count       key.Binding
+	pause       key.Binding
+	command     key.Binding
+	pin         key.Binding
+	note        key.Binding
+	project     key.Binding
+	trash       key.Binding
+	sort        key.Binding
+	group       key.Binding
+	collapseAll key.Binding
+	selectAll   key.Binding
+	selectNone  key.Binding
+	invert      key.Binding
+	dryRun      key.Binding
+	dismiss     key.Binding
+	jump        key.Binding
+	open        key.Binding
+	rules       key.Binding
+	explain     key.Binding
+	undo        key.Binding
 }{
 	toggle: key.NewBinding(
 		key.WithKeys(" "),
@@ -115,6 +278,106 @@ var keys = struct {
 		key.WithKeys("?"),
 		key.WithHelp("?", "help"),
 	),
+	issues: key.NewBinding(
+		key.WithKeys("e"),
+		key.WithHelp("e", "view skipped paths and errors"),
+	),
+	export: key.NewBinding(
+		key.WithKeys("x"),
+		key.WithHelp("x", "export issues to JSON"),
+	),
+	back: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "back"),
+	),
+	preview: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "preview contents"),
+	),
+	visual: key.NewBinding(
+		key.WithKeys("v"),
+		key.WithHelp("v", "visual mode"),
+	),
+	count: key.NewBinding(
+		key.WithKeys("0", "1", "2", "3", "4", "5", "6", "7", "8", "9"),
+		key.WithHelp("0-9", "count prefix"),
+	),
+	pause: key.NewBinding(
+		key.WithKeys("p"),
+		key.WithHelp("p", "pause/resume cleaning"),
+	),
+	command: key.NewBinding(
+		key.WithKeys(":"),
+		key.WithHelp(":", "select by expression"),
+	),
+	pin: key.NewBinding(
+		key.WithKeys("P"),
+		key.WithHelp("P", "pin/unpin path"),
+	),
+	note: key.NewBinding(
+		key.WithKeys("m"),
+		key.WithHelp("m", "annotate item"),
+	),
+	project: key.NewBinding(
+		key.WithKeys("M"),
+		key.WithHelp("M", "annotate project"),
+	),
+	trash: key.NewBinding(
+		key.WithKeys("t"),
+		key.WithHelp("t", "toggle moving to the trash"),
+	),
+	sort: key.NewBinding(
+		key.WithKeys("s"),
+		key.WithHelp("s", "cycle sort order"),
+	),
+	selectAll: key.NewBinding(
+		key.WithKeys("a"),
+		key.WithHelp("a", "select all"),
+	),
+	selectNone: key.NewBinding(
+		key.WithKeys("n"),
+		key.WithHelp("n", "deselect all"),
+	),
+	invert: key.NewBinding(
+		key.WithKeys("i"),
+		key.WithHelp("i", "invert selection"),
+	),
+	group: key.NewBinding(
+		key.WithKeys("o"),
+		key.WithHelp("o", "group by project or type"),
+	),
+	collapseAll: key.NewBinding(
+		key.WithKeys("z"),
+		key.WithHelp("z", "collapse/expand all groups"),
+	),
+	jump: key.NewBinding(
+		key.WithKeys("f"),
+		key.WithHelp("f", "jump to path"),
+	),
+	open: key.NewBinding(
+		key.WithKeys("O"),
+		key.WithHelp("O", "open another directory"),
+	),
+	rules: key.NewBinding(
+		key.WithKeys("R"),
+		key.WithHelp("R", "save the selection as rules"),
+	),
+	explain: key.NewBinding(
+		key.WithKeys("E"),
+		key.WithHelp("E", "explain what the item holds"),
+	),
+	undo: key.NewBinding(
+		key.WithKeys("u"),
+		key.WithHelp("u", "undo the last clean to the trash"),
+	),
+	dryRun: key.NewBinding(
+		key.WithKeys("d"),
+		key.WithHelp("d", "start in dry-run mode"),
+	),
+	dismiss: key.NewBinding(
+		key.WithKeys("n"),
+		key.WithHelp("n", "don't show again"),
+	),
 }
 
 // Styles
@@ -137,204 +400,452 @@ var (
 	successStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("42")).
 			Bold(true)
-)
 
-func initialModel(targetDir string, useGitignore bool) Model {
-	s := spinner.New()
-	s.Spinner = spinner.Dot
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	cleanedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("241")).
+			Strikethrough(true)
 
-	prog := progress.New(progress.WithDefaultGradient())
+	pinnedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214"))
+)
 
-	l := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
-	l.Title = "Cleanable Items"
-	l.SetShowStatusBar(false)
-	l.SetFilteringEnabled(true)
-	l.Styles.Title = titleStyle
+func initialModel(targetDirs []string, opts scanOptions) Model {
+	targetDir := targetDirs[0]
+	// Pins are a convenience, so an unreadable file just pins nothing
+	pins, _ := loadPins()
+	notes, _ := loadNotes()
 
-	return Model{
+	m := Model{
 		state:             stateScanning,
-		list:              l,
-		items:             []CleanableItem{},
-		spinner:           s,
-		progress:          prog,
+		list:              newList(),
+		items:             newItemSet(nil),
+		spinner:           newSpinner(),
+		progress:          newProgress(),
 		currentDir:        targetDir,
-		useGitignore:      useGitignore,
+		targets:           targetDirs,
+		opts:              opts,
 		scanStartTime:     time.Now(),
+		sessionStart:      time.Now(),
+		roots:             slices.Clone(targetDirs),
 		scannedItems:      0,
 		calculatingSizes:  false,
-		pendingSizes:      make(map[string]int64),
+		unsized:           make(map[string]bool),
+		sizing:            make(map[string]bool),
+		projects:          make(map[string]string),
+		collapsed:         make(map[string]bool),
+		groupSorts:        make(map[string]sortOrder),
 		totalSizeJobs:     0,
 		completedSizeJobs: 0,
+		detailView:        viewport.New(0, 0),
+		previews:          make(map[string]previewMsg),
+		preselect:         opts.selectExpr,
+		command:           textinput.New(),
+		pins:              pins,
+		notes:             notes,
+		rootSize:          -1,
+		onboarding:        opts.snapshot == nil && needsOnboarding(targetDir),
+		dryRun:            opts.dryRun,
+		trash:             opts.trash,
+		baseOpts:          opts,
+	}
+	if opts.snapshot == nil {
+		m.stream = newScanStream()
+		m = m.restoreRoot(targetDir)
 	}
+	return m
 }
 
 func (m Model) Init() tea.Cmd {
+	if m.state == statePicking {
+		return nil
+	}
+	if m.opts.snapshot != nil {
+		if m.opts.planPath != "" {
+			// The root may not even exist on this machine
+			return tea.Batch(m.spinner.Tick, loadSnapshot(m.opts.snapshot))
+		}
+		return tea.Batch(
+			m.spinner.Tick,
+			loadSnapshot(m.opts.snapshot),
+			measureRoot(m.targets...),
+			checkFreeSpace(m.currentDir),
+		)
+	}
 	return tea.Batch(
 		m.spinner.Tick,
-		scanForCleanableItems(m.currentDir, m.useGitignore),
+		scanForCleanableItems(m.stream, m.targets, m.opts),
+		measureRoot(m.targets...),
+		checkFreeSpace(m.currentDir),
 	)
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	if updated, ok := next.(Model); ok {
+		updated.fitList()
+		return updated, cmd
+	}
+	return next, cmd
+}
+
+// The list keeps at least this many rows however long its footer gets
+const minListHeight = 6
+
+// fitList gives the list whatever height the selection screen's footer leaves.
+func (m *Model) fitList() {
+	if m.windowHeight == 0 {
+		return
+	}
+	_, v := m.frame().GetFrameSize()
+	minHeight := minListHeight
+	if m.compact() {
+		minHeight = 1
+	}
+	height := max(m.windowHeight-v-lipgloss.Height(m.selectingFooter()), minHeight)
+	if height != m.list.Height() {
+		m.list.SetHeight(height)
+	}
+}
+
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
-		h, v := docStyle.GetFrameSize()
-		m.list.SetSize(msg.Width-h, msg.Height-v-3)
-		return m, nil
+		return m.resize(msg.Width, msg.Height), nil
 
 	case tea.KeyMsg:
 		switch m.state {
 		case stateScanning:
-			if key.Matches(msg, keys.quit) {
+			switch {
+			case key.Matches(msg, keys.quit):
 				return m, tea.Quit
+			case key.Matches(msg, keys.back):
+				return m.stopScan()
 			}
 		case stateSelecting:
+			if m.jumping {
+				return m.updateJump(msg)
+			}
+			if m.commandActive {
+				switch msg.Type {
+				case tea.KeyEsc:
+					return m.closeCommand(), nil
+				case tea.KeyEnter:
+					if m.notePath != "" {
+						return m.saveNote()
+					}
+					if m.openingRoot {
+						return m.submitRoot()
+					}
+					if m.confirmText != "" {
+						return m.submitConfirm()
+					}
+					return m.runCommand()
+				}
+				var cmd tea.Cmd
+				m.command, cmd = m.command.Update(msg)
+				return m, cmd
+			}
 			switch {
 			case key.Matches(msg, keys.quit):
 				return m, tea.Quit
 			case key.Matches(msg, keys.toggle):
 				if !m.cleaning {
-					return m.toggleSelection(), nil
+					return m.toggleSelection()
+				}
+			case key.Matches(msg, keys.visual):
+				if m.list.FilterState() != list.Filtering {
+					m.visual = !m.visual
+					m.visualAnchor = m.list.Index()
+					m.count = 0
+					return m, nil
+				}
+			case key.Matches(msg, keys.back) && m.visual:
+				m.visual = false
+				return m, nil
+			case key.Matches(msg, keys.back) && m.stream != nil && m.list.FilterState() == list.Unfiltered:
+				return m.stopScan()
+			case key.Matches(msg, keys.count):
+				digit := int(msg.String()[0] - '0')
+				if m.list.FilterState() != list.Filtering && (digit > 0 || m.count > 0) && m.count < 1000 {
+					m.count = m.count*10 + digit
+					return m, nil
 				}
 			case key.Matches(msg, keys.clean):
+				if !m.cleaning && m.selectionUnsized() {
+					m.statusMsg = errorStyle.Render("Some selected items are still being sized; try again in a moment")
+					return m, nil
+				}
 				if !m.cleaning {
 					return m.startCleaning()
 				}
+			case key.Matches(msg, keys.pause):
+				if m.cleaning {
+					return m.togglePause()
+				}
+			case key.Matches(msg, keys.command):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					return m.openCommand()
+				}
+			case key.Matches(msg, keys.jump):
+				if m.list.FilterState() != list.Filtering {
+					return m.openJump()
+				}
+			case key.Matches(msg, keys.open):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					return m.openRootPrompt()
+				}
+			case key.Matches(msg, keys.rules):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					return m.exportRules(), nil
+				}
+			case key.Matches(msg, keys.explain):
+				if m.list.FilterState() != list.Filtering {
+					return m.explain()
+				}
+			case key.Matches(msg, keys.undo):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					return m.undo()
+				}
+			case key.Matches(msg, keys.pin):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					return m.togglePin()
+				}
+			case key.Matches(msg, keys.note), key.Matches(msg, keys.project):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					return m.openNote(key.Matches(msg, keys.project))
+				}
+			case key.Matches(msg, keys.trash):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					m.trash = !m.trash
+					return m, nil
+				}
+			case key.Matches(msg, keys.sort):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					if h, ok := m.list.SelectedItem().(groupHeader); ok {
+						return m.cycleGroupSort(h)
+					}
+					return m.cycleSort()
+				}
+			case key.Matches(msg, keys.collapseAll):
+				if m.list.FilterState() != list.Filtering && m.grouping != groupNone {
+					return m.toggleAllCollapsed()
+				}
+			case key.Matches(msg, keys.selectAll), key.Matches(msg, keys.selectNone), key.Matches(msg, keys.invert):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					switch {
+					case key.Matches(msg, keys.selectAll):
+						return m.selectVisible(func(CleanableItem) bool { return true })
+					case key.Matches(msg, keys.selectNone):
+						return m.selectVisible(func(CleanableItem) bool { return false })
+					}
+					return m.selectVisible(func(item CleanableItem) bool { return !item.Selected })
+				}
+			case key.Matches(msg, keys.group):
+				if m.list.FilterState() != list.Filtering && !m.cleaning {
+					return m.cycleGrouping()
+				}
+			case key.Matches(msg, keys.issues):
+				if m.list.FilterState() != list.Filtering {
+					return m.showIssues(), nil
+				}
+			case key.Matches(msg, keys.preview):
+				if m.list.FilterState() != list.Filtering {
+					return m.showPreview()
+				}
+			}
+			m.count = 0
+		case stateIssues:
+			switch {
+			case key.Matches(msg, keys.quit):
+				return m, tea.Quit
+			case key.Matches(msg, keys.back), key.Matches(msg, keys.issues):
+				m.state = stateSelecting
+				m.statusMsg = ""
+				return m, nil
+			case key.Matches(msg, keys.export):
+				return m.exportIssues(), nil
+			}
+			var cmd tea.Cmd
+			m.detailView, cmd = m.detailView.Update(msg)
+			return m, cmd
+		case stateCleanReport:
+			switch {
+			case key.Matches(msg, keys.quit):
+				return m, tea.Quit
+			case key.Matches(msg, keys.back), key.Matches(msg, keys.preview):
+				m.state = stateSelecting
+				return m, nil
+			case key.Matches(msg, keys.issues):
+				return m.showIssues(), nil
 			}
-		case stateCleaning:
-			if key.Matches(msg, keys.quit) {
+			var cmd tea.Cmd
+			m.detailView, cmd = m.detailView.Update(msg)
+			return m, cmd
+		case statePicking:
+			return m.updatePicker(msg)
+		case stateOnboarding:
+			switch {
+			case key.Matches(msg, keys.quit):
 				return m, tea.Quit
+			case key.Matches(msg, keys.preview):
+				return m.finishOnboarding(false, false), nil
+			case key.Matches(msg, keys.dryRun):
+				return m.finishOnboarding(true, false), nil
+			case key.Matches(msg, keys.dismiss):
+				return m.finishOnboarding(false, true), nil
 			}
-		case stateComplete:
-			if key.Matches(msg, keys.quit) {
+		case statePreview:
+			switch {
+			case key.Matches(msg, keys.quit):
 				return m, tea.Quit
+			case key.Matches(msg, keys.back), key.Matches(msg, keys.preview):
+				m.state = stateSelecting
+				return m, nil
 			}
+			var cmd tea.Cmd
+			m.detailView, cmd = m.detailView.Update(msg)
+			return m, cmd
 		}
 
-	case scanCompleteMsg:
-		m.items = []CleanableItem(msg)
-		m.scannedItems = len(m.items)
-		m.scanDuration = time.Since(m.scanStartTime)
+	case rootSizeMsg:
+		if msg.root == m.currentDir {
+			m.rootSize = msg.size
+		}
+		return m, nil
 
-		// Start calculating sizes for all items
-		m.calculatingSizes = true
-		m.totalSizeJobs = 0
-		m.completedSizeJobs = 0
-		for _, item := range m.items {
-			if item.Size == 0 {
-				m.totalSizeJobs++
-			}
+	case freeSpaceMsg:
+		if msg.root == m.currentDir {
+			m.freeSpace, m.freeSpaceKnown = msg.free, msg.ok
 		}
+		return m, nil
 
-		if m.totalSizeJobs == 0 {
-			// No sizes to calculate, go straight to selecting
-			m.state = stateSelecting
-			listItems := make([]list.Item, len(m.items))
-			for i, item := range m.items {
-				listItems[i] = item
-			}
-			m.list.SetItems(listItems)
+	case scanFoundMsg:
+		if msg.stream != m.stream {
 			return m, nil
 		}
+		return m.addFound(msg.items)
 
-		return m, calculateSizesAsyncBatch(m.items)
-
-	case cleanProgressMsg:
-		cmd := m.progress.SetPercent(float64(msg.done) / float64(msg.total))
-		return m, cmd
+	case scanCompleteMsg:
+		if msg.stream != m.stream {
+			// A scan of a root that was left in the meantime
+			return m, nil
+		}
+		m.stream = nil
+		current, _ := m.list.SelectedItem().(CleanableItem)
+		m.items = newItemSet(m.mergeScan(msg.items))
+		m.items.Sort(m.sortOrder)
+		m.issues = append(m.issues, msg.issues...)
+		m.scannedItems = m.items.Len()
+		m.scanDuration = time.Since(m.scanStartTime)
 
-	case cleanSingleItem:
-		if msg.index >= len(msg.items) {
-			return m, func() tea.Msg { return cleanCompleteMsg{} }
+		if m.opts.minSize > 0 {
+			m.items.RemoveWhere(func(item CleanableItem) bool {
+				return item.Size != 0 && item.Size < m.opts.minSize
+			})
 		}
 
-		item := msg.items[msg.index]
+		// Sizes are calculated while the list is on screen
+		for _, item := range m.items.All() {
+			if item.Size == 0 && !item.Cleaned && !m.unsized[item.Path] {
+				m.unsized[item.Path] = true
+				m.totalSizeJobs++
+			}
+		}
+		m.calculatingSizes = m.completedSizeJobs < m.totalSizeJobs
+		if msg.stopped {
+			m.partialScan = true
+			m.statusMsg = fmt.Sprintf("Scan stopped early; listing the %d items found until then", m.items.Len())
+		}
+		m, cmd := m.finishScan()
+		m.selectPath(current.Path)
+		return m, cmd
 
-		// Clean the item and update cleaned size
-		if err := os.RemoveAll(item.Path); err == nil {
-			m.cleanedSize += item.Size
+	case explainMsg:
+		return m.showExplanation(msg)
 
-			// Remove the cleaned item from the model's items list
-			for i, modelItem := range m.items {
-				if modelItem.Path == item.Path {
-					m.items = append(m.items[:i], m.items[i+1:]...)
-					break
-				}
-			}
+	case undoMsg:
+		return m.finishUndo(msg)
 
-			// Update the list display
-			listItems := make([]list.Item, len(m.items))
-			for i, modelItem := range m.items {
-				listItems[i] = modelItem
-			}
-			m.list.SetItems(listItems)
+	case previewMsg:
+		m.previews[msg.path] = msg
+		if m.state == statePreview && m.previewPath == msg.path {
+			m.detailView.SetContent(renderPreview(msg))
 		}
+		return m, nil
 
-		// Send progress update
-		progressCmd := func() tea.Msg {
-			return cleanProgressMsg{
-				item:  item.Path,
-				done:  msg.index + 1,
-				total: msg.total,
-			}
-		}
+	case progress.FrameMsg:
+		progressModel, cmd := m.progress.Update(msg)
+		m.progress = progressModel.(progress.Model)
+		return m, cmd
 
-		// Continue with next item or complete
-		var nextCmd tea.Cmd
-		if msg.index+1 < len(msg.items) {
-			nextCmd = tea.Tick(time.Millisecond*100, func(time.Time) tea.Msg {
-				return cleanSingleItem{
-					items: msg.items,
-					index: msg.index + 1,
-					total: msg.total,
-				}
-			})
-		} else {
-			nextCmd = func() tea.Msg { return cleanCompleteMsg{} }
-		}
+	case cleanResultMsg:
+		return m.finishQueuedItem(msg)
 
-		return m, tea.Batch(progressCmd, nextCmd)
+	case cleanTickMsg:
+		return m.tickLargeItem()
 
 	case cleanCompleteMsg:
+		if s := m.queue.span; s != nil {
+			s.set("devtidy.failures", m.queue.count(queueFailed))
+			s.recordFreeSpace("devtidy.free_after", m.currentDir)
+			s.finish()
+		}
 		m.state = stateSelecting
+		if err := saveUndo(m.currentDir, m.queue.trashed); err != nil {
+			m.statusMsg = errorStyle.Render("Couldn't record the clean for undo: " + err.Error())
+		}
+		var trashCmd tea.Cmd
+		if len(m.queue.trashed) > 0 {
+			trashCmd = recordTrashedCmd(m.queue.trashed)
+		}
+		if failures := m.queue.failures; len(failures) > 0 {
+			m = m.showCleanReport(m.queue, failures)
+		}
+		var cleaned []CleanableItem
+		for _, item := range m.items.All() {
+			if item.Cleaned {
+				cleaned = append(cleaned, item)
+			}
+		}
+		indexCmd := indexCleanedCmd(cleaned, cleanMethod(m.queue.trash, m.queue.archive))
 		m.cleaning = false
-		m.scannedItems = len(m.items) // Update total items count
+		m.queue = nil
+		unlockAll(m.locks)
+		m.locks = nil
+
+		// Drop every cleaned item in one step
+		m.items.RemoveWhere(func(item CleanableItem) bool { return item.Cleaned })
+		m.scannedItems = m.items.Len() // Update total items count
+		return m, tea.Batch(m.refreshList(), checkFreeSpace(m.currentDir), trashCmd, indexCmd)
+
+	case trashRecordedMsg:
+		if msg.err != nil {
+			m.statusMsg = errorStyle.Render("Couldn't record what was moved to the trash: " + msg.err.Error())
+		} else if note := trashPurgeNote(msg.purged); note != "" {
+			m.statusMsg = note
+		}
 		return m, nil
 
 	case sizeUpdateMsg:
-		if m.calculatingSizes {
-			// Store the size update
-			m.pendingSizes[msg.path] = msg.size
-			m.completedSizeJobs++
-
-			// Check if all sizes are calculated
-			if m.completedSizeJobs >= m.totalSizeJobs {
-				// Apply all size updates
-				for i, item := range m.items {
-					if size, exists := m.pendingSizes[item.Path]; exists {
-						m.items[i].Size = size
-					}
-				}
-
-				sort.Slice(m.items, func(i, j int) bool {
-					return m.items[i].Size > m.items[j].Size
-				})
-
-				// show final sorted list
-				m.state = stateSelecting
-				m.calculatingSizes = false
-				listItems := make([]list.Item, len(m.items))
-				for j, modelItem := range m.items {
-					listItems[j] = modelItem
-				}
-				m.list.SetItems(listItems)
-			}
+		if !m.sizing[msg.path] {
+			return m, nil
 		}
-		return m, nil
+		delete(m.sizing, msg.path)
+		delete(m.unsized, msg.path)
+		if msg.size < m.opts.minSize {
+			m.items.RemoveWhere(func(item CleanableItem) bool { return item.Path == msg.path })
+			m.scannedItems = m.items.Len()
+		} else {
+			m.items.Update(msg.path, func(item *CleanableItem) { item.Size = msg.size })
+		}
+		m.completedSizeJobs++
+		if m.completedSizeJobs < m.totalSizeJobs || m.stream != nil {
+			return m, tea.Batch(m.refreshList(), m.nextSizeJobs())
+		}
+		return m.finishSizing()
 
 	case spinner.TickMsg:
-		if m.state == stateScanning || m.calculatingSizes {
+		if m.state == stateScanning || m.stream != nil {
 			var cmd tea.Cmd
 			m.spinner, cmd = m.spinner.Update(msg)
 			return m, cmd
@@ -354,170 +865,611 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m Model) View() string {
 	switch m.state {
 	case stateScanning:
-		elapsed := time.Since(m.scanStartTime)
-		if m.calculatingSizes {
-			return docStyle.Render(fmt.Sprintf(
-				"%s Calculating sizes...\n\nDirectory: %s\nScan time: %v\nItems found: %d\nSizes calculated: %d/%d",
-				m.spinner.View(),
-				m.currentDir,
-				m.scanDuration.Round(time.Millisecond),
-				m.scannedItems,
-				m.completedSizeJobs,
-				m.totalSizeJobs,
-			))
-		}
-		return docStyle.Render(fmt.Sprintf(
-			"%s Scanning for cleanable items...\n\nDirectory: %s\nElapsed: %v\nItems found: %d",
-			m.spinner.View(),
-			m.currentDir,
-			elapsed.Round(time.Millisecond),
-			m.scannedItems,
-		))
+		return m.scanningView()
 
 	case stateSelecting:
-		help := "\nControls:\n" +
-			"  space: toggle selection (✓ = selected)\n" +
-			"  c: clean selected items\n" +
-			"  q: quit\n" +
-			"  /: filter items"
-
-		totalSize := m.calculateTotalSelectedSize()
-		selectedCount := m.countSelectedItems()
-
-		status := fmt.Sprintf(
-			"\nScan time: %v (%d items) | Selected: %d items (%s)",
-			m.scanDuration.Round(time.Millisecond),
-			m.scannedItems,
-			selectedCount,
-			formatSize(totalSize),
-		)
-
-		content := m.list.View() + status
-
-		// Show progress bar if cleaning
-		if m.cleaning {
-			content += "\n\nCleaning in progress...\n" + m.progress.View()
+		m.list.Title = "Cleanable Items " + symbols.bullet + " " + m.rootSummary()
+		if m.opts.planPath != "" {
+			m.list.Title = fmt.Sprintf("Snapshot from %s %s c saves a plan", m.opts.snapshot.Host, symbols.bullet)
 		}
+		return m.frame().Render(m.list.View() + m.selectingFooter())
 
-		content += help
+	case stateOnboarding:
+		return m.onboardingView()
 
-		return docStyle.Render(content)
+	case statePicking:
+		return m.pickerView()
 
-	case stateCleaning:
-		return docStyle.Render(fmt.Sprintf(
-			"Cleaning selected items...\n\n%s\n\nPress q to quit",
-			m.progress.View(),
-		))
+	case stateIssues:
+		header := titleStyle.Render("Skipped Paths & Errors")
+		footer := fmt.Sprintf("\nesc: back %[1]s x: export to JSON %[1]s q: quit", symbols.bullet)
+		if m.statusMsg != "" {
+			footer = "\n" + m.statusMsg + footer
+		}
+		return docStyle.Render(header + "\n\n" + m.detailView.View() + footer)
+
+	case stateCleanReport:
+		header := titleStyle.Render("Cleaning Finished With Errors")
+		footer := fmt.Sprintf("\nesc: back to the list %[1]s e: all issues %[1]s q: quit", symbols.bullet)
+		return docStyle.Render(header + "\n\n" + m.detailView.View() + footer)
 
-	case stateComplete:
-		return docStyle.Render(successStyle.Render(
-			fmt.Sprintf(
-				"✓ Cleaning complete!\n\nCleaned: %s\n\nPress q to quit",
-				formatSize(m.cleanedSize),
-			),
-		))
+	case statePreview:
+		header := titleStyle.Render(displayPath(m.previewPath))
+		footer := fmt.Sprintf("\nesc: back %s q: quit", symbols.bullet)
+		return docStyle.Render(header + "\n\n" + m.detailView.View() + footer)
 	}
 
 	return ""
 }
 
-func (m Model) toggleSelection() Model {
-	if selectedItem, ok := m.list.SelectedItem().(CleanableItem); ok {
-		// Find the item in our slice and toggle it
-		for i, item := range m.items {
-			if item.Path == selectedItem.Path {
-				m.items[i].Selected = !m.items[i].Selected
+// selectingFooter renders everything below the list on the selection screen.
+func (m Model) selectingFooter() string {
+	if m.compact() {
+		return m.compactFooter()
+	}
+	help := "\nControls:\n" +
+		"  space: toggle selection (" + symbols.check + " = selected)\n" +
+		"  v: visual mode (move, then space to toggle the range)\n" +
+		"  [count] space: toggle the next count items\n" +
+		"  a / n / i: select all / none / invert (the filtered items when filtering)\n" +
+		"  c: clean selected items\n" +
+		"  p: pause/resume cleaning\n" +
+		"  enter: preview contents\n" +
+		"  :expr: select items matching an expression\n" +
+		"  f: jump to the next item whose path contains the typed text\n" +
+		"  O: open another directory, keeping the session total\n" +
+		"  P: pin/unpin path (" + symbols.pin + " = always listed first)\n" +
+		"  R: save the selection as rules in .devtidy.toml\n" +
+		"  E: explain what the item holds\n" +
+		"  u: undo the last clean, when it moved items to the trash\n" +
+		"  m/M: annotate the item/its project\n" +
+		"  t: toggle moving to the trash instead of deleting\n" +
+		"  s: sort by size, path, type or last modified (on a header, just its group)\n" +
+		"  o: group by project or type (enter collapses, space selects the group)\n" +
+		"  z: collapse or expand all groups\n" +
+		"  e: view skipped paths and errors\n" +
+		"  esc: stop a scan that is still going on, keeping what it found\n" +
+		"  q: quit\n" +
+		"  /: filter items"
+
+	totalSize := m.calculateTotalSelectedSize()
+	selectedCount := m.countSelectedItems()
+
+	status := fmt.Sprintf(
+		"\nScan time: %v (%d items) | Selected: %d items (%s)",
+		m.scanDuration.Round(time.Millisecond),
+		m.scannedItems,
+		selectedCount,
+		formatSize(totalSize),
+	)
+	if m.stream != nil {
+		status = fmt.Sprintf("\n%s | Selected: %d items (%s)", m.scanningStatus(), selectedCount, formatSize(totalSize))
+	}
+	if m.calculatingSizes {
+		status += fmt.Sprintf(" | Sizing: %d/%d", m.completedSizeJobs, m.totalSizeJobs)
+	}
+	status += " | Sort: " + m.sortOrder.String()
+	if m.grouping != groupNone {
+		status += " | Group: " + m.grouping.String()
+	}
+	if len(m.issues) > 0 {
+		status += fmt.Sprintf(" | Issues: %d", len(m.issues))
+	}
+	if readOnly {
+		status += " | READ-ONLY"
+	} else if m.dryRun {
+		status += " | DRY RUN"
+	} else if m.trash {
+		status += " | TRASH"
+	} else if m.opts.archiveDir != "" {
+		status += " | ARCHIVE"
+	}
+	if m.visual {
+		lo, hi := min(m.visualAnchor, m.list.Index()), max(m.visualAnchor, m.list.Index())
+		status += fmt.Sprintf(" | -- VISUAL -- %d items", hi-lo+1)
+	} else if m.count > 0 {
+		status += fmt.Sprintf(" | %d", m.count)
+	}
 
-				// Update the list item
-				listItems := make([]list.Item, len(m.items))
-				for j, item := range m.items {
-					listItems[j] = item
-				}
-				m.list.SetItems(listItems)
-				break
-			}
+	content := ""
+	if m.cleanedCount > 0 || countIssues(m.issues, phaseClean) > 0 {
+		content += "\n" + successStyle.Render(m.sessionSummary())
+	}
+	if len(m.checks) > 0 {
+		style := successStyle
+		if countMismatches(m.checks) > 0 {
+			style = errorStyle
 		}
+		content += "\n" + style.Render(verifySummary(m.checks))
 	}
-	return m
+	content += status
+	if m.commandActive {
+		content += "\n" + m.command.View()
+	} else if m.statusMsg != "" {
+		content += "\n" + m.statusMsg
+	}
+
+	// Show the clean queue while cleaning
+	if m.cleaning {
+		content += "\n\n" + m.queueView()
+	}
+
+	content += help
+	return content
 }
 
-func (m Model) startCleaning() (Model, tea.Cmd) {
-	if m.countSelectedItems() == 0 {
+// toggleSelection toggles the item under the cursor, the visual mode range,
+// or the next count items when a count prefix was typed.
+func (m Model) toggleSelection() (Model, tea.Cmd) {
+	from, to := m.list.Index(), m.list.Index()
+	count := m.count
+	switch {
+	case m.visual:
+		from = m.visualAnchor
+		m.visual = false
+	case count > 0:
+		to = from + count - 1
+	}
+	m.count = 0
+
+	m, cmd := m.toggleRange(from, to)
+	if visible := len(m.list.VisibleItems()); count > 0 && visible > 0 {
+		m.list.Select(min(to+1, visible-1))
+	}
+	return m, cmd
+}
+
+// toggleRange toggles the visible items between from and to inclusive. If any
+// of them is unselected they all become selected, otherwise all are deselected.
+func (m Model) toggleRange(from, to int) (Model, tea.Cmd) {
+	visible := m.list.VisibleItems()
+	if from > to {
+		from, to = to, from
+	}
+	from = max(from, 0)
+	to = min(to, len(visible)-1)
+	if from > to {
 		return m, nil
 	}
 
-	m.cleaning = true
+	paths := make(map[string]bool)
+	selectAll := false
+	for _, listItem := range visible[from : to+1] {
+		switch it := listItem.(type) {
+		case CleanableItem:
+			paths[it.Path] = true
+			if !it.Selected {
+				selectAll = true
+			}
+		case groupHeader:
+			for _, path := range m.groupItems(it) {
+				paths[path] = true
+			}
+			if it.selected < it.items {
+				selectAll = true
+			}
+		}
+	}
 
-	return m, cleanSelectedItems(m.items)
+	for path := range paths {
+		m.items.Update(path, func(item *CleanableItem) {
+			item.Selected = selectAll
+			item.Kept = !selectAll
+		})
+		if selectAll {
+			m.noteSelected(path)
+		}
+	}
+	return m, tea.Batch(m.refreshList(), m.nextSizeJobs())
 }
 
-func (m Model) calculateTotalSelectedSize() int64 {
-	var total int64
-	for _, item := range m.items {
-		if item.Selected {
-			total += item.Size
+// selectVisible sets the selection of every visible item, including those in
+// collapsed groups, to what choose returns for it.
+func (m Model) selectVisible(choose func(CleanableItem) bool) (Model, tea.Cmd) {
+	var paths []string
+	for _, listItem := range m.list.VisibleItems() {
+		switch it := listItem.(type) {
+		case CleanableItem:
+			paths = append(paths, it.Path)
+		case groupHeader:
+			paths = append(paths, m.groupItems(it)...)
 		}
 	}
-	return total
+	for _, path := range paths {
+		item, ok := m.items.Get(path)
+		if !ok {
+			continue
+		}
+		selected := choose(item)
+		m.items.SetSelected(path, selected)
+		if selected && !item.Selected {
+			m.noteSelected(path)
+		}
+	}
+	m.visual = false
+	m.count = 0
+	return m, tea.Batch(m.refreshList(), m.nextSizeJobs())
 }
 
-func (m Model) countSelectedItems() int {
-	count := 0
-	for _, item := range m.items {
-		if item.Selected {
-			count++
+// refreshList pushes the current items into the list model.
+func (m *Model) refreshList() tea.Cmd {
+	if m.grouping != groupNone {
+		return m.list.SetItems(m.groupedListItems())
+	}
+	return m.list.SetItems(m.items.listItems())
+}
+
+// selectPath moves the cursor to the item or group header at path, unless
+// the list is filtered.
+func (m *Model) selectPath(path string) {
+	if m.list.FilterState() != list.Unfiltered {
+		return
+	}
+	for i, listItem := range m.list.Items() {
+		switch it := listItem.(type) {
+		case CleanableItem:
+			if it.Path == path {
+				m.list.Select(i)
+				return
+			}
+		case groupHeader:
+			if it.key == path {
+				m.list.Select(i)
+				return
+			}
 		}
 	}
-	return count
 }
 
-type scanJob struct {
-	root string
-	info os.FileInfo
+// togglePin pins the path under the cursor, or unpins it, and saves the pins
+// file. Paths pinned by a glob must be unpinned by editing the file.
+func (m Model) togglePin() (Model, tea.Cmd) {
+	selectedItem, ok := m.list.SelectedItem().(CleanableItem)
+	if !ok {
+		return m, nil
+	}
+
+	pin, pinned := matchPath(m.pins, selectedItem.Path)
+	if pinned && pin != selectedItem.Path {
+		m.statusMsg = errorStyle.Render(fmt.Sprintf("Pinned by pattern %q; edit the pins file to remove it", pin))
+		return m, nil
+	}
+	pins, err := updatePins(selectedItem.Path, !pinned)
+	if err != nil {
+		m.statusMsg = errorStyle.Render("Could not save pins: " + err.Error())
+		return m, nil
+	}
+	m.pins = pins
+	m.statusMsg = ""
+
+	m.items.ApplyPins(m.pins)
+	cmd := m.refreshList()
+	m.selectPath(selectedItem.Path)
+	return m, cmd
 }
 
-func boundedWalk(root string, maxWorkers int) <-chan scanJob {
-	if maxWorkers <= 0 {
-		maxWorkers = runtime.NumCPU()
+// finishScan shows the results and starts sizing the unsized items.
+func (m Model) finishScan() (Model, tea.Cmd) {
+	if m.state == stateScanning {
+		m.state = stateSelecting
+	}
+	m.items.ApplyPins(m.pins)
+	m.items.ApplyNotes(m.notes)
+	if m.opts.snapshot == nil {
+		// Only offered by the picker, so losing it is harmless
+		for _, root := range m.targets {
+			rememberRecentRoot(root)
+		}
 	}
+	if m.onboarding {
+		m.onboarding = false
+		m.state = stateOnboarding
+	}
+	if !m.calculatingSizes {
+		return m.finishSizing()
+	}
+	return m, tea.Batch(m.refreshList(), m.nextSizeJobs())
+}
 
-	out := make(chan scanJob, maxWorkers*2)
-	go func() {
-		defer close(out)
+// cycleSort switches to the next sort order, keeping the cursor on the same
+// item.
+func (m Model) cycleSort() (Model, tea.Cmd) {
+	m.sortOrder = m.sortOrder.next()
+	current, _ := m.list.SelectedItem().(CleanableItem)
+	m.items.Sort(m.sortOrder)
+	cmd := m.refreshList()
+	m.selectPath(current.Path)
+	return m, cmd
+}
 
-		// work queue
-		work := []string{root}
-		var mu sync.Mutex
-		var wg sync.WaitGroup
+// finishSizing sorts the sized results, keeping the cursor on the same item,
+// and applies any --select expression, which may depend on sizes.
+func (m Model) finishSizing() (Model, tea.Cmd) {
+	m.calculatingSizes = false
+	current, _ := m.list.SelectedItem().(CleanableItem)
+	m.items.ApplyPins(m.pins)
+	m.items.Sort(m.sortOrder)
+	preselect := m.preselect
+	for _, root := range m.targets {
+		// Rules that don't parse were reported by the scan
+		rules, _ := loadRepoRules(root)
+		preselect = rules.preselect(root, preselect)
+	}
+	if preselect != nil {
+		m.items.SelectWhere(preselect)
+	}
+	cmd := m.refreshList()
+	m.selectPath(current.Path)
+	// A stopped scan would pass for the whole root in later comparisons
+	if m.opts.snapshot != nil || m.partialScan {
+		return m, cmd
+	}
+	cmds := []tea.Cmd{cmd}
+	for _, root := range m.targets {
+		cmds = append(cmds, saveLastScan(root, itemsOf(root, m.targets, m.items.All())))
+	}
+	return m, tea.Batch(cmds...)
+}
 
-		// worker function
-		worker := func() {
-			defer wg.Done()
-			for {
-				mu.Lock()
-				if len(work) == 0 {
-					mu.Unlock()
-					return
-				}
-				dir := work[len(work)-1]
-				work = work[:len(work)-1]
-				mu.Unlock()
+func (m Model) openCommand() (Model, tea.Cmd) {
+	m.commandActive = true
+	m.statusMsg = ""
+	m.command.Prompt = ":"
+	m.command.Placeholder = "type=node_modules and size>1GB"
+	m.command.SetValue("")
+	return m, m.command.Focus()
+}
 
-				entries, err := os.ReadDir(dir)
-				if err != nil {
-					continue
-				}
+// closeCommand hides the input line, keeping the typed value for the caller.
+func (m Model) closeCommand() Model {
+	m.commandActive = false
+	m.notePath = ""
+	m.openingRoot = false
+	m.confirmText = ""
+	m.command.Blur()
+	return m
+}
+
+// runCommand selects exactly the items matching the typed expression.
+func (m Model) runCommand() (Model, tea.Cmd) {
+	m = m.closeCommand()
+
+	expr, err := parseQuery(m.command.Value())
+	if err != nil {
+		m.statusMsg = errorStyle.Render("Invalid expression: " + err.Error())
+		return m, nil
+	}
+	n := m.items.SelectWhere(expr)
+	m.statusMsg = successStyle.Render(fmt.Sprintf("Selected %d matching items", n))
+	return m, m.refreshList()
+}
+
+func (m Model) showIssues() Model {
+	m.state = stateIssues
+	m.statusMsg = ""
+	m.detailView.SetContent(renderIssues(m.issues))
+	m.detailView.GotoTop()
+	return m
+}
+
+func (m Model) showPreview() (Model, tea.Cmd) {
+	if h, ok := m.list.SelectedItem().(groupHeader); ok {
+		return m.toggleCollapsed(h)
+	}
+	selectedItem, ok := m.list.SelectedItem().(CleanableItem)
+	if !ok {
+		return m, nil
+	}
+
+	m.state = statePreview
+	m.previewPath = selectedItem.Path
+	m.detailView.GotoTop()
+	if preview, cached := m.previews[selectedItem.Path]; cached {
+		m.detailView.SetContent(renderPreview(preview))
+		return m, nil
+	}
+	m.detailView.SetContent("Loading contents...")
+	if selectedItem.Pattern == archivePattern {
+		return m, loadArchiveListing(selectedItem.Path)
+	}
+	if isDockerPath(selectedItem.Path) {
+		return m, loadDockerListing(selectedItem.Path)
+	}
+	if selectedItem.Pattern == homebrewPattern {
+		return m, loadHomebrewListing(selectedItem.Path)
+	}
+	return m, loadPreview(selectedItem.Path)
+}
+
+func (m Model) exportIssues() Model {
+	dir, err := os.Getwd()
+	if err != nil {
+		dir = m.currentDir
+	}
+	path, err := exportIssues(dir, m.issues)
+	if err != nil {
+		m.statusMsg = errorStyle.Render("Export failed: " + err.Error())
+	} else {
+		m.statusMsg = successStyle.Render("Exported to " + path)
+	}
+	return m
+}
+
+func (m Model) startCleaning() (Model, tea.Cmd) {
+	if m.countSelectedItems() == 0 {
+		return m, nil
+	}
+	if m.opts.planPath != "" {
+		return m.savePlan(), nil
+	}
+	if m.dryRun || readOnly {
+		mode := "Dry run"
+		if readOnly {
+			mode = "Read-only"
+		}
+		m.statusMsg = successStyle.Render(fmt.Sprintf(
+			"%s: would free %s from %d items; nothing was deleted",
+			mode, formatSize(m.items.SelectedSize()), m.items.SelectedCount()))
+		return m, nil
+	}
+	if err := activePolicy.allowClean(m.items.SelectedCount(), m.items.SelectedSize(), m.trash); err != nil {
+		m.statusMsg = errorStyle.Render(err.Error())
+		return m, nil
+	}
+	if !m.trash {
+		if text, reason, ok := softLimit(m.items.Selected()); ok {
+			return m.openConfirm(text, reason)
+		}
+	}
+	return m.beginCleaning()
+}
+
+// beginCleaning starts removing the selected items.
+func (m Model) beginCleaning() (Model, tea.Cmd) {
+	locks, err := lockRoots(m.targets)
+	var locked *lockedError
+	if errors.As(err, &locked) {
+		m.statusMsg = errorStyle.Render(locked.Error())
+		return m, nil
+	}
+	m.locks = locks
+
+	m.cleaning = true
+	m.statusMsg = ""
+	if err != nil {
+		// The lock directory is unusable. Someone is watching, so clean
+		// without coordinating but say so
+		m.statusMsg = errorStyle.Render("Cleaning without the cleaning lock: " + err.Error())
+	}
+	m.queue = newCleanQueue(m.items.Selected(), m.opts.verifySample, m.trash)
+	m.queue.scanned = m.scanStartTime
+	m.queue.archive = m.opts.archiveDir
+	m.queue.span = startSpan(nil, "clean", "devtidy.root", m.currentDir, "devtidy.items", len(m.queue.items), "devtidy.trash", m.trash)
+	m.queue.span.recordFreeSpace("devtidy.free_before", m.currentDir)
+	resetCmd := m.progress.SetPercent(0)
+
+	m, cmd := m.cleanNext()
+	return m, tea.Batch(resetCmd, cmd)
+}
+
+// sessionSummary describes everything cleaned since devtidy started.
+func (m Model) sessionSummary() string {
+	summary := fmt.Sprintf("Freed %s this session (%d items", formatSize(m.cleanedSize), m.cleanedCount)
+	if m.trashedSize > 0 {
+		summary = fmt.Sprintf("Freed %s and moved %s to the trash this session (%d items",
+			formatSize(m.cleanedSize), formatSize(m.trashedSize), m.cleanedCount)
+	}
+	if failures := countIssues(m.issues, phaseClean); failures > 0 {
+		summary += fmt.Sprintf(", %d failures", failures)
+	}
+	if len(m.roots) > 1 {
+		summary += fmt.Sprintf(", %d directories", len(m.roots))
+	}
+	return summary + ")"
+}
+
+func (m Model) calculateTotalSelectedSize() int64 {
+	return m.items.SelectedSize()
+}
+
+func (m Model) countSelectedItems() int {
+	return m.items.SelectedCount()
+}
+
+type scanJob struct {
+	root string
+	info os.FileInfo
+}
+
+type walkOptions struct {
+	maxWorkers int
+	issues     *issueLog
+	// file, if set, is called concurrently for every entry that is neither a
+	// directory nor a symlink
+	file func(path string, e os.DirEntry)
+	// maxDepth limits how many levels below root are read; 0 means no limit
+	maxDepth int
+	exclude  []string
+	progress *scanProgress
+	// ctx stops the walk when cancelled; nil never does
+	ctx context.Context
+}
+
+type walkDir struct {
+	path  string
+	depth int
+}
+
+func boundedWalk(root string, opts walkOptions) <-chan scanJob {
+	maxWorkers := opts.maxWorkers
+	if maxWorkers <= 0 {
+		maxWorkers = runtime.NumCPU()
+	}
+
+	out := make(chan scanJob, maxWorkers*2)
+	go func() {
+		defer close(out)
+
+		// work queue
+		work := []walkDir{{path: root}}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+
+		// worker function
+		worker := func() {
+			defer wg.Done()
+			for {
+				if cancelled(opts.ctx) {
+					return
+				}
+				mu.Lock()
+				if len(work) == 0 {
+					mu.Unlock()
+					return
+				}
+				next := work[len(work)-1]
+				work = work[:len(work)-1]
+				mu.Unlock()
+
+				dir := next.path
+				entries, err := os.ReadDir(fsPath(dir))
+				if err != nil {
+					opts.issues.add(newIssue(dir, phaseScan, err))
+					continue
+				}
+				opts.progress.visit(dir)
 				for _, e := range entries {
+					name := e.Name()
+					path := filepath.Join(dir, name)
+					if activeConfig.excluded(path) {
+						continue
+					}
+					if _, ok := matchPath(opts.exclude, path); ok {
+						continue
+					}
+					if e.Type()&os.ModeSymlink != 0 {
+						// Symlinked directories are never followed
+						if target, err := os.Stat(fsPath(path)); err == nil && target.IsDir() {
+							opts.issues.add(Issue{
+								Path:   path,
+								Phase:  phaseScan,
+								Kind:   issueSymlink,
+								Reason: "symbolic links are not followed",
+							})
+						}
+						continue
+					}
 					if !e.IsDir() {
+						if opts.file != nil {
+							opts.file(path, e)
+						}
 						continue
 					}
-					name := e.Name()
 					if strings.HasPrefix(name, ".") && name != "." {
 						if name == ".git" {
 							continue
 						}
 					}
-					path := filepath.Join(dir, name)
 					info, _ := e.Info()
 					out <- scanJob{root: path, info: info}
 
@@ -530,16 +1482,17 @@ func boundedWalk(root string, maxWorkers int) <-chan scanJob {
 						} else {
 							match = name == pat
 						}
-						if match {
+						if match && gateAllows(pat, path) {
 							shouldSkip = true
 							break
 						}
 					}
 
 					// Only add to work queue if we shouldn't skip this directory
-					if !shouldSkip {
+					depth := next.depth + 1
+					if !shouldSkip && (opts.maxDepth == 0 || depth < opts.maxDepth) {
 						mu.Lock()
-						work = append(work, path)
+						work = append(work, walkDir{path: path, depth: depth})
 						mu.Unlock()
 					}
 				}
@@ -556,241 +1509,226 @@ func boundedWalk(root string, maxWorkers int) <-chan scanJob {
 	return out
 }
 
-// Commands
-func scanForCleanableItems(dir string, useGitignore bool) tea.Cmd {
-	return func() tea.Msg {
-		var items []CleanableItem
-		mx := sync.Mutex{}
-
-		if useGitignore {
-			gitignoreItems := scanGitignoreItemsAsync(dir)
-			items = append(items, gitignoreItems...)
-			return scanCompleteMsg(items)
-		}
-
-		var wg sync.WaitGroup
-
-		maxWorkers := runtime.NumCPU() / 2
-		if maxWorkers < 2 {
-			maxWorkers = 2
-		}
-		jobChan := make(chan scanJob, maxWorkers*2)
-
-		// Start workers
-		for i := 0; i < maxWorkers; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				for j := range jobChan {
-					name := filepath.Base(j.root)
-					for pat, desc := range cleanablePatterns {
-						var match bool
-						if strings.Contains(pat, "*") {
-							match, _ = filepath.Match(pat, name)
-						} else {
-							match = name == pat
-						}
-						if match {
-							mx.Lock()
-							items = append(items, CleanableItem{
-								Path:     j.root,
-								Type:     desc,
-								Size:     0,
-								Info:     desc,
-								Selected: false,
-							})
-							mx.Unlock()
-							break
-						}
-					}
-				}
-			}()
-		}
-
-		go func() {
-			defer close(jobChan)
-			for j := range boundedWalk(dir, runtime.NumCPU()/2) {
-				jobChan <- j
-			}
-		}()
-
-		wg.Wait()
-		return scanCompleteMsg(items)
+// scanItems walks dir and returns the cleanable items found, without sizes.
+func scanItems(dir string, opts scanOptions) ([]CleanableItem, []Issue) {
+	var items []CleanableItem
+	mx := sync.Mutex{}
+	issues := &issueLog{}
+	scan := startSpan(nil, "scan", "devtidy.root", dir, "devtidy.gitignore", opts.useGitignore)
+	defer func() {
+		scan.set("devtidy.items", len(items))
+		scan.set("devtidy.issues", len(issues.list()))
+		scan.finish()
+	}()
+	rules, err := loadRepoRules(dir)
+	if err != nil {
+		issues.add(newIssue(filepath.Join(dir, repoRulesFile), phaseScan, err))
+	}
+	walkOpts := walkOptions{
+		maxWorkers: runtime.NumCPU() / 2,
+		issues:     issues,
+		maxDepth:   opts.maxDepth,
+		exclude:    slices.Concat(opts.exclude, absolute(dir, rules.Keep)),
+		progress:   opts.progress,
+		ctx:        opts.ctx,
 	}
-}
-
-func cleanSelectedItems(items []CleanableItem) tea.Cmd {
-	return tea.Batch(startCleaningProcess(items))
-}
 
-func startCleaningProcess(items []CleanableItem) tea.Cmd {
-	return func() tea.Msg {
-		selectedItems := []CleanableItem{}
-		for _, item := range items {
-			if item.Selected {
-				selectedItems = append(selectedItems, item)
+	if opts.useGitignore {
+		gitignoreItems := scanGitignoreItemsAsync(dir, walkOpts)
+		items = append(items, gitignoreItems...)
+		items = filterAge(scan, items, opts)
+		items = activePolicy.filter(items)
+		return items, issues.list()
+	}
+	var ignored chan []CleanableItem
+	if opts.withGitignore {
+		// The pattern walk reports the paths both walks can't read
+		ignoreOpts := walkOpts
+		ignoreOpts.issues = nil
+		ignoreOpts.progress = nil
+		ignored = make(chan []CleanableItem, 1)
+		go func() { ignored <- scanGitignoreItemsAsync(dir, ignoreOpts) }()
+	}
+	var fileDetectors []func(string, os.DirEntry) []CleanableItem
+	one := func(detect func(string, os.DirEntry) (CleanableItem, bool)) func(string, os.DirEntry) []CleanableItem {
+		return func(path string, e os.DirEntry) []CleanableItem {
+			if item, ok := detect(path, e); ok {
+				return []CleanableItem{item}
 			}
+			return nil
 		}
-
-		if len(selectedItems) == 0 {
-			return cleanCompleteMsg{}
-		}
-
-		// Start with first item
-		return cleanSingleItem{
-			items: selectedItems,
-			index: 0,
-			total: len(selectedItems),
+	}
+	var timers []*detectorTimer
+	timed := func(name string, detect func(string, os.DirEntry) []CleanableItem) func(string, os.DirEntry) []CleanableItem {
+		if scan == nil {
+			return detect
 		}
+		timer := &detectorTimer{name: name}
+		timers = append(timers, timer)
+		return timer.wrap(detect)
 	}
-}
-
-// New message type for cleaning single items
-type cleanSingleItem struct {
-	items []CleanableItem
-	index int
-	total int
-}
-
-func scanGitignoreItems(dir string) []CleanableItem {
-	gitignorePath := filepath.Join(dir, ".gitignore")
-	if _, err := os.Stat(gitignorePath); os.IsNotExist(err) {
-		return nil
+	if activeConfig.groupEnabled("runtime") {
+		fileDetectors = append(fileDetectors, timed("stale files", one(detectStaleFile)))
 	}
-
-	file, err := os.Open(gitignorePath)
-	if err != nil {
-		return nil
+	if activeConfig.groupEnabled("archives") {
+		fileDetectors = append(fileDetectors, timed("archives", one(detectArchive)))
 	}
-	defer file.Close()
-
-	var patterns []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "!") {
-			patterns = append(patterns, line)
+	if activeConfig.groupEnabled("data") {
+		fileDetectors = append(fileDetectors, timed("redis dumps", one(detectRedisDump)), timed("compose volumes", detectComposeVolumes))
+	}
+	patterns := &detectorTimer{name: "patterns"}
+	timers = append(timers, patterns)
+	if len(fileDetectors) > 0 {
+		walkOpts.file = func(path string, e os.DirEntry) {
+			for _, detect := range fileDetectors {
+				if found := detect(path, e); len(found) > 0 {
+					mx.Lock()
+					items = append(items, found...)
+					mx.Unlock()
+					opts.progress.found(len(found))
+					opts.stream.add(found...)
+					return
+				}
+			}
 		}
 	}
 
-	var (
-		items []CleanableItem
-		mu    sync.Mutex
-	)
+	var wg sync.WaitGroup
 
-	for job := range boundedWalk(dir, runtime.NumCPU()/2) {
-		path := job.root
-		rel, _ := filepath.Rel(dir, path)
-		for _, pat := range patterns {
-			if matchesGitignorePattern(pat, rel) {
-				mu.Lock()
-				// de-dup
-				found := false
-				for _, it := range items {
-					if it.Path == path {
-						found = true
+	maxWorkers := runtime.NumCPU() / 2
+	if maxWorkers < 2 {
+		maxWorkers = 2
+	}
+	jobChan := make(chan scanJob, maxWorkers*2)
+
+	// Start workers
+	for i := 0; i < maxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobChan {
+				start := time.Now()
+				found := 0
+				name := filepath.Base(j.root)
+				for pat, desc := range cleanablePatterns {
+					var match bool
+					if strings.Contains(pat, "*") {
+						match, _ = filepath.Match(pat, name)
+					} else {
+						match = name == pat
+					}
+					if match && gateAllows(pat, j.root) {
+						item := CleanableItem{
+							Path:     j.root,
+							Type:     desc,
+							Pattern:  pat,
+							Size:     0,
+							ModTime:  modTime(j.info),
+							Info:     desc,
+							Selected: false,
+						}
+						mx.Lock()
+						items = append(items, item)
+						mx.Unlock()
+						opts.progress.found(1)
+						opts.stream.add(item)
+						found = 1
 						break
 					}
 				}
-				if !found {
-					items = append(items, CleanableItem{
-						Path:     path,
-						Type:     "Gitignore pattern: " + pat,
-						Size:     getDirectorySize(path),
-						Info:     "Matches .gitignore pattern",
-						Selected: false,
-					})
-				}
-				mu.Unlock()
-				break
+				patterns.observe(start, found)
 			}
+		}()
+	}
+
+	go func() {
+		defer close(jobChan)
+		for j := range boundedWalk(dir, walkOpts) {
+			jobChan <- j
 		}
+	}()
+
+	wg.Wait()
+	if !opts.skipToolCaches && !cancelled(opts.ctx) {
+		items = append(items, detectToolCaches()...)
 	}
-	sort.Slice(items, func(i, j int) bool {
-		return items[i].Size > items[j].Size
-	})
-	return items
+	for _, timer := range timers {
+		timer.record(scan)
+	}
+	items = dedupeItems(items)
+	if ignored != nil {
+		items = combineSources(items, <-ignored)
+	}
+	markBroken(items)
+	items = filterAge(scan, items, opts)
+	items = activePolicy.filter(items)
+	return items, issues.list()
 }
 
-func scanGitignoreItemsAsync(dir string) []CleanableItem {
-	gitignorePath := filepath.Join(dir, ".gitignore")
-	if _, err := os.Stat(gitignorePath); os.IsNotExist(err) {
-		return nil
+// filterAge applies --older-than and --dormant, which both read the
+// modification times of whole trees.
+func filterAge(scan *span, items []CleanableItem, opts scanOptions) []CleanableItem {
+	if opts.olderThan > 0 {
+		s := startSpan(scan, "older-than", "devtidy.items", len(items))
+		items = dropRecent(items, time.Now().Add(-opts.olderThan))
+		s.finish()
 	}
-
-	file, err := os.Open(gitignorePath)
-	if err != nil {
-		return nil
+	if opts.dormant > 0 {
+		s := startSpan(scan, "dormant", "devtidy.items", len(items))
+		items = keepDormant(items, time.Now().Add(-opts.dormant))
+		s.finish()
 	}
-	defer file.Close()
+	return items
+}
 
-	var patterns []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "!") {
-			patterns = append(patterns, line)
-		}
-	}
+// gitignoreInfo marks the items of gitignore mode.
+const gitignoreInfo = "Matches .gitignore pattern"
 
+// scanGitignoreItemsAsync lists the files and directories ignored by the
+// .gitignore files in dir, without sizes.
+func scanGitignoreItemsAsync(dir string, walkOpts walkOptions) []CleanableItem {
+	matcher := newGitignoreMatcher(dir)
 	var (
 		items []CleanableItem
 		mu    sync.Mutex
 	)
-
-	for job := range boundedWalk(dir, runtime.NumCPU()/2) {
-		path := job.root
-		rel, _ := filepath.Rel(dir, path)
-		for _, pat := range patterns {
-			if matchesGitignorePattern(pat, rel) {
-				mu.Lock()
-				// de-dup
-				found := false
-				for _, it := range items {
-					if it.Path == path {
-						found = true
-						break
-					}
-				}
-				if !found {
-					items = append(items, CleanableItem{
-						Path:     path,
-						Type:     "Gitignore pattern: " + pat,
-						Size:     0,
-						Info:     "Matches .gitignore pattern",
-						Selected: false,
-					})
-				}
-				mu.Unlock()
-				break
-			}
+	add := func(path string, isDir bool, info os.FileInfo) {
+		rule, ok := matcher.match(path, isDir)
+		if !ok {
+			return
 		}
+		mu.Lock()
+		items = append(items, CleanableItem{
+			Path:     path,
+			Type:     "Gitignore pattern: " + rule.line,
+			Pattern:  rule.line,
+			Size:     0,
+			ModTime:  modTime(info),
+			Info:     gitignoreInfo,
+			Selected: false,
+		})
+		mu.Unlock()
 	}
-	return items
-}
-
-func matchesGitignorePattern(pattern, path string) bool {
-	if strings.HasSuffix(pattern, "/") {
-		pattern = strings.TrimSuffix(pattern, "/")
-		return strings.HasPrefix(path, pattern+"/") || path == pattern
+	walkOpts.file = func(path string, e os.DirEntry) {
+		info, _ := e.Info()
+		add(path, false, info)
 	}
-
-	if strings.Contains(pattern, "*") {
-		matched, _ := filepath.Match(pattern, filepath.Base(path))
-		if matched {
-			return true
-		}
-		matched, _ = filepath.Match(pattern, path)
-		return matched
+	for job := range boundedWalk(dir, walkOpts) {
+		add(job.root, true, job.info)
 	}
+	return dropNested(items)
+}
 
-	// Exact match or path contains pattern
-	return path == pattern || strings.Contains(path, pattern) || strings.HasSuffix(path, "/"+pattern)
+func modTime(info os.FileInfo) time.Time {
+	if info == nil {
+		return time.Time{}
+	}
+	return info.ModTime()
 }
 
 func getDirectorySize(path string) int64 {
 	var size int64
-	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+	filepath.Walk(fsPath(path), func(_ string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -803,65 +1741,162 @@ func getDirectorySize(path string) int64 {
 }
 
 func getDirectorySizeFast(path string) int64 {
-	var size int64
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return 0
+	if size, ok := fastDirSize(path); ok {
+		return size
 	}
+	return parallelDirSize(path, max(runtime.NumCPU()/2, 2))
+}
+
+// parallelDirSize sums the sizes of the files under path with workers reading
+// directories off a shared stack, so one deep subtree such as a large
+// node_modules/.pnpm doesn't hold up the others.
+func parallelDirSize(path string, workers int) int64 {
+	var size atomic.Int64
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+	work := []string{path}
+	pending := 1 // directories queued or being read
 
 	var wg sync.WaitGroup
-	sizeChan := make(chan int64, len(entries))
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				for len(work) == 0 && pending > 0 {
+					cond.Wait()
+				}
+				if pending == 0 {
+					mu.Unlock()
+					return
+				}
+				dir := work[len(work)-1]
+				work = work[:len(work)-1]
+				mu.Unlock()
 
-	maxWorkers := 4
-	semaphore := make(chan struct{}, maxWorkers)
+				var subdirs []string
+				var files int64
+				entries, _ := os.ReadDir(fsPath(dir))
+				for _, e := range entries {
+					if e.IsDir() {
+						subdirs = append(subdirs, filepath.Join(dir, e.Name()))
+					} else if info, err := e.Info(); err == nil {
+						files += info.Size()
+					}
+				}
+				size.Add(files)
 
-	for _, entry := range entries {
+				mu.Lock()
+				work = append(work, subdirs...)
+				pending += len(subdirs) - 1
+				if pending == 0 || len(subdirs) > 0 {
+					cond.Broadcast()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return size.Load()
+}
+
+// sizeItems fills in the size of every unsized item, a few at a time.
+func sizeItems(items []CleanableItem) {
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, max(runtime.NumCPU()/2, 2))
+	for i := range items {
+		if items[i].Size != 0 {
+			continue
+		}
 		wg.Add(1)
-		go func(e os.DirEntry) {
+		go func(i int) {
 			defer wg.Done()
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
-
-			entryPath := filepath.Join(path, e.Name())
-			if e.IsDir() {
-				sizeChan <- getDirectorySize(entryPath)
-			} else {
-				if info, err := e.Info(); err == nil {
-					sizeChan <- info.Size()
-				} else {
-					sizeChan <- 0
-				}
-			}
-		}(entry)
+			items[i].Size = getDirectorySizeFast(items[i].Path)
+		}(i)
 	}
+	wg.Wait()
+}
 
-	go func() {
-		wg.Wait()
-		close(sizeChan)
-	}()
+// dropRecent keeps the items whose newest file was modified before cutoff,
+// checking a few items at a time.
+func dropRecent(items []CleanableItem, cutoff time.Time) []CleanableItem {
+	recent := make([]bool, len(items))
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, max(runtime.NumCPU()/2, 2))
+	for i := range items {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			recent[i] = modifiedSince(items[i].Path, cutoff)
+		}(i)
+	}
+	wg.Wait()
 
-	for s := range sizeChan {
-		size += s
+	old := items[:0]
+	for i, item := range items {
+		if !recent[i] {
+			old = append(old, item)
+		}
 	}
+	return old
+}
 
-	return size
+// modifiedSince reports whether path is or contains a file modified after
+// cutoff. It stops at the first one, so recent items are cheap to rule out.
+func modifiedSince(path string, cutoff time.Time) bool {
+	found := false
+	filepath.WalkDir(fsPath(path), func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(cutoff) {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found
 }
 
-func calculateSizesAsyncBatch(items []CleanableItem) tea.Cmd {
-	var commands []tea.Cmd
+// scanAndSize scans dir without the TUI and returns the sized items, largest
+// first.
+func scanAndSize(dir string, opts scanOptions) ([]CleanableItem, []Issue) {
+	return scanAndSizeRoots([]string{dir}, opts)
+}
 
+// scanAndSizeRoots is scanAndSize for several roots, merged into one list.
+func scanAndSizeRoots(roots []string, opts scanOptions) ([]CleanableItem, []Issue) {
+	items, issues := scanRoots(roots, opts)
+	s := startSpan(nil, "size", "devtidy.root", roots[0], "devtidy.items", len(items))
+	sizeItems(items)
+	var total int64
 	for _, item := range items {
-		if item.Size == 0 {
-			commands = append(commands, calculateSingleSize(item.Path))
-		}
+		total += item.Size
 	}
-
-	return tea.Batch(commands...)
+	s.set("devtidy.bytes", total)
+	s.finish()
+	if opts.minSize > 0 {
+		items = slices.DeleteFunc(items, func(item CleanableItem) bool { return item.Size < opts.minSize })
+	}
+	if notes, err := loadNotes(); err == nil {
+		applyNotes(items, notes)
+	}
+	sorted := newItemSet(items)
+	sorted.SortBySize()
+	return sorted.All(), issues
 }
 
 func calculateSingleSize(path string) tea.Cmd {
 	return func() tea.Msg {
+		s := startSpan(nil, "size", "devtidy.path", path)
 		size := getDirectorySizeFast(path)
+		s.set("devtidy.bytes", size)
+		s.finish()
 		return sizeUpdateMsg{path: path, size: size}
 	}
 }
@@ -881,7 +1916,9 @@ func formatSize(bytes int64) string {
 
 const version = "v1.0.5"
 
-var cleanablePatterns = map[string]string{
+// builtinPatterns are the patterns devtidy knows about; cleanablePatterns
+// holds those the config enables, plus the user's own.
+var builtinPatterns = map[string]string{
 	"node_modules":        "Node.js dependencies",
 	"target":              "Rust build artifacts",
 	"build":               "Build artifacts",
@@ -898,27 +1935,121 @@ var cleanablePatterns = map[string]string{
 	"cmake-build-debug":   "CMake build artifacts",
 	"cmake-build-release": "CMake build artifacts",
 	"DerivedData":         "Xcode derived data",
+	"Pods":                "CocoaPods dependencies",
+	"public":              "Static site output",
+	"_site":               "Jekyll site output",
+	".cache":              "Gatsby cache",
+	"site":                "MkDocs site output",
+	".postgres-data":      "PostgreSQL dev data (high risk)",
+	"postgres-data":       "PostgreSQL dev data (high risk)",
+	"pgdata":              "PostgreSQL dev data (high risk)",
+	".mysql-data":         "MySQL dev data (high risk)",
+	"mysql-data":          "MySQL dev data (high risk)",
+	"appendonlydir":       "Redis dev data (high risk)",
+	"kafka-logs":          "Kafka dev data (high risk)",
+	".ccls-cache":         "Indexer cache (ccls)",
+	"clangd":              "Indexer cache (clangd)",
+	"rust-analyzer":       "Indexer cache (rust-analyzer)",
+	".flatpak-builder":    "flatpak-builder build directory",
+	"parts":               "Snapcraft parts",
+	"stage":               "Snapcraft staging area",
+	"prime":               "Snapcraft prime directory",
+	"cache":               "Snapcraft download cache",
+	"src":                 "makepkg extracted sources",
+	"pkg":                 "makepkg package directory",
 	"*.log":               "Log files",
 	"*.tmp":               "Temporary files",
 }
 
+var cleanablePatterns = builtinPatterns
+
 func showVersion() {
-	fmt.Printf("devtidy %s\n", version)
+	if readOnlyBuild {
+		fmt.Printf("devtidy %s (read-only build)\n", version)
+	} else {
+		fmt.Printf("devtidy %s\n", version)
+	}
 	fmt.Printf("Built with Go %s (%s/%s)\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
 }
 
 func showHelp() {
 	fmt.Printf("devtidy %s - Clean development artifacts from your projects\n\n", version)
 	fmt.Println("USAGE:")
-	fmt.Println("  devtidy [options] [directory]")
+	fmt.Println("  devtidy [options] [directory...]")
+	fmt.Println("  devtidy query [options] [expression]")
+	fmt.Println("  devtidy audit [options] [directory]")
+	fmt.Println("  devtidy cost [options] [directory]")
+	fmt.Println("  devtidy undo [options]")
+	fmt.Println("  devtidy trash [purge [options]]")
+	fmt.Println("  devtidy gc [options]")
+	fmt.Println("  devtidy index [options]")
+	fmt.Println("  devtidy verify-journal [options]")
+	fmt.Println("  devtidy ignore [options] [path or glob...]")
+	fmt.Println("  devtidy restore [options] <archive | s3://... | gs://...>")
+	fmt.Println("  devtidy daemon [options] [directory...]")
+	fmt.Println("  devtidy scan [options] [directory]")
+	fmt.Println("  devtidy load [options] <snapshot>")
+	fmt.Println("  devtidy diff [options] <old snapshot> <new snapshot>")
+	fmt.Println("  devtidy runner-cleanup [options] [runner work directory]")
+	fmt.Println("  devtidy sweep [options] [CI workspace root]")
+	fmt.Println("  devtidy bazel-prune [options]")
+	fmt.Println("  devtidy doctor")
+	fmt.Println("  devtidy compare [options] <root> <other root>")
+	fmt.Println("  devtidy growth [options] [directory]")
+	fmt.Println("  devtidy devgen fixture [options] <detector>")
 	fmt.Println()
 	fmt.Println("OPTIONS:")
 	fmt.Println("  -h, --help      Show this help message")
 	fmt.Println("  -v, --version   Show version information")
 	fmt.Println("  --gitignore     Scan files matching .gitignore patterns")
+	fmt.Println("  --with-gitignore")
+	fmt.Println("                  Scan files matching .gitignore patterns next to the built-in patterns")
+	fmt.Println("  --ascii         Use plain ASCII output without colors")
+	fmt.Println("  --select EXPR   Preselect items matching an expression (see devtidy query -h)")
+	fmt.Println("  --result-file FILE")
+	fmt.Println("                  Write the outcome of the run as JSON to FILE on exit")
+	fmt.Println("  --summary-template FILE")
+	fmt.Println("                  Render the outcome of the run with a Go template (.html: HTML-escaped)")
+	fmt.Println("  --summary-file FILE")
+	fmt.Println("                  Write the rendered summary to FILE instead of stdout")
+	fmt.Println("  --min-size SIZE Only list items of at least SIZE, e.g. 100MB")
+	fmt.Println("  --older-than AGE")
+	fmt.Println("                  Only list items with no file modified within AGE, e.g. 30d")
+	fmt.Println("  --dormant AGE   Only list artifacts of projects with no source change within AGE")
+	fmt.Println("  --max-depth N   Don't look more than N directories deep")
+	fmt.Println("  --opt-in GROUP  Also scan an opt-in group (repeatable): data (dev databases),")
+	fmt.Println("                  go (Go build and module caches), node-cache (npm, yarn and pnpm caches),")
+	fmt.Println("                  cargo (cargo downloads), docker (unused Docker images, containers,")
+	fmt.Println("                  volumes and build cache), jvm (Gradle, Maven and Ivy caches),")
+	fmt.Println("                  xcode-cache (Xcode DerivedData, device support, archives, simulator and")
+	fmt.Println("                  CocoaPods caches), indexer-cache (gopls, clangd and zoekt indexes),")
+	fmt.Println("                  homebrew (what brew cleanup would remove), python-cache (pip, Poetry")
+	fmt.Println("                  and conda caches), bazel (Bazel output bases), devtidy (devtidy's own")
+	fmt.Println("                  crash reports, scan history and leftover temporary files)")
+	fmt.Println("  --jvm-keep AGE  Keep the JVM cache artifacts read within AGE, e.g. 30d")
+	fmt.Println("  --exclude GLOB  Never scan or list paths matching GLOB (repeatable, ** matches any depth)")
+	fmt.Println("  --workspace     Scan the roots saved as roots in the config file together")
+	fmt.Println("  --json          Print the scan results as JSON instead of starting the UI")
+	fmt.Println("  --clean         Clean without the interactive UI; needs --all or --select")
+	fmt.Println("  --all           With --clean, delete every item found")
+	fmt.Println("  --yes           With --clean, don't ask for confirmation")
+	fmt.Println("  --trash         Move cleaned items to the trash instead of deleting them")
+	fmt.Println("  --archive DIR   Archive cleaned items as tar.zst into DIR, or s3:// or gs:// URL, before deleting them")
+	fmt.Println("  --compression zstd|gzip  Compress archives with zstd, on every core, or gzip")
+	fmt.Println("  --compression-level N    Compression level of archives; 0 is the compressor's default")
+	fmt.Println("  --dry-run       Select and clean as usual, but only report what would be freed")
+	fmt.Println("  --read-only     Report only; every deletion is disabled")
+	fmt.Println("  --verify N      Measure the bytes actually freed for N random cleaned items")
+	fmt.Println("  --otlp-endpoint URL  Export spans of the scan, sizing and cleaning to an OTLP/HTTP collector")
 	fmt.Println()
 	fmt.Println("ARGUMENTS:")
-	fmt.Println("  directory       Target directory to scan (default: current directory)")
+	fmt.Println("  directory       Target directory to scan (default: current directory); give")
+	fmt.Println("                  several to scan them into one list")
+	fmt.Println()
+	fmt.Println("CONFIG:")
+	fmt.Println("  Defaults for the directory and flags, the workspace roots, excluded paths")
+	fmt.Println("  and the enabled pattern groups are read from devtidy/config.toml in the")
+	fmt.Println("  config directory.")
 	fmt.Println()
 	fmt.Println("DESCRIPTION:")
 	fmt.Println("  DevTidy helps you clean up common development artifacts like:")
@@ -933,12 +2064,220 @@ func showHelp() {
 	fmt.Println("  devtidy                    # Scan current directory")
 	fmt.Println("  devtidy /path/to/project   # Scan specific directory")
 	fmt.Println("  devtidy --gitignore        # Scan using .gitignore patterns")
+	fmt.Println("  devtidy query 'size>1GB'   # List large items from the last scan")
 	fmt.Println()
 }
 
+// resolveTargetDir validates the directory argument and makes it absolute,
+// defaulting to the working directory.
+func resolveTargetDir(args []string) string {
+	targetDir := "."
+	if len(args) > 0 {
+		targetDir = args[0]
+
+		if info, err := os.Stat(targetDir); err != nil {
+			log.Fatalf("Error: Directory '%s' does not exist or is not accessible", targetDir)
+		} else if !info.IsDir() {
+			log.Fatalf("Error: '%s' is not a directory", targetDir)
+		}
+
+		if absPath, err := filepath.Abs(targetDir); err == nil {
+			targetDir = absPath
+		}
+	} else {
+		if currentDir, err := os.Getwd(); err == nil {
+			targetDir = currentDir
+		}
+	}
+	return targetDir
+}
+
+// stringList collects the values of a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func requireGitignore(targetDir string) {
+	gitignorePath := filepath.Join(targetDir, ".gitignore")
+	if _, err := os.Stat(gitignorePath); os.IsNotExist(err) {
+		log.Fatalf("Error: .gitignore file not found in directory '%s'", targetDir)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		// Runs before the policy and config are loaded so it can diagnose
+		// them when they're broken
+		if err := runDoctor(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	p, err := loadPolicy(policyPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+	activePolicy = p
+
+	path, err := configPath()
+	if err == nil {
+		activeConfig, err = loadConfig(path)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	cleanablePatterns = activeConfig.patterns()
+	// The ignore list adds to the exclusions of every command; the paths
+	// it protects mustn't be cleaned because it couldn't be read
+	ignored, err := loadIgnoreList()
+	if err != nil {
+		log.Fatal(err)
+	}
+	activeConfig.Exclude = append(activeConfig.Exclude, ignored...)
+	// Before dispatching, so read_only covers every command
+	readOnly = readOnly || activeConfig.ReadOnly
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "query":
+			if err := runQuery(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "audit":
+			if err := runAudit(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "cost":
+			if err := runCost(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "undo":
+			if err := runUndo(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "trash":
+			if err := runTrash(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "index":
+			if err := runIndex(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "ignore":
+			if err := runIgnore(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "verify-journal":
+			if err := runVerifyJournal(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "gc":
+			if err := runGC(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "restore":
+			if err := runRestore(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "daemon":
+			if err := runDaemon(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "runner-cleanup":
+			if err := runRunnerCleanup(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "sweep":
+			if err := runSweep(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "scan":
+			if err := runScan(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "load":
+			if err := runLoad(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "diff":
+			if err := runDiff(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "bazel-prune":
+			if err := runBazelPrune(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "compare":
+			if err := runCompare(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "growth":
+			if err := runGrowth(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "devgen":
+			if err := runDevgen(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	// Define command line flags
-	var gitignoreFlag = flag.Bool("gitignore", false, "scan files matching .gitignore patterns")
+	var gitignoreFlag = flag.Bool("gitignore", activeConfig.Gitignore, "scan files matching .gitignore patterns")
+	var withGitignoreFlag = flag.Bool("with-gitignore", activeConfig.WithGitignore, "scan files matching .gitignore patterns next to the built-in patterns")
+	var minSizeFlag = flag.String("min-size", activeConfig.MinSize, "only list items of at least this size, e.g. 100MB")
+	var olderThanFlag = flag.String("older-than", activeConfig.OlderThan, "only list items with no file modified within this age, e.g. 30d")
+	var dormantFlag = flag.String("dormant", activeConfig.Dormant, "only list artifacts of projects with no source file modified within this age, e.g. 180d")
+	var jvmKeepFlag = flag.String("jvm-keep", activeConfig.JVMKeep, "keep the JVM cache artifacts read within this age, e.g. 30d")
+	var maxDepthFlag = flag.Int("max-depth", activeConfig.MaxDepth, "don't look more than this many directories deep (0: no limit)")
+	var asciiFlag = flag.Bool("ascii", activeConfig.ASCII, "use plain ASCII output without colors")
+	var selectFlag = flag.String("select", "", "preselect items matching an expression")
+	var resultFileFlag = flag.String("result-file", "", "write the outcome of the run as JSON to this file")
+	var summaryTemplateFlag = flag.String("summary-template", "", "render the outcome of the run with this Go template")
+	var summaryFileFlag = flag.String("summary-file", "", "write the rendered summary to this file instead of stdout")
+	var workspaceFlag = flag.Bool("workspace", false, "scan the roots of the config file together")
+	var jsonFlag = flag.Bool("json", false, "print the scan results as JSON instead of starting the UI")
+	var cleanFlag = flag.Bool("clean", false, "clean without the interactive UI")
+	var allFlag = flag.Bool("all", false, "with --clean, delete every item found")
+	var yesFlag = flag.Bool("yes", false, "with --clean, don't ask for confirmation")
+	var trashFlag = flag.Bool("trash", activeConfig.Trash || activePolicy.RequireTrash, "move cleaned items to the trash instead of deleting them")
+	var archiveFlag = flag.String("archive", activeConfig.ArchiveDir, "archive cleaned items as tar.zst into this directory, or s3:// or gs:// URL, before deleting them")
+	var compressionFlag = flag.String("compression", activeConfig.Compression, "with --archive, compress with zstd or gzip (default zstd)")
+	var levelFlag = flag.Int("compression-level", activeConfig.Level, "with --archive, the compression level: 1-22 for zstd, 1-9 for gzip; 0 is the compressor's default")
+	var dryRunFlag = flag.Bool("dry-run", activeConfig.DryRun, "only report what cleaning would delete and free")
+	addReadOnlyFlag(flag.CommandLine)
+	var verifyFlag = flag.Int("verify", activeConfig.Verify, "measure the bytes actually freed for this many random cleaned items")
+	var otlpFlag = flag.String("otlp-endpoint", activeConfig.OTLPEndpoint, "export spans of the scan, sizing and cleaning to this OTLP/HTTP collector")
+	var excludeFlag stringList
+	flag.Var(&excludeFlag, "exclude", "never scan paths matching this glob (repeatable)")
+	var optInFlag stringList
+	flag.Var(&optInFlag, "opt-in", "also scan this opt-in group, e.g. data (repeatable)")
 	var helpFlag = flag.Bool("h", false, "show help")
 	var help2Flag = flag.Bool("help", false, "show help")
 	var versionFlag = flag.Bool("v", false, "show version")
@@ -955,37 +2294,212 @@ func main() {
 		return
 	}
 
-	targetDir := "."
 	args := flag.Args()
-	if len(args) > 0 {
-		targetDir = args[0]
+	if *workspaceFlag {
+		if len(args) > 0 {
+			log.Fatal("Error: --workspace scans the roots of the config file; give no directory with it")
+		}
+		if len(activeConfig.Roots) == 0 {
+			log.Fatal("Error: --workspace needs roots in the config file, e.g. roots = [\"~/work\", \"~/oss\"]")
+		}
+		args = activeConfig.Roots
+	}
+	if len(args) == 0 && activeConfig.Directory != "" {
+		args = []string{activeConfig.Directory}
+	}
+	targetDirs := resolveTargetDirs(args)
+	if endpoint := otlpEndpoint(*otlpFlag); endpoint != "" {
+		startTracing(endpoint, targetDirs[0])
+		defer func() {
+			if err := flushTraces(); err != nil {
+				log.Errorf("Error: could not export traces: %v", err)
+			}
+		}()
+	}
+	if *gitignoreFlag && *withGitignoreFlag {
+		log.Fatal("Error: --gitignore lists only .gitignore matches; use --with-gitignore alone to add them to the built-in patterns")
+	}
+	if *gitignoreFlag {
+		for _, dir := range targetDirs {
+			requireGitignore(dir)
+		}
+	}
 
-		if info, err := os.Stat(targetDir); err != nil {
-			log.Fatalf("Error: Directory '%s' does not exist or is not accessible", targetDir)
-		} else if !info.IsDir() {
-			log.Fatalf("Error: '%s' is not a directory", targetDir)
+	// --exclude adds to the exclusions from the config file
+	activeConfig.Exclude = append(activeConfig.Exclude, excludeFlag...)
+	for _, group := range optInFlag {
+		if !slices.Contains(optInGroups, group) {
+			log.Fatalf("Error: unknown opt-in group %q (known: %s)", group, strings.Join(optInGroups, ", "))
 		}
+	}
+	if len(optInFlag) > 0 {
+		activeConfig.OptIn = append(activeConfig.OptIn, optInFlag...)
+		cleanablePatterns = activeConfig.patterns()
+	}
 
-		if absPath, err := filepath.Abs(targetDir); err == nil {
-			targetDir = absPath
+	if *asciiFlag || detectASCII() {
+		useASCII()
+	}
+
+	go pruneOwnFiles()
+
+	compression, err := parseCompression(*compressionFlag, *levelFlag)
+	if err != nil {
+		log.Fatalf("Error: invalid archive compression: %v", err)
+	}
+	archiveCompression = compression
+
+	if *verifyFlag < 0 {
+		log.Fatal("Error: --verify must not be negative")
+	}
+	if *maxDepthFlag < 0 {
+		log.Fatal("Error: --max-depth must not be negative")
+	}
+	var minSize int64
+	if *minSizeFlag != "" {
+		n, err := parseSize(*minSizeFlag)
+		if err != nil {
+			log.Fatalf("Error: invalid --min-size: %v", err)
 		}
-	} else {
-		if currentDir, err := os.Getwd(); err == nil {
-			targetDir = currentDir
+		minSize = n
+	}
+	var olderThan time.Duration
+	if *olderThanFlag != "" {
+		d, err := parseAge(*olderThanFlag)
+		if err != nil {
+			log.Fatalf("Error: invalid --older-than: %v", err)
+		}
+		olderThan = d
+	}
+	var dormant time.Duration
+	if *dormantFlag != "" {
+		d, err := parseAge(*dormantFlag)
+		if err != nil {
+			log.Fatalf("Error: invalid --dormant: %v", err)
+		}
+		dormant = d
+	}
+	if *jvmKeepFlag != "" {
+		d, err := parseAge(*jvmKeepFlag)
+		if err != nil {
+			log.Fatalf("Error: invalid --jvm-keep: %v", err)
+		}
+		jvmKeep = d
+	}
+	if *archiveFlag != "" && *trashFlag {
+		archiveGiven := false
+		flag.Visit(func(f *flag.Flag) { archiveGiven = archiveGiven || f.Name == "archive" })
+		switch {
+		case !activePolicy.RequireTrash:
+			log.Fatal("Error: --archive can't be combined with --trash")
+		case archiveGiven:
+			// Archiving deletes the item afterwards, which the policy forbids
+			log.Fatalf("Error: policy %s requires moving items to the trash, so --archive can't be used", activePolicy.path)
+		default:
+			fmt.Fprintf(os.Stderr, "archive_dir is ignored: policy %s requires moving items to the trash\n", activePolicy.path)
+			*archiveFlag = ""
 		}
 	}
 
-	if *gitignoreFlag {
-		gitignorePath := filepath.Join(targetDir, ".gitignore")
-		if _, err := os.Stat(gitignorePath); os.IsNotExist(err) {
-			log.Fatalf("Error: .gitignore file not found in directory '%s'", targetDir)
+	var selectExpr queryExpr
+	if *selectFlag != "" {
+		expr, err := parseQuery(*selectFlag)
+		if err != nil {
+			log.Fatalf("Error: invalid --select expression: %v", err)
+		}
+		selectExpr = expr
+	}
+
+	// Filters given as flags are remembered for the root by the UI
+	var given rootSettings
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "min-size":
+			given.MinSize = *minSizeFlag
+		case "older-than":
+			given.OlderThan = *olderThanFlag
+		case "dormant":
+			given.Dormant = *dormantFlag
+		case "exclude":
+			given.Exclude = excludeFlag
+		}
+	})
+
+	opts := scanOptions{
+		useGitignore:  *gitignoreFlag,
+		withGitignore: *withGitignoreFlag,
+		maxDepth:      *maxDepthFlag,
+		olderThan:     olderThan,
+		dormant:       dormant,
+		minSize:       minSize,
+		selectExpr:    selectExpr,
+		verifySample:  *verifyFlag,
+		dryRun:        *dryRunFlag,
+		trash:         *trashFlag,
+		archiveDir:    expandHome(*archiveFlag),
+		given:         given,
+	}
+
+	if *jsonFlag {
+		items, _ := scanAndSizeRoots(targetDirs, opts)
+		if selectExpr != nil {
+			items = matchItems(items, selectExpr)
+		}
+		if err := writeItems(os.Stdout, items, formatJSON); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	out := runOutputs{resultFile: *resultFileFlag, summaryFile: *summaryFileFlag}
+	if *summaryTemplateFlag != "" {
+		t, err := loadSummaryTemplate(*summaryTemplateFlag)
+		if err != nil {
+			log.Fatalf("Error: invalid --summary-template: %v", err)
 		}
+		out.summary = t
 	}
 
-	model := initialModel(targetDir, *gitignoreFlag)
+	if *cleanFlag {
+		err := runHeadless(targetDirs, opts, *allFlag, *yesFlag, out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	m := initialModel(targetDirs, opts)
+	if len(args) == 0 && needsPicker(targetDirs[0]) {
+		m = m.startPicking()
+	}
+	runInteractive(m, out)
+}
+
+// runInteractive runs the TUI and reports what happened once it exits.
+func runInteractive(m Model, out runOutputs) {
+	model := newCrashGuard(m)
 	p := tea.NewProgram(model, tea.WithAltScreen())
 
-	if _, err := p.Run(); err != nil {
+	final, err := p.Run()
+	if guard, ok := final.(crashGuard); ok {
+		if guard.model.stream != nil {
+			// Quit during the scan
+			guard.model.stream.cancel()
+		}
+		if guard.crash.report == nil && errors.Is(err, tea.ErrProgramPanic) {
+			// A command goroutine panicked; bubbletea already printed it
+			guard.record(nil)
+		}
+		crashed := guard.crash.report != nil
+		guard.model.rememberRootSettings()
+		logMismatches(guard.model.checks)
+		out.write(newRunResult(guard.model, crashed))
+		if crashed {
+			reportCrash(guard.crash)
+			os.Exit(1)
+		}
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
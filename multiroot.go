@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Several directories can be scanned in one run, as in
+// devtidy ~/work ~/personal: each is walked in turn and the results are
+// merged into one list, every item tagged with the directory it was found
+// under. A directory inside another one given is already covered by it.
+
+// resolveTargetDirs validates the directory arguments and makes them
+// absolute, dropping repeats and directories inside others. Without
+// arguments it returns the working directory.
+func resolveTargetDirs(args []string) []string {
+	if len(args) <= 1 {
+		return []string{resolveTargetDir(args)}
+	}
+	dirs := make([]string, len(args))
+	for i, arg := range args {
+		dirs[i] = resolveTargetDir([]string{arg})
+	}
+	var roots []string
+	for _, dir := range dirs {
+		covered := slices.ContainsFunc(dirs, func(other string) bool {
+			return other != dir && isBelow(dir, other)
+		})
+		if !covered && !slices.Contains(roots, dir) {
+			roots = append(roots, dir)
+		}
+	}
+	return roots
+}
+
+// isBelow reports whether path is root or inside it.
+func isBelow(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
+
+// scanRoots walks every root and merges what it finds. With more than one
+// root each item found inside a root is tagged with it; the global caches
+// of the opt-in groups are listed once, untagged.
+func scanRoots(roots []string, opts scanOptions) ([]CleanableItem, []Issue) {
+	if len(roots) == 1 {
+		return scanItems(roots[0], opts)
+	}
+	var items []CleanableItem
+	var issues []Issue
+	for i, root := range roots {
+		if cancelled(opts.ctx) {
+			break
+		}
+		rootOpts := opts
+		rootOpts.skipToolCaches = i > 0
+		found, skipped := scanItems(root, rootOpts)
+		for j := range found {
+			if isBelow(found[j].Path, root) {
+				found[j].Root = root
+			}
+		}
+		items = append(items, found...)
+		issues = append(issues, skipped...)
+	}
+	return items, issues
+}
+
+// itemsOf returns the items of root among those scanned from roots. The
+// items outside every root belong to the first.
+func itemsOf(root string, roots []string, items []CleanableItem) []CleanableItem {
+	if len(roots) == 1 {
+		return items
+	}
+	var own []CleanableItem
+	for _, item := range items {
+		if item.Root == root || item.Root == "" && root == roots[0] {
+			own = append(own, item)
+		}
+	}
+	return own
+}
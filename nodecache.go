@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// The node-cache group lists the global caches of npm, yarn and pnpm, next
+// to the node_modules directories that are filled from them.
+
+const (
+	npmCachePattern  = "npm-cache"
+	yarnCachePattern = "yarn-cache"
+	pnpmStorePattern = "pnpm-store"
+)
+
+// detectNodeCaches lists the package manager caches that exist.
+func detectNodeCaches() []CleanableItem {
+	var items []CleanableItem
+	add := func(path, pattern, desc, info string) {
+		if item, ok := cacheItem(path, pattern, desc, info); ok {
+			items = append(items, item)
+		}
+	}
+	add(filepath.Join(npmCacheDir(), "_cacache"), npmCachePattern, "npm cache",
+		"Downloaded package tarballs; npm fetches them again from the registry when needed")
+	for _, dir := range yarnCacheDirs() {
+		add(dir, yarnCachePattern, "Yarn cache",
+			"Downloaded packages; yarn fetches them again from the registry when needed")
+	}
+	add(pnpmStoreDir(), pnpmStorePattern, "pnpm store",
+		"Packages linked into node_modules; pruning only frees those no project uses any more")
+	return items
+}
+
+func npmCacheDir() string {
+	if dir := toolOutput("npm", "config", "get", "cache"); dir != "" {
+		return dir
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("LocalAppData"), "npm-cache")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".npm")
+}
+
+// yarnCacheDirs returns the cache of yarn classic and the global cache of
+// yarn 2 and later.
+func yarnCacheDirs() []string {
+	home, _ := os.UserHomeDir()
+	berry := filepath.Join(home, ".yarn", "berry", "cache")
+	if dir := toolOutput("yarn", "cache", "dir"); dir != "" {
+		return []string{dir, berry}
+	}
+	cache, _ := os.UserCacheDir()
+	classic := filepath.Join(cache, "yarn")
+	switch runtime.GOOS {
+	case "darwin":
+		classic = filepath.Join(cache, "Yarn")
+	case "windows":
+		classic = filepath.Join(cache, "Yarn", "Cache")
+	}
+	return []string{classic, berry}
+}
+
+func pnpmStoreDir() string {
+	if dir := toolOutput("pnpm", "store", "path"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "pnpm", "store")
+	case "windows":
+		return filepath.Join(os.Getenv("LocalAppData"), "pnpm", "store")
+	}
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		data = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(data, "pnpm", "store")
+}
+
+// npmCleaner runs npm cache clean on the cache holding path, or removes it
+// when npm isn't installed.
+func npmCleaner(path string) error {
+	npm, err := exec.LookPath("npm")
+	if err != nil {
+		return removeAll(path)
+	}
+	cmd := exec.Command(npm, "cache", "clean", "--force")
+	cmd.Env = append(os.Environ(), "npm_config_cache="+filepath.Dir(path))
+	return runToolClean(cmd)
+}
+
+// yarnCleaner runs yarn cache clean when path is the cache yarn uses.
+// Other caches, such as that of another yarn major version, are removed.
+func yarnCleaner(path string) error {
+	yarn, err := exec.LookPath("yarn")
+	if err != nil || !samePath(toolOutput(yarn, "cache", "dir"), path) {
+		return removeAll(path)
+	}
+	return runToolClean(exec.Command(yarn, "cache", "clean"))
+}
+
+// pnpmCleaner prunes the store. Packages in it are hard linked into
+// node_modules, so removing it wholesale would free little and leave
+// projects pointing at a store that is gone; without pnpm it is left alone.
+func pnpmCleaner(path string) error {
+	pnpm, err := exec.LookPath("pnpm")
+	if err != nil {
+		return errors.New("pnpm is not installed, so its store can't be pruned")
+	}
+	return runToolClean(exec.Command(pnpm, "store", "prune", "--store-dir", path))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Notes are short free-text annotations such as "keep until the demo on
+// 6/1", stored as a JSON object keyed by path. A note on a project directory
+// applies to every item inside it; a note on the item itself wins.
+
+func notesPath() (string, error) {
+	return statePath("notes.json")
+}
+
+// loadNotes reads the notes file. A missing file means there are no notes.
+func loadNotes() (map[string]string, error) {
+	path, err := notesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseNotes(path, data)
+}
+
+func parseNotes(path string, data []byte) (map[string]string, error) {
+	notes := map[string]string{}
+	if len(data) == 0 {
+		return notes, nil
+	}
+	if err := json.Unmarshal(data, &notes); err != nil {
+		return nil, fmt.Errorf("invalid notes file %s: %w", path, err)
+	}
+	return notes, nil
+}
+
+// updateNote sets the note on path, or removes it when note is empty, in the
+// notes file as it is now, keeping the notes others wrote meanwhile, and
+// returns the notes saved.
+func updateNote(path, note string) (map[string]string, error) {
+	file, err := notesPath()
+	if err != nil {
+		return nil, err
+	}
+	var notes map[string]string
+	err = updateStateFile("notes.json", func(data []byte) ([]byte, error) {
+		if notes, err = parseNotes(file, data); err != nil {
+			return nil, err
+		}
+		if note != "" {
+			notes[path] = note
+		} else {
+			delete(notes, path)
+		}
+		data, err := json.MarshalIndent(notes, "", "  ")
+		return append(data, '\n'), err
+	})
+	return notes, err
+}
+
+// noteFor returns the note on path or on its nearest annotated parent.
+func noteFor(notes map[string]string, path string) string {
+	for p := path; ; {
+		if note, ok := notes[p]; ok {
+			return note
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return ""
+		}
+		p = parent
+	}
+}
+
+// applyNotes fills in the note of every item.
+func applyNotes(items []CleanableItem, notes map[string]string) {
+	for i := range items {
+		items[i].Note = noteFor(notes, items[i].Path)
+	}
+}
+
+// openNote starts editing the note on the item under the cursor, or on its
+// project directory when project is set.
+func (m Model) openNote(project bool) (Model, tea.Cmd) {
+	selectedItem, ok := m.list.SelectedItem().(CleanableItem)
+	if !ok {
+		return m, nil
+	}
+	if m.notes == nil {
+		m.statusMsg = errorStyle.Render("The notes file can't be read; fix or remove it to add notes")
+		return m, nil
+	}
+	m.notePath = selectedItem.Path
+	if project {
+		m.notePath = filepath.Dir(selectedItem.Path)
+	}
+	m.statusMsg = ""
+	m.command.Prompt = "note for " + displayPath(m.notePath) + ": "
+	m.command.Placeholder = "empty to remove"
+	m.command.SetValue(m.notes[m.notePath])
+	m.command.CursorEnd()
+	m.commandActive = true
+	return m, m.command.Focus()
+}
+
+// saveNote stores the typed note, or removes it when empty, and refreshes
+// the notes shown in the list.
+func (m Model) saveNote() (Model, tea.Cmd) {
+	path := m.notePath
+	m = m.closeCommand()
+
+	notes, err := updateNote(path, strings.TrimSpace(m.command.Value()))
+	if err != nil {
+		m.statusMsg = errorStyle.Render("Could not save notes: " + err.Error())
+		return m, nil
+	}
+	m.notes = notes
+
+	cursor := m.list.Index()
+	m.items.ApplyNotes(m.notes)
+	cmd := m.refreshList()
+	if m.list.FilterState() == list.Unfiltered {
+		m.list.Select(cursor)
+	}
+	return m, cmd
+}
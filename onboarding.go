@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Roots scanned before are remembered in the cache so the first-run
+// introduction is shown once per root.
+
+func knownRootsPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "known-roots"), nil
+}
+
+func onboardingDisabledPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "no-onboarding"), nil
+}
+
+// needsOnboarding reports whether root has never been scanned and the
+// introduction hasn't been turned off.
+func needsOnboarding(root string) bool {
+	if path, err := onboardingDisabledPath(); err != nil {
+		return false
+	} else if _, err := os.Stat(path); err == nil {
+		return false
+	}
+
+	path, err := knownRootsPath()
+	if err != nil {
+		return false
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return true
+	} else if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if scanner.Text() == root {
+			return false
+		}
+	}
+	return true
+}
+
+func rememberRoot(root string) error {
+	path, err := knownRootsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, root)
+	return err
+}
+
+func disableOnboarding() error {
+	path, err := onboardingDisabledPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte("Delete this file to show the first-run introduction again.\n"), 0o644)
+}
+
+// finishOnboarding leaves the introduction for the results, optionally in
+// dry-run mode. Remembering the root is best effort.
+func (m Model) finishOnboarding(dryRun, disable bool) Model {
+	rememberRoot(m.currentDir)
+	if disable {
+		disableOnboarding()
+	}
+	m.dryRun = m.dryRun || dryRun
+	m.state = stateSelecting
+	return m
+}
+
+func (m Model) onboardingView() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("First scan of " + displayPath(m.currentDir)))
+	b.WriteString("\n\n")
+	b.WriteString(fmt.Sprintf("Found %d items taking %s. What devtidy lists:\n\n", m.items.Len(), formatSize(m.items.TotalSize())))
+	b.WriteString("  " + symbols.bullet + " Dependencies (node_modules, vendor, .venv) are downloaded again by\n")
+	b.WriteString("    your package manager on the next install.\n")
+	b.WriteString("  " + symbols.bullet + " Build output and caches (target, dist, __pycache__) are rebuilt on the\n")
+	b.WriteString("    next build, which can take a while for large projects.\n")
+	b.WriteString("  " + symbols.bullet + " Anything matched by --gitignore may include files you can't recreate,\n")
+	b.WriteString("    such as local .env files. Preview with enter before cleaning.\n\n")
+	b.WriteString(errorStyle.Render("Cleaning deletes permanently unless you press t to move items to the trash."))
+	b.WriteString("\n\n")
+	b.WriteString("d: start in dry-run mode (c only reports what would be freed)\n")
+	b.WriteString("enter: continue\n")
+	b.WriteString("n: continue and don't show this again")
+	return docStyle.Render(b.String())
+}
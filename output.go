@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Output formats for non-interactive commands
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+func validOutputFormat(format string) bool {
+	return format == formatText || format == formatJSON
+}
+
+func writeItems(w io.Writer, items []CleanableItem, format string) error {
+	switch format {
+	case formatJSON:
+		if items == nil {
+			items = []CleanableItem{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	case formatText:
+		for _, item := range items {
+			line := fmt.Sprintf("%10s  %-28s %s", formatSize(item.Size), item.Type, displayPath(item.Path))
+			if item.Broken != "" {
+				line += "  (broken: " + item.Broken + ")"
+			}
+			if item.Dormant != "" {
+				line += "  (dormant for " + item.Dormant + ")"
+			}
+			if item.Note != "" {
+				line += "  # " + item.Note
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// Linux packaging tools build in directories next to the recipe and keep
+// them for the next build: flatpak-builder in .flatpak-builder, snapcraft in
+// parts, stage and prime, and makepkg in src and pkg. Their names are as
+// common as any, so they only match next to the recipe, and src and pkg only
+// once makepkg has packaged something there.
+
+// isSnapcraftProject recognizes the directory snapcraft builds in.
+func isSnapcraftProject(project string) bool {
+	return anyExists(project, "snapcraft.yaml", ".snapcraft.yaml", filepath.Join("snap", "snapcraft.yaml"))
+}
+
+// isMakepkgBuild recognizes an AUR package directory makepkg has built in.
+// A repository shipping a PKGBUILD next to its own src stays out until a
+// package was built there, which would have overwritten that src anyway.
+func isMakepkgBuild(project string) bool {
+	if !anyExists(project, "PKGBUILD") {
+		return false
+	}
+	for _, pattern := range []string{"pkg/*/.PKGINFO", "*.pkg.tar*"} {
+		if matches, _ := filepath.Glob(filepath.Join(fsPath(project), pattern)); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isSnapcraftCache recognizes ~/snap/snapcraft/common, where snapcraft
+// keeps what it downloads for builds.
+func isSnapcraftCache(project string) bool {
+	return filepath.Base(project) == "common" &&
+		filepath.Base(filepath.Dir(project)) == "snapcraft" &&
+		filepath.Base(filepath.Dir(filepath.Dir(project))) == "snap"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// displayPath makes a path safe to render on a single line. Paths with
+// control characters, invalid UTF-8 or trailing spaces are shown quoted with
+// Go escapes; everything else is returned unchanged.
+func displayPath(path string) string {
+	if utf8.ValidString(path) && !hasTrailingSpace(path) &&
+		strings.IndexFunc(path, func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		return path
+	}
+	return strconv.Quote(path)
+}
+
+func hasTrailingSpace(path string) bool {
+	return strings.HasSuffix(path, " ") || strings.Contains(path, " "+string(os.PathSeparator))
+}
+
+// pathBytes returns the raw bytes of a path that JSON can't carry as a
+// string. encoding/json replaces invalid UTF-8 with U+FFFD, so such paths are
+// exported a second time as base64 in path_bytes.
+func pathBytes(path string) []byte {
+	if utf8.ValidString(path) {
+		return nil
+	}
+	return []byte(path)
+}
+
+type itemFields CleanableItem
+
+type itemJSON struct {
+	itemFields
+	PathBytes []byte `json:"path_bytes,omitempty"`
+}
+
+func (i CleanableItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(itemJSON{itemFields(i), pathBytes(i.Path)})
+}
+
+func (i *CleanableItem) UnmarshalJSON(data []byte) error {
+	var v itemJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*i = CleanableItem(v.itemFields)
+	if v.PathBytes != nil {
+		i.Path = string(v.PathBytes)
+	}
+	return nil
+}
+
+type issueFields Issue
+
+type issueJSON struct {
+	issueFields
+	PathBytes []byte `json:"path_bytes,omitempty"`
+}
+
+func (i Issue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(issueJSON{issueFields(i), pathBytes(i.Path)})
+}
+
+func (i *Issue) UnmarshalJSON(data []byte) error {
+	var v issueJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*i = Issue(v.issueFields)
+	if v.PathBytes != nil {
+		i.Path = string(v.PathBytes)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Started without a directory somewhere that holds far more than projects,
+// like the home directory, devtidy asks where to look before walking all of
+// it: a recently scanned root, a directory browsed to, or everything anyway.
+
+// recentRootsLimit is how many scanned roots the picker offers.
+const recentRootsLimit = 10
+
+func recentRootsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "recent-roots"), nil
+}
+
+// loadRecentRoots reads the recently scanned roots, newest first. A missing
+// file means there are none.
+func loadRecentRoots() ([]string, error) {
+	path, err := recentRootsPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var roots []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			roots = append(roots, line)
+		}
+	}
+	return roots, scanner.Err()
+}
+
+// rememberRecentRoot moves root to the front of the recent roots.
+func rememberRecentRoot(root string) error {
+	roots, err := loadRecentRoots()
+	if err != nil {
+		return err
+	}
+	roots = slices.DeleteFunc(roots, func(r string) bool { return r == root })
+	roots = append([]string{root}, roots...)
+	if len(roots) > recentRootsLimit {
+		roots = roots[:recentRootsLimit]
+	}
+
+	path, err := recentRootsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	content := "# Directories devtidy scanned recently, newest first\n"
+	for _, r := range roots {
+		content += r + "\n"
+	}
+	return os.WriteFile(path, []byte(content), 0o644)
+}
+
+// needsPicker reports whether dir is too broad to scan unasked: the home
+// directory, a directory above it or the root of a filesystem, unless it is
+// a project itself.
+func needsPicker(dir string) bool {
+	if hasProjectMarker(dir) {
+		return false
+	}
+	if filepath.Dir(dir) == dir {
+		return true
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, home)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
+
+type pickerRow struct {
+	path   string
+	recent bool
+}
+
+// picker lists the recent roots followed by the directories in the one
+// being browsed.
+type picker struct {
+	start  string // where devtidy was started
+	dir    string // the directory being browsed
+	recent []string
+	rows   []pickerRow
+	cursor int
+	offset int
+}
+
+var pickerKeys = struct {
+	up     key.Binding
+	down   key.Binding
+	scan   key.Binding
+	open   key.Binding
+	back   key.Binding
+	scanAt key.Binding
+	quit   key.Binding
+}{
+	up:     key.NewBinding(key.WithKeys("up", "k")),
+	down:   key.NewBinding(key.WithKeys("down", "j")),
+	scan:   key.NewBinding(key.WithKeys("enter")),
+	open:   key.NewBinding(key.WithKeys("right", "l")),
+	back:   key.NewBinding(key.WithKeys("backspace", "left", "h")),
+	scanAt: key.NewBinding(key.WithKeys(".")),
+	quit:   key.NewBinding(key.WithKeys("q", "ctrl+c", "esc")),
+}
+
+// newPicker starts browsing dir. Recent roots that are gone or are dir
+// itself aren't offered.
+func newPicker(dir string) picker {
+	p := picker{start: dir}
+	recent, _ := loadRecentRoots()
+	for _, root := range recent {
+		if info, err := os.Stat(root); err == nil && info.IsDir() && root != dir {
+			p.recent = append(p.recent, root)
+		}
+	}
+	return p.browse(dir)
+}
+
+// browse lists the directories in dir, leaving out hidden ones.
+func (p picker) browse(dir string) picker {
+	p.dir = dir
+	p.rows = p.rows[:0:0]
+	for _, root := range p.recent {
+		p.rows = append(p.rows, pickerRow{path: root, recent: true})
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			p.rows = append(p.rows, pickerRow{path: filepath.Join(dir, e.Name())})
+		}
+	}
+	p.cursor, p.offset = 0, 0
+	return p
+}
+
+func (p picker) selected() (pickerRow, bool) {
+	if p.cursor < len(p.rows) {
+		return p.rows[p.cursor], true
+	}
+	return pickerRow{}, false
+}
+
+// startPicking shows the picker instead of scanning the model's root.
+func (m Model) startPicking() Model {
+	m.state = statePicking
+	m.picker = newPicker(m.currentDir)
+	m.roots = nil
+	m.onboarding = false
+	return m
+}
+
+func (m Model) updatePicker(msg tea.KeyMsg) (Model, tea.Cmd) {
+	p := m.picker
+	switch {
+	case key.Matches(msg, pickerKeys.quit):
+		return m, tea.Quit
+	case key.Matches(msg, pickerKeys.up):
+		p.cursor = max(p.cursor-1, 0)
+	case key.Matches(msg, pickerKeys.down):
+		p.cursor = max(min(p.cursor+1, len(p.rows)-1), 0)
+	case key.Matches(msg, pickerKeys.scan):
+		if row, ok := p.selected(); ok {
+			return m.pick(row.path)
+		}
+	case key.Matches(msg, pickerKeys.scanAt):
+		return m.pick(p.dir)
+	case key.Matches(msg, pickerKeys.open):
+		if row, ok := p.selected(); ok {
+			p = p.browse(row.path)
+		}
+	case key.Matches(msg, pickerKeys.back):
+		if parent := filepath.Dir(p.dir); parent != p.dir {
+			from := p.dir
+			p = p.browse(parent)
+			for i, row := range p.rows {
+				if !row.recent && row.path == from {
+					p.cursor = i
+				}
+			}
+		}
+	}
+	m.picker = p.scrolled(m.pickerRows())
+	return m, nil
+}
+
+// pick scans dir as the first root of the session.
+func (m Model) pick(dir string) (Model, tea.Cmd) {
+	m.onboarding = needsOnboarding(dir)
+	return m.openRoot(dir)
+}
+
+// pickerRows is how many rows fit between the header and the footer.
+func (m Model) pickerRows() int {
+	_, v := docStyle.GetFrameSize()
+	return max(m.windowHeight-v-7, 1)
+}
+
+// scrolled moves the offset so the cursor stays on screen.
+func (p picker) scrolled(rows int) picker {
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	} else if p.cursor >= p.offset+rows {
+		p.offset = p.cursor - rows + 1
+	}
+	return p
+}
+
+func (m Model) pickerView() string {
+	p := m.picker
+	lines := []string{
+		titleStyle.Render("Where should devtidy look?"),
+		fmt.Sprintf("Scanning all of %s can take a long time; pick a directory to scan instead.", displayPath(p.start)),
+		"",
+		"In " + displayPath(p.dir) + ":",
+	}
+
+	end := min(p.offset+m.pickerRows(), len(p.rows))
+	for i := p.offset; i < end; i++ {
+		row := p.rows[i]
+		line := filepath.Base(row.path) + "/"
+		if row.recent {
+			line = displayPath(row.path) + "  (recent)"
+		}
+		if i == p.cursor {
+			lines = append(lines, selectedStyle.Render("> "+line))
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	if len(p.rows) == 0 {
+		lines = append(lines, "No directories in "+displayPath(p.dir))
+	}
+
+	lines = append(lines, "", fmt.Sprintf("j/k: move %[1]s enter: scan %[1]s l: open %[1]s h: up %[1]s .: scan %[2]s %[1]s q: quit",
+		symbols.bullet, displayPath(p.dir)))
+	return docStyle.Render(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Pinned paths live in a plain text file, one path or glob per line. Lines
+// starting with # are comments.
+
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "devtidy"), nil
+}
+
+func pinsPath() (string, error) {
+	return statePath("pins")
+}
+
+// loadPins reads the pins file. A missing file means nothing is pinned.
+func loadPins() ([]string, error) {
+	return readStateList("pins")
+}
+
+// updatePins pins path, or unpins it, in the pins file as it is now, keeping
+// what others pinned meanwhile, and returns the pins saved.
+func updatePins(path string, pin bool) ([]string, error) {
+	var pins []string
+	err := updateStateFile("pins", func(data []byte) ([]byte, error) {
+		current, err := parseStateList(data)
+		if err != nil {
+			return nil, err
+		}
+		pins = slices.DeleteFunc(current, func(p string) bool { return p == path })
+		if pin {
+			pins = append(pins, path)
+		}
+		return formatStateList("Paths and globs devtidy always lists first", pins), nil
+	})
+	return pins, err
+}
+
+// matchPath returns the pattern matching path. Globs are matched against the
+// full path and, when they contain no separator, against the base name. A **
+// path element matches any number of directories.
+func matchPath(patterns []string, path string) (string, bool) {
+	for _, pattern := range patterns {
+		if pattern == path {
+			return pattern, true
+		}
+		if !strings.ContainsRune(pattern, '/') && !strings.ContainsRune(pattern, filepath.Separator) {
+			if ok, err := filepath.Match(pattern, filepath.Base(path)); err == nil && ok {
+				return pattern, true
+			}
+			continue
+		}
+		if matchElements(splitPath(pattern), splitPath(path)) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func splitPath(path string) []string {
+	return strings.Split(filepath.ToSlash(path), "/")
+}
+
+func matchElements(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(path); i >= 0; i-- {
+				if matchElements(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, err := filepath.Match(pattern[0], path[0]); err != nil || !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "/work/app/dist", path: "/work/app/dist", want: true},
+		{pattern: "node_modules", path: "/work/app/node_modules", want: true},
+		{pattern: "*.egg-info", path: "/work/py/pkg.egg-info", want: true},
+		{pattern: "node_modules", path: "/work/node_modules/x", want: false},
+		{pattern: "/work/*/dist", path: "/work/app/dist", want: true},
+		{pattern: "/work/*/dist", path: "/work/a/b/dist", want: false},
+		{pattern: "/work/**/dist", path: "/work/dist", want: true},
+		{pattern: "/work/**/dist", path: "/work/a/b/dist", want: true},
+		{pattern: "/work/**", path: "/work/a/b", want: true},
+		{pattern: "**/vendor/**", path: "/src/go/vendor/github.com/x", want: true},
+		{pattern: "**/vendor/**", path: "/src/go/vendored/x", want: false},
+		{pattern: "/work/**/dist", path: "/other/a/dist", want: false},
+		{pattern: "/work/[", path: "/work/[", want: true},
+		{pattern: "/work/[/x", path: "/work/a/x", want: false},
+	}
+	for _, tt := range tests {
+		pattern, path := filepath.FromSlash(tt.pattern), filepath.FromSlash(tt.path)
+		got, ok := matchPath([]string{pattern}, path)
+		if ok != tt.want || (ok && got != pattern) {
+			t.Errorf("matchPath(%q, %q) = %q, %v, want %v", tt.pattern, tt.path, got, ok, tt.want)
+		}
+	}
+}
+
+func TestConfigExcluded(t *testing.T) {
+	c := config{Exclude: []string{"**/fixtures/**", "*.bak"}}
+	for path, want := range map[string]bool{
+		"/work/app/test/fixtures/node_modules": true,
+		"/work/app/old.bak":                    true,
+		"/work/app/node_modules":               false,
+	} {
+		if got := c.excluded(filepath.FromSlash(path)); got != want {
+			t.Errorf("excluded(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+// TestUpdatePinsConcurrently pins from several goroutines at once, like
+// users sharing a state directory, and expects none of the pins to be lost.
+func TestUpdatePinsConcurrently(t *testing.T) {
+	t.Setenv("DEVTIDY_STATE_DIR", t.TempDir())
+	var paths []string
+	for i := range 20 {
+		paths = append(paths, filepath.FromSlash(fmt.Sprintf("/work/p%d/node_modules", i)))
+	}
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := updatePins(path, true); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	pins, err := loadPins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(pins)
+	slices.Sort(paths)
+	if !slices.Equal(pins, paths) {
+		t.Errorf("pins = %v, want %v", pins, paths)
+	}
+
+	if _, err := updatePins(paths[0], false); err != nil {
+		t.Fatal(err)
+	}
+	if pins, _ := loadPins(); slices.Contains(pins, paths[0]) || len(pins) != len(paths)-1 {
+		t.Errorf("pins after unpinning %s = %v", paths[0], pins)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+)
+
+// policy holds restrictions set by administrators in a system-wide file that
+// users can't override.
+type policy struct {
+	// ForbiddenDetectors lists patterns, e.g. "vendor", whose items are
+	// never offered for cleaning.
+	ForbiddenDetectors []string `toml:"forbidden_detectors"`
+	// MaxItemsPerRun and MaxBytesPerRun cap a single clean; zero means no cap.
+	MaxItemsPerRun int    `toml:"max_items_per_run"`
+	MaxBytesPerRun string `toml:"max_bytes_per_run"`
+	// RequireTrash forbids permanent deletion.
+	RequireTrash bool `toml:"require_trash"`
+
+	path     string
+	maxBytes int64
+}
+
+var activePolicy policy
+
+func policyPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "devtidy", "policy.toml")
+	}
+	return "/etc/devtidy/policy.toml"
+}
+
+// loadPolicy reads the policy file. A missing file means no restrictions; a
+// file that can't be read or parsed is an error, so a broken policy never
+// silently lifts the restrictions.
+func loadPolicy(path string) (policy, error) {
+	var p policy
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return p, nil
+	}
+	if _, err := toml.DecodeFile(path, &p); err != nil {
+		return p, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	p.path = path
+	if p.MaxBytesPerRun != "" {
+		n, err := parseSize(p.MaxBytesPerRun)
+		if err != nil {
+			return p, fmt.Errorf("invalid policy %s: max_bytes_per_run: %w", path, err)
+		}
+		p.maxBytes = n
+	}
+	return p, nil
+}
+
+// filter drops items of forbidden detectors.
+func (p policy) filter(items []CleanableItem) []CleanableItem {
+	if len(p.ForbiddenDetectors) == 0 {
+		return items
+	}
+	allowed := items[:0]
+	for _, item := range items {
+		if !slices.Contains(p.ForbiddenDetectors, item.Pattern) {
+			allowed = append(allowed, item)
+		}
+	}
+	return allowed
+}
+
+// allowClean reports why a clean of count items totalling size bytes is
+// forbidden, if it is.
+func (p policy) allowClean(count int, size int64, trash bool) error {
+	switch {
+	case p.RequireTrash && !trash:
+		return fmt.Errorf("policy %s requires moving items to the trash; turn on trash mode with t or --trash", p.path)
+	case p.MaxItemsPerRun > 0 && count > p.MaxItemsPerRun:
+		return fmt.Errorf("policy %s allows at most %d items per run", p.path, p.MaxItemsPerRun)
+	case p.maxBytes > 0 && size > p.maxBytes:
+		return fmt.Errorf("policy %s allows at most %s per run", p.path, formatSize(p.maxBytes))
+	}
+	return nil
+}
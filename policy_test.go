@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	p, err := loadPolicy(filepath.Join(dir, "missing.toml"))
+	if err != nil || p.path != "" {
+		t.Fatalf("loadPolicy of a missing file = %+v, %v, want no restrictions", p, err)
+	}
+
+	path := filepath.Join(dir, "policy.toml")
+	os.WriteFile(path, []byte("max_bytes_per_run = \"1GB\"\nforbidden_detectors = [\"vendor\"]\n"), 0o644)
+	p, err = loadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.maxBytes != 1<<30 || p.path != path {
+		t.Errorf("loadPolicy = %+v, want 1GB from %s", p, path)
+	}
+
+	os.WriteFile(path, []byte("max_bytes_per_run = \"lots\"\n"), 0o644)
+	if _, err := loadPolicy(path); err == nil {
+		t.Error("loadPolicy accepted an invalid max_bytes_per_run")
+	}
+}
+
+func TestPolicyFilter(t *testing.T) {
+	items := []CleanableItem{
+		{Path: "/a/node_modules", Pattern: "node_modules"},
+		{Path: "/a/vendor", Pattern: "vendor"},
+		{Path: "/b/target", Pattern: "target"},
+	}
+	got := policy{ForbiddenDetectors: []string{"vendor"}}.filter(items)
+	if len(got) != 2 || got[0].Pattern != "node_modules" || got[1].Pattern != "target" {
+		t.Errorf("filter = %+v, want node_modules and target", got)
+	}
+	if got := (policy{}).filter(items[:1]); len(got) != 1 {
+		t.Errorf("filter without restrictions dropped items: %+v", got)
+	}
+}
+
+func TestPolicyAllowClean(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     policy
+		count int
+		size  int64
+		trash bool
+		want  string
+	}{
+		{name: "no restrictions", p: policy{}, count: 1000, size: 1 << 40},
+		{name: "under the caps", p: policy{MaxItemsPerRun: 3, maxBytes: 100}, count: 3, size: 100},
+		{name: "too many items", p: policy{MaxItemsPerRun: 3}, count: 4, want: "at most 3 items"},
+		{name: "too many bytes", p: policy{maxBytes: 1 << 20}, count: 1, size: 2 << 20, want: "at most 1.0 MB"},
+		{name: "trash required", p: policy{RequireTrash: true}, count: 1, want: "requires moving items to the trash"},
+		{name: "trash required and used", p: policy{RequireTrash: true}, count: 1, trash: true},
+	}
+	for _, tt := range tests {
+		err := tt.p.allowClean(tt.count, tt.size, tt.trash)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: allowClean = %v, want nil", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: allowClean = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type previewEntry struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+type previewMsg struct {
+	path    string
+	entries []previewEntry
+	err     error
+	// archive is set for the listing of an archive, which may be cut short
+	archive   bool
+	truncated bool
+}
+
+// loadPreview sizes the first level of entries inside path, like `du -sh *`.
+func loadPreview(path string) tea.Cmd {
+	return func() tea.Msg {
+		dirEntries, err := os.ReadDir(fsPath(path))
+		if err != nil {
+			return previewMsg{path: path, err: err}
+		}
+
+		entries := make([]previewEntry, len(dirEntries))
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, 4)
+		for i, e := range dirEntries {
+			wg.Add(1)
+			go func(i int, e os.DirEntry) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				entry := previewEntry{name: e.Name(), isDir: e.IsDir()}
+				if e.IsDir() {
+					entry.size = getDirectorySize(filepath.Join(path, e.Name()))
+				} else if info, err := e.Info(); err == nil {
+					entry.size = info.Size()
+				}
+				entries[i] = entry
+			}(i, e)
+		}
+		wg.Wait()
+
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].size > entries[j].size
+		})
+		return previewMsg{path: path, entries: entries}
+	}
+}
+
+func renderPreview(preview previewMsg) string {
+	kind := "directory"
+	if preview.archive {
+		kind = "archive"
+	}
+	if preview.err != nil {
+		return errorStyle.Render("Cannot read " + kind + ": " + errorReason(preview.err))
+	}
+	if len(preview.entries) == 0 {
+		return strings.ToUpper(kind[:1]) + kind[1:] + " is empty."
+	}
+
+	var b strings.Builder
+	var total int64
+	for _, entry := range preview.entries {
+		total += entry.size
+		name := displayPath(entry.name)
+		if entry.isDir {
+			name += string(filepath.Separator)
+		}
+		b.WriteString(fmt.Sprintf("%10s  %s\n", formatSize(entry.size), name))
+	}
+	b.WriteString(fmt.Sprintf("\n%10s  total (%d entries)", formatSize(total), len(preview.entries)))
+	if preview.truncated {
+		b.WriteString(fmt.Sprintf("\n\nOnly the first %d entries of the archive are listed.", listingEntries))
+	}
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// A project is the nearest directory above an item with one of
+// projectMarkers; items outside of any project belong to their parent. The
+// list can be grouped by project, and the soft limits count projects.
+
+var projectMarkers = []string{
+	"package.json", "Cargo.toml", "go.mod", "pyproject.toml", "setup.py",
+	"requirements.txt", "mix.exs", "build.gradle", "build.gradle.kts",
+	"pom.xml", "CMakeLists.txt", "Gemfile", "composer.json",
+}
+
+// projectOf returns the project owning the item at path, caching the answer
+// for every directory it looks at.
+func projectOf(path string, cache map[string]string) string {
+	var visited []string
+	project := filepath.Dir(path)
+	for dir := project; ; dir = filepath.Dir(dir) {
+		if p, ok := cache[dir]; ok {
+			project = p
+			break
+		}
+		visited = append(visited, dir)
+		if hasProjectMarker(dir) {
+			project = dir
+			break
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	for _, dir := range visited {
+		cache[dir] = project
+	}
+	return project
+}
+
+func hasProjectMarker(dir string) bool {
+	for _, marker := range projectMarkers {
+		if _, err := os.Stat(fsPath(filepath.Join(dir, marker))); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// The python-cache group lists the global caches of pip, Poetry and conda,
+// next to the __pycache__ directories and virtual environments of projects.
+
+const (
+	pipCachePattern    = "pip-cache"
+	poetryCachePattern = "poetry-cache"
+	condaPkgsPattern   = "conda-pkgs"
+)
+
+// detectPythonCaches lists the caches that exist.
+func detectPythonCaches() []CleanableItem {
+	var items []CleanableItem
+	add := func(path, pattern, desc, info string) {
+		if item, ok := cacheItem(path, pattern, desc, info); ok {
+			items = append(items, item)
+		}
+	}
+	add(pipCacheDir(), pipCachePattern, "pip cache",
+		"Downloaded and built wheels; pip fetches and builds them again when needed")
+	add(poetryCacheDir(), poetryCachePattern, "Poetry cache",
+		"Downloaded packages and the virtual environments Poetry created for projects; poetry install recreates them")
+	for _, dir := range condaPkgsDirs() {
+		add(dir, condaPkgsPattern, "conda package cache",
+			"Downloaded and extracted packages; cleaning only removes those no environment uses")
+	}
+	return items
+}
+
+func pipCacheDir() string {
+	if dir := toolOutput("pip", "cache", "dir"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("PIP_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	return userCacheSubdir("pip", filepath.Join("pip", "Cache"))
+}
+
+func poetryCacheDir() string {
+	if dir := toolOutput("poetry", "config", "cache-dir"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("POETRY_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	return userCacheSubdir("pypoetry", filepath.Join("pypoetry", "Cache"))
+}
+
+// userCacheSubdir returns name in the user cache directory, or windows in
+// the local application data on Windows, where Python tools don't use the
+// roaming one.
+func userCacheSubdir(name, windows string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("LocalAppData"), windows)
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cache, name)
+}
+
+// condaPkgsDirs returns the package caches conda uses, or those of the
+// usual installations when it isn't on the PATH.
+func condaPkgsDirs() []string {
+	var info struct {
+		PkgsDirs []string `json:"pkgs_dirs"`
+	}
+	if out := toolOutput("conda", "info", "--json"); out != "" && json.Unmarshal([]byte(out), &info) == nil {
+		return info.PkgsDirs
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, install := range []string{"miniconda3", "anaconda3", "miniforge3", "mambaforge", ".conda"} {
+		dirs = append(dirs, filepath.Join(home, install, "pkgs"))
+	}
+	return dirs
+}
+
+// pipCleaner runs pip cache purge when path is the cache pip uses. Other
+// caches are removed.
+func pipCleaner(path string) error {
+	pip, err := exec.LookPath("pip")
+	if err != nil || !samePath(toolOutput(pip, "cache", "dir"), path) {
+		return removeAll(path)
+	}
+	return runToolClean(exec.Command(pip, "cache", "purge"))
+}
+
+// condaCleaner runs conda clean. Packages in the cache are linked into
+// environments, so removing it wholesale could break them; without conda
+// it is left alone.
+func condaCleaner(string) error {
+	conda, err := exec.LookPath("conda")
+	if err != nil {
+		return errors.New("conda is not on the PATH, so its package cache can't be cleaned")
+	}
+	return runToolClean(exec.Command(conda, "clean", "--all", "--yes"))
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// queryExpr is a parsed selection expression such as
+// `type=node_modules and size>1GB and age>30d`.
+type queryExpr interface {
+	match(item CleanableItem, now time.Time) bool
+}
+
+type andExpr struct{ left, right queryExpr }
+type orExpr struct{ left, right queryExpr }
+type notExpr struct{ expr queryExpr }
+
+func (e andExpr) match(item CleanableItem, now time.Time) bool {
+	return e.left.match(item, now) && e.right.match(item, now)
+}
+
+func (e orExpr) match(item CleanableItem, now time.Time) bool {
+	return e.left.match(item, now) || e.right.match(item, now)
+}
+
+func (e notExpr) match(item CleanableItem, now time.Time) bool {
+	return !e.expr.match(item, now)
+}
+
+// stringCond compares a text field. `=` accepts globs and `~` is a
+// case-insensitive substring match.
+type stringCond struct {
+	field string
+	op    string
+	value string
+}
+
+func (c stringCond) match(item CleanableItem, now time.Time) bool {
+	var candidates []string
+	switch c.field {
+	case "type":
+		candidates = []string{item.Pattern, item.Type}
+	case "path":
+		candidates = []string{item.Path}
+	case "name":
+		candidates = []string{filepath.Base(item.Path)}
+	}
+
+	matched := false
+	for _, candidate := range candidates {
+		if c.op == "~" {
+			matched = strings.Contains(strings.ToLower(candidate), strings.ToLower(c.value))
+		} else if ok, err := filepath.Match(c.value, candidate); err == nil && ok {
+			matched = true
+		}
+		if matched {
+			break
+		}
+	}
+	if c.op == "!=" {
+		return !matched
+	}
+	return matched
+}
+
+// numberCond compares size in bytes or age in nanoseconds.
+type numberCond struct {
+	field string
+	op    string
+	value int64
+}
+
+func (c numberCond) match(item CleanableItem, now time.Time) bool {
+	var actual int64
+	switch c.field {
+	case "size":
+		actual = item.Size
+	case "age":
+		if item.ModTime.IsZero() {
+			return false
+		}
+		actual = int64(now.Sub(item.ModTime))
+	}
+
+	switch c.op {
+	case "=":
+		return actual == c.value
+	case "!=":
+		return actual != c.value
+	case ">":
+		return actual > c.value
+	case ">=":
+		return actual >= c.value
+	case "<":
+		return actual < c.value
+	case "<=":
+		return actual <= c.value
+	}
+	return false
+}
+
+type matchAll struct{}
+
+func (matchAll) match(CleanableItem, time.Time) bool { return true }
+
+func matchItems(items []CleanableItem, expr queryExpr) []CleanableItem {
+	now := time.Now()
+	var matched []CleanableItem
+	for _, item := range items {
+		if expr.match(item, now) {
+			matched = append(matched, item)
+		}
+	}
+	return matched
+}
+
+// parseQuery parses an expression. An empty expression matches everything.
+func parseQuery(input string) (queryExpr, error) {
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return matchAll{}, nil
+	}
+
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return expr, nil
+}
+
+type queryToken struct {
+	text   string
+	op     bool
+	quoted bool
+}
+
+func tokenizeQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, queryToken{text: string(r), op: true})
+			i++
+		case strings.ContainsRune("=!<>~", r):
+			j := i + 1
+			if j < len(runes) && runes[j] == '=' {
+				j++
+			}
+			op := string(runes[i:j])
+			if op == "!" {
+				return nil, fmt.Errorf("unknown operator %q", op)
+			}
+			tokens = append(tokens, queryToken{text: op, op: true})
+			i = j
+		case r == '"' || r == '\'':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			tokens = append(tokens, queryToken{text: string(runes[i+1 : j]), quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()=!<>~\"'", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, queryToken{text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peekKeyword(word string) bool {
+	if p.pos >= len(p.tokens) {
+		return false
+	}
+	t := p.tokens[p.pos]
+	return !t.op && !t.quoted && strings.EqualFold(t.text, word)
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseUnary() (queryExpr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	if p.peekKeyword("not") {
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	}
+	if t := p.tokens[p.pos]; t.op && t.text == "(" {
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].text != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryExpr, error) {
+	if p.pos+3 > len(p.tokens) {
+		return nil, fmt.Errorf("incomplete comparison near %q", p.tokens[p.pos].text)
+	}
+	field, op, value := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	if field.op || !op.op || value.op {
+		return nil, fmt.Errorf("expected <field><operator><value> near %q", field.text)
+	}
+	p.pos += 3
+
+	name := strings.ToLower(field.text)
+	switch name {
+	case "type", "path", "name":
+		switch op.text {
+		case "=", "!=", "~":
+			return stringCond{field: name, op: op.text, value: value.text}, nil
+		}
+		return nil, fmt.Errorf("operator %q is not supported for %s", op.text, name)
+	case "size", "age":
+		if op.text == "~" {
+			return nil, fmt.Errorf("operator %q is not supported for %s", op.text, name)
+		}
+		var n int64
+		var err error
+		if name == "size" {
+			n, err = parseSize(value.text)
+		} else {
+			var d time.Duration
+			d, err = parseAge(value.text)
+			n = int64(d)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return numberCond{field: name, op: op.text, value: n}, nil
+	}
+	return nil, fmt.Errorf("unknown field %q (want type, path, name, size or age)", field.text)
+}
+
+// parseSize parses sizes like 500, 100MB or 1.5GB using the same 1024-based
+// units that formatSize prints.
+func parseSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := float64(1)
+	for i, unit := range []string{"KB", "MB", "GB", "TB", "PB"} {
+		if strings.HasSuffix(upper, unit) {
+			upper = strings.TrimSuffix(upper, unit)
+			for j := 0; j <= i; j++ {
+				multiplier *= 1024
+			}
+			break
+		}
+	}
+	upper = strings.TrimSuffix(upper, "B")
+	n, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * multiplier), nil
+}
+
+// parseAge parses durations like 30d, 2w or 1y in addition to Go durations.
+func parseAge(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if num, ok := strings.CutSuffix(s, suffix); ok {
+			n, err := strconv.ParseFloat(num, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	output := fs.String("output", formatText, "output format: text or json")
+	file := fs.String("file", "", "scan results to query (default: the last scan)")
+	index := fs.Bool("index", false, "query the index of every scan of every root instead of the last scan")
+	since := fs.String("since", "", "with --index, only items seen in this long, like 30d")
+	cleaned := fs.Bool("cleaned", false, "with --index, query the items cleaned instead of those scanned")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy query [options] [expression]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "EXPRESSIONS:")
+		fmt.Fprintln(fs.Output(), "  Fields: type, path, name (=, !=, ~) and size, age (=, !=, <, <=, >, >=)")
+		fmt.Fprintln(fs.Output(), "  Combine with and, or, not and parentheses, e.g.")
+		fmt.Fprintln(fs.Output(), "  devtidy query 'type=node_modules and size>1GB and age>30d'")
+		fmt.Fprintln(fs.Output(), "  devtidy query --index --since 30d 'type=node_modules and size>1GB'")
+	}
+	fs.Parse(args)
+
+	if !validOutputFormat(*output) {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	expr, err := parseQuery(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return fmt.Errorf("invalid expression: %w", err)
+	}
+
+	if *index || *cleaned || *since != "" {
+		var from time.Time
+		if *since != "" {
+			age, err := parseAge(*since)
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			from = time.Now().Add(-age)
+		}
+		query := indexedItems
+		if *cleaned {
+			query = indexedCleans
+		}
+		items, err := query(from)
+		if err != nil {
+			return err
+		}
+		return writeItems(os.Stdout, matchItems(items, expr), *output)
+	}
+
+	path := *file
+	if path == "" {
+		if path, err = lastScanPath(); err != nil {
+			return err
+		}
+	}
+	record, err := readScanRecord(path)
+	if os.IsNotExist(err) && *file == "" {
+		return fmt.Errorf("no previous scan found; run devtidy first")
+	} else if err != nil {
+		return err
+	}
+	if notes, err := loadNotes(); err == nil && *file == "" {
+		// Notes may have changed since the scan
+		applyNotes(record.Items, notes)
+	}
+
+	return writeItems(os.Stdout, matchItems(record.Items, expr), *output)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "500", want: 500},
+		{in: "10B", want: 10},
+		{in: "1KB", want: 1 << 10},
+		{in: "100mb", want: 100 << 20},
+		{in: "1.5GB", want: 3 << 29},
+		{in: " 2 TB ", want: 2 << 40},
+		{in: "1PB", want: 1 << 50},
+		{in: "", wantErr: true},
+		{in: "GB", wantErr: true},
+		{in: "big", wantErr: true},
+		{in: "-1MB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "30d", want: 30 * day},
+		{in: "1.5d", want: 36 * time.Hour},
+		{in: "2w", want: 14 * day},
+		{in: "1y", want: 365 * day},
+		{in: "90m", want: 90 * time.Minute},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "", wantErr: true},
+		{in: "10", wantErr: true},
+		{in: "xd", wantErr: true},
+		{in: "-1d", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAge(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAge(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	now := time.Now()
+	items := []CleanableItem{
+		{Path: "/src/web/node_modules", Type: "Node.js dependencies", Pattern: "node_modules", Size: 2 << 30, ModTime: now.Add(-60 * 24 * time.Hour)},
+		{Path: "/src/api/node_modules", Type: "Node.js dependencies", Pattern: "node_modules", Size: 300 << 20, ModTime: now.Add(-2 * 24 * time.Hour)},
+		{Path: "/src/cli/target", Type: "Rust build artifacts", Pattern: "target", Size: 5 << 30, ModTime: now.Add(-100 * 24 * time.Hour)},
+		{Path: "/src/app/__pycache__", Type: "Python bytecode cache", Pattern: "__pycache__", Size: 4 << 10},
+	}
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "", want: []string{"/src/web/node_modules", "/src/api/node_modules", "/src/cli/target", "/src/app/__pycache__"}},
+		{expr: "type=node_modules", want: []string{"/src/web/node_modules", "/src/api/node_modules"}},
+		{expr: "type='Rust build artifacts'", want: []string{"/src/cli/target"}},
+		{expr: "type~python", want: []string{"/src/app/__pycache__"}},
+		{expr: "type!=node_modules", want: []string{"/src/cli/target", "/src/app/__pycache__"}},
+		{expr: "path=/src/web/*", want: []string{"/src/web/node_modules"}},
+		{expr: "name=targ*", want: []string{"/src/cli/target"}},
+		{expr: "size>1GB", want: []string{"/src/web/node_modules", "/src/cli/target"}},
+		{expr: "size<=300MB", want: []string{"/src/api/node_modules", "/src/app/__pycache__"}},
+		{expr: "size=4KB", want: []string{"/src/app/__pycache__"}},
+		// Items without a modification time have no age
+		{expr: "age<7d", want: []string{"/src/api/node_modules"}},
+		{expr: "type=node_modules and size>1GB and age>30d", want: []string{"/src/web/node_modules"}},
+		{expr: "type=target or age<7d", want: []string{"/src/api/node_modules", "/src/cli/target"}},
+		{expr: "not type=node_modules and size>1KB", want: []string{"/src/cli/target", "/src/app/__pycache__"}},
+		{expr: "NOT (type=node_modules OR type=target)", want: []string{"/src/app/__pycache__"}},
+		{expr: "(type=node_modules or type=target) and age>90d", want: []string{"/src/cli/target"}},
+		{expr: "size>10TB", want: nil},
+	}
+	for _, tt := range tests {
+		expr, err := parseQuery(tt.expr)
+		if err != nil {
+			t.Errorf("parseQuery(%q) error = %v", tt.expr, err)
+			continue
+		}
+		var got []string
+		for _, item := range matchItems(items, expr) {
+			got = append(got, item.Path)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseQuery(%q) matched %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, expr := range []string{
+		"size>",
+		"type",
+		"color=red",
+		"size~1GB",
+		"type>node_modules",
+		"size>big",
+		"age<soon",
+		"(type=target",
+		"type=target)",
+		"type=target and",
+		"not",
+		"name='unterminated",
+		"size!1GB",
+	} {
+		if _, err := parseQuery(expr); err == nil {
+			t.Errorf("parseQuery(%q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Items at least this large are deleted file by file so progress is visible
+const largeItemSize = 1 << 30
+
+// node_modules directories at least this large are deleted in parallel where
+// parallelRemoval is set
+const hugeNodeModulesSize = 256 << 20
+
+type queueStatus int
+
+const (
+	queuePending queueStatus = iota
+	queueRunning
+	queueDone
+	queueFailed
+)
+
+// cleanQueue tracks a batch of selected items being deleted by up to
+// workers at a time, each reporting back when its item is done. Pausing lets
+// the running items finish and holds back the pending ones.
+type cleanQueue struct {
+	items  []CleanableItem
+	status []queueStatus
+	// verify marks items whose freed bytes are measured
+	verify []bool
+	// trash moves the items to the trash instead of deleting them
+	trash bool
+	// archive is where items are archived before being deleted, if set
+	archive string
+	paused  bool
+	workers int
+	// bytes freed so far from each running item
+	freed []atomic.Int64
+	// span covers the whole batch when tracing
+	span *span
+	// scanned is when the scan of the items started; items changed since
+	// are skipped
+	scanned time.Time
+	// failures are the items of the batch that couldn't be removed
+	failures []Issue
+	// trashed are the items moved to the trash that undo can restore
+	trashed []trashedItem
+}
+
+type cleanTickMsg struct{}
+
+type cleanResultMsg struct {
+	index int
+	err   error
+	// trashed is where the item went when moved to the trash
+	trashed string
+	// check is set for sampled items
+	check *sizeCheck
+}
+
+func newCleanQueue(items []CleanableItem, verifySample int, trash bool) *cleanQueue {
+	return &cleanQueue{
+		items:   items,
+		status:  make([]queueStatus, len(items)),
+		verify:  sampleIndexes(len(items), verifySample),
+		trash:   trash,
+		workers: max(runtime.NumCPU()/2, 2),
+		freed:   make([]atomic.Int64, len(items)),
+	}
+}
+
+func (q *cleanQueue) count(status queueStatus) int {
+	count := 0
+	for _, s := range q.status {
+		if s == status {
+			count++
+		}
+	}
+	return count
+}
+
+// running returns the indexes of the items being removed.
+func (q *cleanQueue) running() []int {
+	var running []int
+	for i, s := range q.status {
+		if s == queueRunning {
+			running = append(running, i)
+		}
+	}
+	return running
+}
+
+// runningTool reports whether an item cleaned by its tool is running. Tools
+// take their own locks, or clean everything of theirs at once, so their
+// items go one at a time.
+func (q *cleanQueue) runningTool() bool {
+	for _, i := range q.running() {
+		if _, tool := toolCleaners[q.items[i].Pattern]; tool && !q.trash {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *cleanQueue) fraction() float64 {
+	if len(q.items) == 0 {
+		return 1
+	}
+	finished := float64(q.count(queueDone) + q.count(queueFailed))
+	for _, i := range q.running() {
+		if size := q.items[i].Size; size > 0 {
+			finished += min(float64(q.freed[i].Load())/float64(size), 1)
+		}
+	}
+	return finished / float64(len(q.items))
+}
+
+func removeQueuedItem(index int, item CleanableItem, freed *atomic.Int64, verify, trash bool, archive string, scanned time.Time, clean *span) tea.Cmd {
+	return func() tea.Msg {
+		s := startSpan(clean, "remove", "devtidy.path", item.Path, "devtidy.bytes", item.Size)
+		defer s.finish()
+		toolClean, tool := toolCleaners[item.Pattern]
+		// Tools coordinate with their own builds
+		if !tool && changedSince(item.Path, scanned) {
+			s.fail(errChangedSinceScan)
+			return cleanResultMsg{index: index, err: errChangedSinceScan}
+		}
+		var trashed string
+		remove := func() error { return removeAll(item.Path) }
+		switch {
+		case trash:
+			remove = func() (err error) {
+				trashed, err = trashItem(item.Path)
+				return err
+			}
+		case tool:
+			remove = func() error { return toolClean(item.Path) }
+		case archive != "":
+			remove = func() error { return archiveAndRemove(item.Path, archive) }
+		case useParallelRemoval(item):
+			remove = func() error { return removeParallel(item.Path, freed) }
+		case item.Size >= largeItemSize:
+			remove = func() error { return removeWithProgress(item.Path, freed) }
+		}
+		// Docker frees the space of its objects where it can't be measured,
+		// and brew cleanup much of it outside of its cache
+		if !verify || isDockerPath(item.Path) || (tool && item.Pattern == homebrewPattern) {
+			err := remove()
+			s.fail(err)
+			return cleanResultMsg{index: index, err: err, trashed: trashed}
+		}
+		measured, err := measureRemoval(item.Path, remove)
+		s.fail(err)
+		return cleanResultMsg{
+			index:   index,
+			err:     err,
+			trashed: trashed,
+			check:   &sizeCheck{Path: item.Path, Reported: item.Size, Measured: measured},
+		}
+	}
+}
+
+// removeWithProgress deletes path file by file, adding the size of every
+// removed file to freed. Whatever is left afterwards goes through
+// os.RemoveAll, which reports the definitive error.
+func removeWithProgress(path string, freed *atomic.Int64) error {
+	removeFiles(path, freed)
+	return removeAll(path)
+}
+
+// tracksProgress reports whether item is removed in a way that updates the
+// freed counter as it goes. Moving to the trash is a single rename, and
+// archiving takes most of the time before anything is freed.
+func (q *cleanQueue) tracksProgress(item CleanableItem) bool {
+	return !q.trash && q.archive == "" && (item.Size >= largeItemSize || useParallelRemoval(item))
+}
+
+func useParallelRemoval(item CleanableItem) bool {
+	return parallelRemoval && item.Pattern == "node_modules" && item.Size >= hugeNodeModulesSize
+}
+
+// removeParallel spreads the top-level entries of path, one package each in
+// a node_modules tree, across a worker per CPU and removes the rest once
+// they are done. Links to packages elsewhere, which npm link and pnpm
+// create, are removed without touching what they point to.
+func removeParallel(path string, freed *atomic.Int64) error {
+	entries, err := os.ReadDir(fsPath(path))
+	if err != nil {
+		return removeAll(path)
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for range max(runtime.NumCPU(), 2) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sub := range jobs {
+				removeWithProgress(sub, freed)
+			}
+		}()
+	}
+	for _, e := range entries {
+		jobs <- filepath.Join(path, e.Name())
+	}
+	close(jobs)
+	wg.Wait()
+	return removeAll(path)
+}
+
+// removeFiles deletes what is below dir, depth first, adding the size of
+// every removed file to freed. Only real directories are descended into;
+// a link, junction or other reparse point is removed itself, so the files
+// it points to are never deleted.
+func removeFiles(dir string, freed *atomic.Int64) {
+	if info, err := os.Lstat(fsPath(dir)); err != nil || !isRealDir(info) {
+		return
+	}
+	entries, err := os.ReadDir(fsPath(dir))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		info, err := os.Lstat(fsPath(path))
+		if err != nil {
+			continue
+		}
+		if isRealDir(info) {
+			removeFiles(path, freed)
+			removeFile(path)
+			continue
+		}
+		if removeFile(path) == nil && info.Mode().IsRegular() {
+			freed.Add(info.Size())
+		}
+	}
+}
+
+func cleanTick() tea.Cmd {
+	return tea.Tick(time.Millisecond*250, func(time.Time) tea.Msg {
+		return cleanTickMsg{}
+	})
+}
+
+// cleanNext starts pending items until every worker is busy, unless the
+// queue is paused, and completes the batch once nothing is left.
+func (m Model) cleanNext() (Model, tea.Cmd) {
+	q := m.queue
+	if q == nil {
+		return m, nil
+	}
+	running := len(q.running())
+	if running == 0 && q.count(queuePending) == 0 {
+		return m, func() tea.Msg { return cleanCompleteMsg{} }
+	}
+	ticking := m.tickingProgress()
+	var cmds []tea.Cmd
+	for i, status := range q.status {
+		if q.paused || running >= q.workers {
+			break
+		}
+		if status != queuePending {
+			continue
+		}
+		if _, tool := toolCleaners[q.items[i].Pattern]; tool && !q.trash && q.runningTool() {
+			continue
+		}
+		q.status[i] = queueRunning
+		running++
+		cmds = append(cmds, removeQueuedItem(i, q.items[i], &q.freed[i], q.verify[i], q.trash, q.archive, q.scanned, q.span))
+		if !ticking && q.tracksProgress(q.items[i]) {
+			ticking = true
+			cmds = append(cmds, cleanTick())
+		}
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// tickingProgress reports whether a running item already keeps the progress
+// ticking.
+func (m Model) tickingProgress() bool {
+	for _, i := range m.queue.running() {
+		if m.queue.tracksProgress(m.queue.items[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// tickLargeItem refreshes progress while large items are deleted.
+func (m Model) tickLargeItem() (Model, tea.Cmd) {
+	if m.queue == nil || !m.tickingProgress() {
+		return m, nil
+	}
+	return m, tea.Batch(m.progress.SetPercent(m.queue.fraction()), cleanTick())
+}
+
+func (m Model) finishQueuedItem(msg cleanResultMsg) (Model, tea.Cmd) {
+	q := m.queue
+	if q == nil || msg.index >= len(q.items) {
+		return m, nil
+	}
+	item := q.items[msg.index]
+	if msg.check != nil {
+		m.checks = append(m.checks, *msg.check)
+	}
+
+	var listCmd tea.Cmd
+	if msg.err == nil {
+		q.status[msg.index] = queueDone
+		if q.trash {
+			m.trashedSize += item.Size
+		} else {
+			m.cleanedSize += item.Size
+		}
+		m.rootFreed += item.Size
+		m.cleanedCount++
+		m.cleaned = append(m.cleaned, item)
+		if msg.trashed != "" {
+			q.trashed = append(q.trashed, trashedItem{Item: item, Trashed: msg.trashed})
+		}
+
+		// Strike the item through; cleaned items are removed together
+		// once the batch completes so the list doesn't shift mid-clean
+		m.items.Update(item.Path, func(it *CleanableItem) {
+			it.Cleaned = true
+			it.Selected = false
+		})
+		listCmd = m.refreshList()
+	} else {
+		q.status[msg.index] = queueFailed
+		issue := newIssue(item.Path, phaseClean, msg.err)
+		q.failures = append(q.failures, issue)
+		m.issues = append(m.issues, issue)
+	}
+
+	m, next := m.cleanNext()
+	return m, tea.Batch(m.progress.SetPercent(q.fraction()), listCmd, next)
+}
+
+func (m Model) togglePause() (Model, tea.Cmd) {
+	if m.queue == nil {
+		return m, nil
+	}
+	m.queue.paused = !m.queue.paused
+	if !m.queue.paused {
+		return m.cleanNext()
+	}
+	return m, nil
+}
+
+func (m Model) queueView() string {
+	q := m.queue
+	if q == nil {
+		return ""
+	}
+
+	heading := "Cleaning in progress... (p: pause)"
+	if q.trash {
+		heading = "Moving to the trash... (p: pause)"
+	}
+	if q.paused {
+		heading = "Cleaning paused (p: resume)"
+	}
+
+	state := fmt.Sprintf("Done: %d | Pending: %d", q.count(queueDone), q.count(queuePending))
+	if failed := q.count(queueFailed); failed > 0 {
+		state += fmt.Sprintf(" | Failed: %d", failed)
+	}
+	for _, i := range q.running() {
+		item := q.items[i]
+		state += "\nIn progress: " + displayPath(item.Path)
+		if q.tracksProgress(item) {
+			state += fmt.Sprintf(" (%s / %s)", formatSize(q.freed[i].Load()), formatSize(item.Size))
+		}
+	}
+
+	return heading + "\n" + m.progress.View() + "\n" + state
+}
@@ -0,0 +1,48 @@
+//go:build !readonly
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// TestRemoveParallelKeepsLinkedPackages removes a node_modules tree with a
+// package linked from elsewhere, like npm link and pnpm leave, and expects
+// the linked package to survive.
+func TestRemoveParallelKeepsLinkedPackages(t *testing.T) {
+	dir := t.TempDir()
+	project, err := writeFixture(filepath.Join(dir, "work"), "node_modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked, err := writeFixture(filepath.Join(dir, "linked"), "node_modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := filepath.Join(project, "node_modules")
+	if err := os.Symlink(linked, filepath.Join(item, "linked")); err != nil {
+		t.Skipf("can't create symlinks here: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(linked, "index.js"), filepath.Join(item, ".bin", "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	var freed atomic.Int64
+	if err := removeParallel(item, &freed); err != nil {
+		t.Fatalf("removeParallel: %v", err)
+	}
+	if _, err := os.Lstat(item); !os.IsNotExist(err) {
+		t.Fatalf("%s is still there", item)
+	}
+	for _, name := range []string{"package.json", "index.js", "node_modules/left-pad/index.js"} {
+		if _, err := os.Stat(filepath.Join(linked, filepath.FromSlash(name))); err != nil {
+			t.Errorf("the linked package lost %s: %v", name, err)
+		}
+	}
+	if freed.Load() == 0 {
+		t.Error("no freed bytes were counted")
+	}
+}
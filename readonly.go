@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+)
+
+var errReadOnly = errors.New("deleting is disabled in read-only mode")
+
+// readOnly disables every deletion. It is always set in builds tagged
+// readonly, where the deletion code isn't compiled in at all.
+var readOnly = readOnlyBuild
+
+// addReadOnlyFlag adds --read-only to the flags of a command that deletes.
+// It defaults to read_only from the config file, which main applies before
+// any command runs, and can't turn off a readonly build.
+func addReadOnlyFlag(fs *flag.FlagSet) {
+	fs.BoolFunc("read-only", "report only; disable every deletion", func(s string) error {
+		v, err := strconv.ParseBool(s)
+		readOnly = readOnlyBuild || v
+		return err
+	})
+}
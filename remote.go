@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --archive also takes s3://BUCKET/PREFIX and gs://BUCKET/PREFIX, which
+// off-load archives to object storage. The archive and its manifest are
+// written to a staging directory in the cache first, then uploaded with the
+// aws or gcloud command, which split large files into parts uploaded in
+// parallel and retry the parts that fail; an upload that still fails is
+// retried whole a few times. Only once both are uploaded is the item
+// deleted. devtidy restore downloads an archive given by its URL and
+// restores it like a local one.
+
+// remoteSchemes are the object storage URLs --archive takes, and the
+// command each is copied with.
+var remoteSchemes = map[string]string{
+	"s3://": "aws",
+	"gs://": "gcloud",
+}
+
+// isRemote reports whether an archive directory or archive is in object
+// storage.
+func isRemote(location string) bool {
+	for scheme := range remoteSchemes {
+		if strings.HasPrefix(location, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadRetryDelays are the waits before each retry of a failed copy.
+var uploadRetryDelays = []time.Duration{2 * time.Second, 10 * time.Second, 30 * time.Second}
+
+// remoteCommand finds the command that copies to and from url.
+func remoteCommand(url string) (string, error) {
+	for scheme, command := range remoteSchemes {
+		if !strings.HasPrefix(url, scheme) {
+			continue
+		}
+		bin, err := exec.LookPath(command)
+		if err != nil {
+			return "", fmt.Errorf("%s is not on the PATH, so archives can't be copied to or from %s", command, scheme)
+		}
+		return bin, nil
+	}
+	return "", fmt.Errorf("%s isn't in object storage", url)
+}
+
+// copyCommand copies a file between the local filesystem and object
+// storage, one of src and dst being a URL.
+func copyCommand(src, dst string) (*exec.Cmd, error) {
+	url := src
+	if isRemote(dst) {
+		url = dst
+	}
+	bin, err := remoteCommand(url)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(url, "s3://") {
+		return exec.Command(bin, "s3", "cp", "--only-show-errors", src, dst), nil
+	}
+	return exec.Command(bin, "storage", "cp", "--no-user-output-enabled", src, dst), nil
+}
+
+// copyRemote copies src to dst, retrying a failed copy after each of
+// uploadRetryDelays.
+func copyRemote(src, dst string) error {
+	for attempt := 0; ; attempt++ {
+		cmd, err := copyCommand(src, dst)
+		if err != nil {
+			return err
+		}
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if attempt == len(uploadRetryDelays) {
+			return fmt.Errorf("%s: %s", filepath.Base(cmd.Path), strings.TrimSpace(string(out)))
+		}
+		time.Sleep(uploadRetryDelays[attempt])
+	}
+}
+
+// stagingDir makes a directory in the cache for an archive on its way to or
+// from object storage.
+func stagingDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "staging")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(dir, "archive-*")
+}
+
+// archiveItemRemote archives path into the staging directory and uploads
+// the archive and its manifest under url. It returns the URL of the
+// archive.
+func archiveItemRemote(path, url string) (string, error) {
+	// Before spending the time compressing
+	if _, err := remoteCommand(url); err != nil {
+		return "", err
+	}
+	stage, err := stagingDir()
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(stage)
+	archive, err := archiveItem(path, stage)
+	if err != nil {
+		return "", err
+	}
+	remote := strings.TrimSuffix(url, "/") + "/" + filepath.Base(archive)
+	if err := copyRemote(archive, remote); err != nil {
+		return "", fmt.Errorf("uploading %s: %w", remote, err)
+	}
+	if err := copyRemote(archive+manifestSuffix, remote+manifestSuffix); err != nil {
+		return "", fmt.Errorf("uploading the manifest of %s: %w", remote, err)
+	}
+	return remote, nil
+}
+
+// downloadArchive copies an archive and its manifest from object storage
+// into the staging directory. remove deletes them again. Without the
+// manifest only the archive is downloaded, which restores with --no-verify.
+func downloadArchive(url string) (archive string, remove func(), err error) {
+	stage, err := stagingDir()
+	if err != nil {
+		return "", nil, err
+	}
+	remove = func() { os.RemoveAll(stage) }
+	archive = filepath.Join(stage, path.Base(url))
+	if err := copyRemote(url, archive); err != nil {
+		remove()
+		return "", nil, fmt.Errorf("downloading %s: %w", url, err)
+	}
+	// Not retried, as a missing manifest fails every time
+	if cmd, err := copyCommand(url+manifestSuffix, archive+manifestSuffix); err == nil && cmd.Run() != nil {
+		os.Remove(archive + manifestSuffix)
+	}
+	return archive, remove, nil
+}
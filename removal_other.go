@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "io/fs"
+
+const parallelRemoval = false
+
+// isRealDir reports whether info, from Lstat, is a directory and not a link
+// to one.
+func isRealDir(info fs.FileInfo) bool {
+	return info.Mode().Type() == fs.ModeDir
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// Deleting a node_modules tree one file at a time is dominated by per-file
+// latency on NTFS (and whatever scanner hooks into it), so large ones are
+// removed by several workers at once.
+const parallelRemoval = true
+
+// isRealDir reports whether info, from Lstat, is a directory and not a link
+// to one. Junctions, which package managers create for linked packages, and
+// other reparse points count as links whatever mode Go reports for them.
+func isRealDir(info fs.FileInfo) bool {
+	if info.Mode().Type() != fs.ModeDir {
+		return false
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return !ok || attrs.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT == 0
+}
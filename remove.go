@@ -0,0 +1,64 @@
+//go:build !readonly
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const readOnlyBuild = false
+
+// All deletions go through the functions in this file so a readonly build can
+// leave them out.
+
+func removeAll(path string) error {
+	if readOnly {
+		return errReadOnly
+	}
+	return os.RemoveAll(fsPath(path))
+}
+
+func removeFile(path string) error {
+	if readOnly {
+		return errReadOnly
+	}
+	return os.Remove(fsPath(path))
+}
+
+// removeAllWritable deletes path after making its directories writable, for
+// trees that are read-only on purpose like the Go module cache.
+func removeAllWritable(path string) error {
+	if readOnly {
+		return errReadOnly
+	}
+	filepath.WalkDir(fsPath(path), func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chmod(p, 0o755)
+		}
+		return nil
+	})
+	return os.RemoveAll(fsPath(path))
+}
+
+// trashItem moves path to the trash instead of deleting it, and returns
+// where it went, or "" when devtidy can't tell.
+func trashItem(path string) (string, error) {
+	if readOnly {
+		return "", errReadOnly
+	}
+	if isDockerPath(path) {
+		return "", errDockerTrash
+	}
+	return moveToTrash(path)
+}
+
+// runDestructive runs an external command that deletes files.
+func runDestructive(cmd *exec.Cmd) ([]byte, error) {
+	if readOnly {
+		return nil, errReadOnly
+	}
+	return cmd.CombinedOutput()
+}
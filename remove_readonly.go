@@ -0,0 +1,21 @@
+//go:build readonly
+
+package main
+
+import "os/exec"
+
+const readOnlyBuild = true
+
+func removeAll(string) error { return errReadOnly }
+
+func removeFile(string) error { return errReadOnly }
+
+func removeAllWritable(string) error { return errReadOnly }
+
+func trashItem(string) (string, error) { return "", errReadOnly }
+
+func forgetTrashed(string) {}
+
+func trashBackend() (string, error) { return "", errReadOnly }
+
+func runDestructive(*exec.Cmd) ([]byte, error) { return nil, errReadOnly }
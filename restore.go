@@ -0,0 +1,362 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// devtidy restore puts an archived item back. The archive is extracted next
+// to where the item goes and checked against its manifest, and only a tree
+// that matches it byte for byte, with the same modes, modification times
+// and links, is moved into place. Nothing at the item's path is ever
+// replaced.
+
+// archiveManifest describes what an archive holds.
+type archiveManifest struct {
+	// Path is where the item was archived from
+	Path    string          `json:"path"`
+	Created time.Time       `json:"created"`
+	Files   []manifestEntry `json:"files"`
+}
+
+// manifestEntry is a file, directory or symlink of an archived item.
+type manifestEntry struct {
+	// Name is the slash-separated path inside the item, "." for the item
+	Name    string      `json:"name"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	Size    int64       `json:"size,omitempty"`
+	SHA256  string      `json:"sha256,omitempty"`
+	Link    string      `json:"link,omitempty"`
+}
+
+const manifestSuffix = ".manifest.json"
+
+// writeManifest writes the manifest of archive next to it.
+func writeManifest(archive string, m archiveManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(archive+manifestSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+var errNoManifest = errors.New("the archive has no manifest to check it against; pass --no-verify to restore it unchecked")
+
+func readManifest(archive string) (archiveManifest, error) {
+	var m archiveManifest
+	data, err := os.ReadFile(archive + manifestSuffix)
+	if os.IsNotExist(err) {
+		return m, errNoManifest
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("invalid manifest %s: %w", archive+manifestSuffix, err)
+	}
+	return m, nil
+}
+
+// openArchive starts decompressing archive, by its extension, and returns
+// the tar stream. Closing it waits for the decompressor.
+func openArchive(archive string) (io.ReadCloser, error) {
+	if strings.HasSuffix(archive, ".gz") {
+		f, err := os.Open(archive)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("reading %s: %w", archive, err)
+		}
+		return &gzipReader{Reader: zr, file: f}, nil
+	}
+	zstd, err := exec.LookPath("zstd")
+	if err != nil {
+		return nil, errNoZstd
+	}
+	cmd := exec.Command(zstd, "-q", "-d", "-c", archive)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandReader{ReadCloser: out, cmd: cmd, stderr: &stderr}, nil
+}
+
+// commandReader is the output of a command that fails when the command
+// does.
+type commandReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *strings.Builder
+}
+
+func (r *commandReader) Close() error {
+	// Draining lets the command finish when the reader stopped early
+	io.Copy(io.Discard, r.ReadCloser)
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %s", filepath.Base(r.cmd.Path), strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
+
+// gzipReader is a gzip stream that closes its file.
+type gzipReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r *gzipReader) Close() error {
+	err := r.Reader.Close()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// extracted is an entry written while restoring.
+type extracted struct {
+	header *tar.Header
+	sha256 string
+}
+
+// restoreArchive extracts archive to dest, or to where the item was archived
+// from when dest is empty, and returns where it went. Unless verify is off,
+// the tree must match the manifest.
+func restoreArchive(archive, dest string, verify bool) (string, error) {
+	if readOnly {
+		return "", errReadOnly
+	}
+	manifest, err := readManifest(archive)
+	if err != nil && (verify || !errors.Is(err, errNoManifest)) {
+		return "", err
+	}
+	r, err := openArchive(archive)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+
+	first, err := tr.Next()
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", archive, err)
+	}
+	rootName := strings.TrimSuffix(first.Name, "/")
+	if dest == "" {
+		dest = manifest.Path
+		if dest == "" {
+			dest = filepath.FromSlash("/" + rootName)
+		}
+	}
+	if _, err := os.Lstat(fsPath(dest)); err == nil {
+		return "", fmt.Errorf("%s already exists", displayPath(dest))
+	}
+	if err := os.MkdirAll(fsPath(filepath.Dir(dest)), 0o755); err != nil {
+		return "", err
+	}
+	stage, err := os.MkdirTemp(fsPath(filepath.Dir(dest)), ".devtidy-restore-*")
+	if err != nil {
+		return "", err
+	}
+	// The tree may hold read-only directories
+	defer removeAllWritable(stage)
+	staged := filepath.Join(stage, "item")
+
+	entries := make(map[string]extracted)
+	var order []string
+	for hdr := first; ; {
+		name := strings.TrimSuffix(hdr.Name, "/")
+		rel := "."
+		if name != rootName {
+			rel = strings.TrimPrefix(name, rootName+"/")
+			if rel == name || !filepath.IsLocal(filepath.FromSlash(rel)) {
+				return "", fmt.Errorf("unexpected entry %s in the archive", hdr.Name)
+			}
+		}
+		sum, err := extractEntry(tr, hdr, filepath.Join(staged, filepath.FromSlash(rel)))
+		if err != nil {
+			return "", err
+		}
+		entries[rel] = extracted{header: hdr, sha256: sum}
+		order = append(order, rel)
+		if hdr, err = tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("reading %s: %w", archive, err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		return "", err
+	}
+	// Deepest first, so setting a directory's time isn't undone by
+	// writing into it and a read-only directory is filled before
+	for i := len(order) - 1; i >= 0; i-- {
+		hdr := entries[order[i]].header
+		if hdr.Typeflag == tar.TypeSymlink {
+			continue
+		}
+		path := filepath.Join(staged, filepath.FromSlash(order[i]))
+		if err := os.Chmod(path, hdr.FileInfo().Mode().Perm()); err != nil {
+			return "", err
+		}
+		if err := os.Chtimes(path, hdr.ModTime, hdr.ModTime); err != nil {
+			return "", err
+		}
+	}
+	if verify {
+		if err := checkRestored(staged, manifest, entries); err != nil {
+			return "", err
+		}
+	}
+	return dest, os.Rename(staged, fsPath(dest))
+}
+
+// extractEntry writes the entry of hdr to path, returning the checksum of a
+// file.
+func extractEntry(r io.Reader, hdr *tar.Header, path string) (string, error) {
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return "", os.MkdirAll(path, 0o700)
+	case tar.TypeSymlink:
+		return "", os.Symlink(hdr.Linkname, path)
+	case tar.TypeReg:
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.New()
+		_, err = io.Copy(io.MultiWriter(f, sum), r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return fmt.Sprintf("%x", sum.Sum(nil)), err
+	}
+	return "", fmt.Errorf("unsupported entry %s in the archive", hdr.Name)
+}
+
+// checkRestored compares the tree extracted at root with the manifest.
+func checkRestored(root string, m archiveManifest, entries map[string]extracted) error {
+	var problems []string
+	for _, want := range m.Files {
+		got, ok := entries[want.Name]
+		if !ok {
+			problems = append(problems, want.Name+" is missing")
+			continue
+		}
+		delete(entries, want.Name)
+		info, err := os.Lstat(filepath.Join(root, filepath.FromSlash(want.Name)))
+		switch {
+		case err != nil:
+			problems = append(problems, want.Name+": "+errorReason(err))
+		case info.Mode().Type() != want.Mode.Type():
+			problems = append(problems, want.Name+" is of another type")
+		case want.SHA256 != got.sha256:
+			problems = append(problems, want.Name+" has other contents")
+		case want.Link != got.header.Linkname:
+			problems = append(problems, want.Name+" links elsewhere")
+		case runtime.GOOS != "windows" && want.Mode.Type() != fs.ModeSymlink && info.Mode().Perm() != want.Mode.Perm():
+			problems = append(problems, fmt.Sprintf("%s has mode %v instead of %v", want.Name, info.Mode().Perm(), want.Mode.Perm()))
+		case want.Mode.Type() != fs.ModeSymlink && info.ModTime().Sub(want.ModTime).Abs() >= time.Second:
+			problems = append(problems, want.Name+" has another modification time")
+		}
+	}
+	for name := range entries {
+		problems = append(problems, name+" isn't in the manifest")
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if len(problems) > 5 {
+		problems = append(problems[:5], fmt.Sprintf("and %d more", len(problems)-5))
+	}
+	return fmt.Errorf("the archive doesn't match its manifest, nothing was restored: %s", strings.Join(problems, "; "))
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	to := fs.String("to", "", "restore into this directory instead of where the item was archived from")
+	noVerify := fs.Bool("no-verify", false, "restore without checking the archive against its manifest")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy restore [options] <archive | s3://... | gs://...>")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Puts an item archived by --archive back where it was, after checking every")
+		fmt.Fprintln(fs.Output(), "file against the manifest written with the archive. Nothing that exists is")
+		fmt.Fprintln(fs.Output(), "replaced. An archive in object storage is downloaded first.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	archive := fs.Arg(0)
+	if isRemote(archive) {
+		if readOnly {
+			return errReadOnly
+		}
+		local, remove, err := downloadArchive(archive)
+		if err != nil {
+			return err
+		}
+		defer remove()
+		archive = local
+	}
+	var dest string
+	if *to != "" {
+		manifest, err := readManifest(archive)
+		if err != nil && !errors.Is(err, errNoManifest) {
+			return err
+		}
+		name := filepath.Base(manifest.Path)
+		if manifest.Path == "" {
+			// Archives are named after their project and item
+			name = filepath.Base(archive)
+			for _, ext := range archiveExts {
+				name = strings.TrimSuffix(name, ext)
+			}
+		}
+		dest = filepath.Join(expandHome(*to), name)
+	}
+	restored, err := restoreArchive(archive, dest, !*noVerify)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s\n", displayPath(restored))
+	return nil
+}
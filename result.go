@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// runResult is the machine-readable outcome written by --result-file
+type runResult struct {
+	Root string `json:"root"`
+	// Roots lists every root opened in the session when there was more
+	// than one
+	Roots           []string        `json:"roots,omitempty"`
+	StartedAt       time.Time       `json:"startedAt"`
+	FinishedAt      time.Time       `json:"finishedAt"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	FreedBytes      int64           `json:"freedBytes"`
+	Cleaned         []CleanableItem `json:"cleaned"`
+	Failures        []Issue         `json:"failures"`
+	Crashed         bool            `json:"crashed"`
+	Verified        []sizeCheck     `json:"verified,omitempty"`
+}
+
+func newRunResult(m Model, crashed bool) runResult {
+	var failures []Issue
+	for _, issue := range m.issues {
+		if issue.Phase == phaseClean {
+			failures = append(failures, issue)
+		}
+	}
+	// No root yet when the picker was left without choosing one
+	root := m.currentDir
+	if len(m.roots) > 0 {
+		root = m.roots[0]
+	}
+	result := makeRunResult(root, m.sessionStart, m.cleanedSize, m.cleaned, failures, crashed)
+	result.Verified = m.checks
+	if len(m.roots) > 1 {
+		result.Roots = m.roots
+	}
+	return result
+}
+
+func makeRunResult(root string, started time.Time, freed int64, cleaned []CleanableItem, failures []Issue, crashed bool) runResult {
+	finished := time.Now()
+	result := runResult{
+		Root:            root,
+		StartedAt:       started,
+		FinishedAt:      finished,
+		DurationSeconds: finished.Sub(started).Seconds(),
+		FreedBytes:      freed,
+		Cleaned:         cleaned,
+		Failures:        failures,
+		Crashed:         crashed,
+	}
+	if result.Cleaned == nil {
+		result.Cleaned = []CleanableItem{}
+	}
+	if result.Failures == nil {
+		result.Failures = []Issue{}
+	}
+	return result
+}
+
+func writeRunResult(path string, result runResult) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Retention keeps devtidy's own records from growing without bound: with
+// archive_keep only the newest archives of every project are kept in the
+// archive directory, and with history_max_age scans are dropped from the
+// history, and scans, cleans and items not seen since from the index, once
+// they are older. The daemon applies it on every pass, and devtidy gc
+// applies it along with pruning the files devtidy left behind.
+// Archives in object storage are left to the bucket's lifecycle rules.
+
+// expiredFile is a file retention removes.
+type expiredFile struct {
+	path string
+	size int64
+	why  string
+}
+
+// expiredArchives lists the archives in dir beyond the newest keep of their
+// project, with their manifests. Archives are grouped by the project of the
+// item in their manifest; those without one are kept.
+func expiredArchives(dir string, keep int) []expiredFile {
+	if keep <= 0 || dir == "" || isRemote(dir) {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	type archived struct {
+		path    string
+		size    int64
+		created time.Time
+	}
+	byProject := make(map[string][]archived)
+	projects := make(map[string]string)
+	for _, e := range entries {
+		if e.IsDir() || !slices.ContainsFunc(archiveExts, func(ext string) bool { return strings.HasSuffix(e.Name(), ext) }) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		m, err := readManifest(path)
+		if err != nil || m.Path == "" {
+			continue
+		}
+		project := projectOf(m.Path, projects)
+		byProject[project] = append(byProject[project], archived{path: path, size: info.Size(), created: m.Created})
+	}
+	var expired []expiredFile
+	for project, archives := range byProject {
+		slices.SortFunc(archives, func(a, b archived) int { return b.created.Compare(a.created) })
+		for _, a := range archives[min(keep, len(archives)):] {
+			why := "beyond archive_keep for " + displayPath(project)
+			expired = append(expired, expiredFile{path: a.path, size: a.size, why: why})
+			if info, err := os.Stat(a.path + manifestSuffix); err == nil {
+				expired = append(expired, expiredFile{path: a.path + manifestSuffix, size: info.Size(), why: why})
+			}
+		}
+	}
+	slices.SortFunc(expired, func(a, b expiredFile) int { return strings.Compare(a.path, b.path) })
+	return expired
+}
+
+// expiredScans lists the scans of the history older than maxAge.
+func expiredScans(maxAge time.Duration) []expiredFile {
+	if maxAge <= 0 {
+		return nil
+	}
+	dir, err := scanHistoryDir()
+	if err != nil {
+		return nil
+	}
+	names, err := historyFiles(dir)
+	if err != nil {
+		return nil
+	}
+	var expired []expiredFile
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil || time.Since(info.ModTime()) <= maxAge {
+			continue
+		}
+		expired = append(expired, expiredFile{path: name, size: info.Size(), why: "a scan older than history_max_age"})
+	}
+	return expired
+}
+
+// expiredFiles lists everything the retention of the config removes.
+func expiredFiles() []expiredFile {
+	maxAge, _ := parseAge(activeConfig.HistoryMaxAge)
+	return append(expiredArchives(activeConfig.ArchiveDir, activeConfig.ArchiveKeep), expiredScans(maxAge)...)
+}
+
+// applyRetention removes what expiredFiles lists and returns what it
+// removed and the size of it.
+func applyRetention() (removed int, size int64, err error) {
+	if readOnly {
+		return 0, 0, errReadOnly
+	}
+	for _, f := range expiredFiles() {
+		if rmErr := removeFile(f.path); rmErr != nil {
+			if err == nil {
+				err = rmErr
+			}
+			continue
+		}
+		removed++
+		size += f.size
+	}
+	return removed, size, err
+}
+
+// logRetention applies retention for the daemon.
+func logRetention() {
+	removed, size, err := applyRetention()
+	if err != nil {
+		log.Warn("retention failed", "err", err)
+	}
+	if removed > 0 {
+		log.Info("removed expired archives and scans", "files", removed, "bytes", formatSize(size))
+	}
+	if pruned, err := pruneExpiredIndex(); err != nil {
+		log.Warn("couldn't prune the index", "err", err)
+	} else if pruned > 0 {
+		log.Info("pruned the index", "records", pruned)
+	}
+}
+
+// pruneExpiredIndex drops the scans, cleans and items older than
+// history_max_age from the index.
+func pruneExpiredIndex() (int, error) {
+	maxAge, _ := parseAge(activeConfig.HistoryMaxAge)
+	if maxAge <= 0 {
+		return 0, nil
+	}
+	return pruneIndex(time.Now().Add(-maxAge))
+}
+
+func runGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only list what would be removed")
+	addReadOnlyFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy gc [options]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Removes the archives beyond archive_keep per project and the scans older")
+		fmt.Fprintln(fs.Output(), "than history_max_age from the history and the index, as set in the config")
+		fmt.Fprintln(fs.Output(), "file, and what devtidy left behind: temporary files, old crash reports and")
+		fmt.Fprintln(fs.Output(), "fixtures.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	expired := expiredFiles()
+	for _, f := range prunableOwnFiles() {
+		expired = append(expired, expiredFile{path: f.path, size: measureSize(f.path), why: ownFileDescriptions[f.pattern][0]})
+	}
+	var size int64
+	for _, f := range expired {
+		fmt.Printf("%s (%s): %s\n", displayPath(f.path), formatSize(f.size), f.why)
+		size += f.size
+	}
+	if *dryRun || readOnly {
+		fmt.Printf("Would free %s from %d files\n", formatSize(size), len(expired))
+		return nil
+	}
+	var freed int64
+	var failed int
+	for _, f := range expired {
+		if err := removeAll(f.path); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to remove %s: %s\n", displayPath(f.path), errorReason(err))
+			failed++
+			continue
+		}
+		freed += f.size
+	}
+	fmt.Printf("Freed %s from %d files\n", formatSize(freed), len(expired)-failed)
+	if pruned, err := pruneExpiredIndex(); err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't prune the index: %v\n", err)
+	} else if pruned > 0 {
+		fmt.Printf("Pruned %d scans, cleans and items from the index\n", pruned)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files could not be removed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Settings are remembered for every root scanned interactively, keyed by its
+// absolute path, and restored when it is scanned again: the sort order and
+// grouping picked in the list, and the filters and exclusions given on the
+// command line. Flags given again win over what was remembered.
+
+// rootSettingsLimit is how many roots are remembered; the least recently
+// used are forgotten first.
+const rootSettingsLimit = 50
+
+type rootSettings struct {
+	Used time.Time `json:"used"`
+	Sort string    `json:"sort,omitempty"`
+	// Grouped is how grouping by project was saved before grouping by type
+	Grouped   bool     `json:"grouped,omitempty"`
+	Group     string   `json:"group,omitempty"`
+	MinSize   string   `json:"minSize,omitempty"`
+	OlderThan string   `json:"olderThan,omitempty"`
+	Dormant   string   `json:"dormant,omitempty"`
+	Exclude   []string `json:"exclude,omitempty"`
+}
+
+func rootSettingsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "root-settings.json"), nil
+}
+
+// loadRootSettings reads the settings of every remembered root. A missing
+// file means none are remembered.
+func loadRootSettings() (map[string]rootSettings, error) {
+	path, err := rootSettingsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]rootSettings{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]rootSettings)
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// saveRootSettings remembers s for root.
+func saveRootSettings(root string, s rootSettings) error {
+	all, err := loadRootSettings()
+	if err != nil {
+		return err
+	}
+	all[root] = s
+	if len(all) > rootSettingsLimit {
+		roots := make([]string, 0, len(all))
+		for r := range all {
+			roots = append(roots, r)
+		}
+		slices.SortFunc(roots, func(a, b string) int { return all[b].Used.Compare(all[a].Used) })
+		for _, r := range roots[rootSettingsLimit:] {
+			delete(all, r)
+		}
+	}
+
+	path, err := rootSettingsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// overlay returns s with the filters set in given replacing its own.
+func (s rootSettings) overlay(given rootSettings) rootSettings {
+	if given.MinSize != "" {
+		s.MinSize = given.MinSize
+	}
+	if given.OlderThan != "" {
+		s.OlderThan = given.OlderThan
+	}
+	if given.Dormant != "" {
+		s.Dormant = given.Dormant
+	}
+	if given.Exclude != nil {
+		s.Exclude = given.Exclude
+	}
+	return s
+}
+
+// apply sets the filters of s in opts. They were checked when given as
+// flags, so values that don't parse any more are left out.
+func (s rootSettings) apply(opts scanOptions) scanOptions {
+	if n, err := parseSize(s.MinSize); err == nil && s.MinSize != "" {
+		opts.minSize = n
+	}
+	if d, err := parseAge(s.OlderThan); err == nil && s.OlderThan != "" {
+		opts.olderThan = d
+	}
+	if d, err := parseAge(s.Dormant); err == nil && s.Dormant != "" {
+		opts.dormant = d
+	}
+	opts.exclude = s.Exclude
+	return opts
+}
+
+// restoreRoot picks up the settings remembered for dir before it is
+// scanned. Without any, the sort order and grouping stay as they are.
+func (m Model) restoreRoot(dir string) Model {
+	all, _ := loadRootSettings()
+	saved, ok := all[dir]
+	m.rootSettings = saved.overlay(m.baseOpts.given)
+	m.opts = m.rootSettings.apply(m.baseOpts)
+	if !ok {
+		return m
+	}
+	if i := slices.Index(sortOrderNames, saved.Sort); i >= 0 {
+		m.sortOrder = sortOrder(i)
+	}
+	m.grouping = groupNone
+	if i := slices.Index(groupingNames, saved.Group); i >= 0 {
+		m.grouping = grouping(i)
+	} else if saved.Grouped {
+		m.grouping = groupByProject
+	}
+	m.statusMsg = "Restored the settings used here last time"
+	return m
+}
+
+// rememberRootSettings saves the settings of the current root. Losing them is
+// harmless, so errors are ignored.
+func (m Model) rememberRootSettings() {
+	if m.opts.snapshot != nil || len(m.roots) == 0 {
+		return
+	}
+	s := m.rootSettings
+	s.Used = time.Now()
+	s.Sort = m.sortOrder.String()
+	s.Grouped = false
+	s.Group = m.grouping.String()
+	saveRootSettings(m.currentDir, s)
+}
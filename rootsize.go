@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Both messages name their root so results for a root that was left in the
+// meantime are dropped.
+type rootSizeMsg struct {
+	root string
+	size int64
+}
+
+type freeSpaceMsg struct {
+	root string
+	free uint64
+	ok   bool
+}
+
+// measureRoot sizes the whole scan root alongside the scan so results can be
+// put in context. Several roots scanned together are measured as one, named
+// by the first.
+func measureRoot(roots ...string) tea.Cmd {
+	return func() tea.Msg {
+		var size int64
+		for _, root := range roots {
+			size += getDirectorySizeFast(root)
+		}
+		return rootSizeMsg{root: roots[0], size: size}
+	}
+}
+
+func checkFreeSpace(root string) tea.Cmd {
+	return func() tea.Msg {
+		free, ok := freeSpace(root)
+		return freeSpaceMsg{root: root, free: free, ok: ok}
+	}
+}
+
+// rootSummary describes the scan root, e.g.
+// "root 412 GB, 9% reclaimable, 50 GB free".
+func (m Model) rootSummary() string {
+	root := "root"
+	if len(m.targets) > 1 {
+		root = fmt.Sprintf("%d roots", len(m.targets))
+	}
+	var summary string
+	if m.rootSize < 0 {
+		summary = root + " size pending"
+	} else {
+		// The root shrinks by whatever was cleaned since it was measured
+		size := max(m.rootSize-m.rootFreed, 0)
+		summary = root + " " + formatSize(size)
+		if size > 0 {
+			summary += fmt.Sprintf(", %.0f%% reclaimable", float64(m.items.TotalSize())/float64(size)*100)
+		}
+	}
+	if m.freeSpaceKnown {
+		summary += ", " + formatSize(int64(m.freeSpace)) + " free"
+	}
+	return summary
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// A triage done once can be kept as rules in .devtidy.toml at the root of a
+// repository, for later runs and for whoever else cleans a checkout of it.
+// Items kept are never listed again and items cleaned are selected when
+// they come back. The rules are paths and globs relative to the file,
+// matched like exclusions.
+
+const repoRulesFile = ".devtidy.toml"
+
+type repoRules struct {
+	Keep  []string `toml:"keep"`
+	Clean []string `toml:"clean"`
+}
+
+// loadRepoRules reads the rules at the root of a scan. A missing file means
+// there are none.
+func loadRepoRules(root string) (repoRules, error) {
+	var r repoRules
+	path := filepath.Join(root, repoRulesFile)
+	if _, err := os.Stat(fsPath(path)); os.IsNotExist(err) {
+		return r, nil
+	}
+	if _, err := toml.DecodeFile(fsPath(path), &r); err != nil {
+		return r, fmt.Errorf("invalid rules %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// absolute turns rules into patterns for matchPath below root.
+func absolute(root string, rules []string) []string {
+	patterns := make([]string, len(rules))
+	for i, rule := range rules {
+		patterns[i] = filepath.Join(root, filepath.FromSlash(rule))
+	}
+	return patterns
+}
+
+// pathRules matches items whose path matches one of the patterns.
+type pathRules []string
+
+func (r pathRules) match(item CleanableItem, _ time.Time) bool {
+	_, ok := matchPath(r, item.Path)
+	return ok
+}
+
+// preselect adds the clean rules of root to expr, which may be nil.
+func (r repoRules) preselect(root string, expr queryExpr) queryExpr {
+	if len(r.Clean) == 0 {
+		return expr
+	}
+	rules := pathRules(absolute(root, r.Clean))
+	if expr == nil {
+		return rules
+	}
+	return orExpr{expr, rules}
+}
+
+// record turns the decisions about the items below root into rules: the
+// selected ones are cleaned, and those deselected by hand or pinned are
+// kept. Items nobody decided on are left out, so saving after a partial
+// triage doesn't hide them. Earlier rules for the same paths are replaced
+// and the rest stay.
+func (r repoRules) record(root string, items []CleanableItem) (repoRules, int) {
+	count := 0
+	for _, item := range items {
+		rel, err := filepath.Rel(root, item.Path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") || isDockerPath(item.Path) {
+			continue
+		}
+		if !item.Selected && !item.Kept && !item.Pinned {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		r.Keep = slices.DeleteFunc(r.Keep, func(s string) bool { return s == rel })
+		r.Clean = slices.DeleteFunc(r.Clean, func(s string) bool { return s == rel })
+		if item.Selected {
+			r.Clean = append(r.Clean, rel)
+		} else {
+			r.Keep = append(r.Keep, rel)
+		}
+		count++
+	}
+	slices.Sort(r.Keep)
+	slices.Sort(r.Clean)
+	return r, count
+}
+
+// saveRepoRules writes rules to the root of a scan.
+func saveRepoRules(root string, r repoRules) error {
+	var b bytes.Buffer
+	b.WriteString("# devtidy rules: paths and globs relative to this directory.\n")
+	b.WriteString("# keep is never listed, clean is selected when found.\n")
+	if err := toml.NewEncoder(&b).Encode(r); err != nil {
+		return err
+	}
+	return os.WriteFile(fsPath(filepath.Join(root, repoRulesFile)), b.Bytes(), 0o644)
+}
+
+// exportRules records the selection of the current root in its rules file.
+func (m Model) exportRules() Model {
+	if m.opts.snapshot != nil {
+		m.statusMsg = errorStyle.Render("A snapshot's selection can't be exported as rules")
+		return m
+	}
+	rules, err := loadRepoRules(m.currentDir)
+	if err != nil {
+		m.statusMsg = errorStyle.Render(err.Error())
+		return m
+	}
+	rules, count := rules.record(m.currentDir, m.items.All())
+	if count == 0 {
+		m.statusMsg = "No items below " + displayPath(m.currentDir) + " were selected, deselected or pinned to export"
+		return m
+	}
+	if err := saveRepoRules(m.currentDir, rules); err != nil {
+		m.statusMsg = errorStyle.Render("Failed to export rules: " + err.Error())
+		return m
+	}
+	m.statusMsg = successStyle.Render(fmt.Sprintf("Saved %d decisions to %s",
+		count, displayPath(filepath.Join(m.currentDir, repoRulesFile))))
+	return m
+}
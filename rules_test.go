@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRepoRulesRecord(t *testing.T) {
+	root := filepath.FromSlash("/work/app")
+	at := func(rel string) string { return filepath.Join(root, filepath.FromSlash(rel)) }
+	rules := repoRules{Keep: []string{"web/dist", "vendor"}, Clean: []string{"target"}}
+	items := []CleanableItem{
+		{Path: at("web/dist"), Selected: true},
+		{Path: at("target"), Kept: true},
+		{Path: at("node_modules"), Selected: true},
+		{Path: at("tools/cache"), Pinned: true},
+		// Undecided, so neither kept nor its clean rule dropped
+		{Path: at("build")},
+		{Path: at("vendor")},
+		{Path: filepath.FromSlash("/work/other/build"), Selected: true},
+		{Path: root, Selected: true},
+	}
+
+	got, count := rules.record(root, items)
+	if count != 4 {
+		t.Errorf("record counted %d decisions, want 4", count)
+	}
+	if want := []string{"target", "tools/cache", "vendor"}; !slices.Equal(got.Keep, want) {
+		t.Errorf("keep = %v, want %v", got.Keep, want)
+	}
+	if want := []string{"node_modules", "web/dist"}; !slices.Equal(got.Clean, want) {
+		t.Errorf("clean = %v, want %v", got.Clean, want)
+	}
+}
+
+func TestRepoRulesPreselect(t *testing.T) {
+	root := filepath.FromSlash("/work/app")
+	rules := repoRules{Clean: []string{"**/dist"}}
+	expr := rules.preselect(root, nil)
+	for path, want := range map[string]bool{
+		"/work/app/web/dist":   true,
+		"/work/app/dist":       true,
+		"/work/other/web/dist": false,
+		"/work/app/build":      false,
+	} {
+		if got := expr.match(CleanableItem{Path: filepath.FromSlash(path)}, time.Now()); got != want {
+			t.Errorf("preselect matched %s = %v, want %v", path, got, want)
+		}
+	}
+	if (repoRules{}).preselect(root, nil) != nil {
+		t.Error("preselect without clean rules isn't nil")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Directories inside a runner's _work dir that belong to the runner itself
+var runnerInternalDirs = map[string]bool{
+	"_actions":          true,
+	"_temp":             true,
+	"_tool":             true,
+	"_PipelineMapping":  true,
+	"_update":           true,
+	"_diag":             true,
+	"_gitHubActionsTmp": true,
+}
+
+type runnerOptions struct {
+	workDir           string
+	toolCache         string
+	currentWorkspace  string
+	keepLatestPerTool bool
+	// inJob is set when running as a step of a job, whose actions and temp
+	// files are still in use
+	inJob bool
+}
+
+// runnerOptionsFromEnv fills in the layout of the runner executing the job.
+func runnerOptionsFromEnv(workDir string) runnerOptions {
+	opts := runnerOptions{
+		workDir:          workDir,
+		toolCache:        os.Getenv("RUNNER_TOOL_CACHE"),
+		currentWorkspace: os.Getenv("RUNNER_WORKSPACE"),
+		inJob:            os.Getenv("GITHUB_ACTIONS") != "" || os.Getenv("RUNNER_TEMP") != "",
+	}
+	if opts.workDir == "" && opts.currentWorkspace != "" {
+		opts.workDir = filepath.Dir(opts.currentWorkspace)
+	}
+	if opts.toolCache == "" && opts.workDir != "" {
+		opts.toolCache = filepath.Join(opts.workDir, "_tool")
+	}
+	return opts
+}
+
+// detectRunnerItems finds caches and job leftovers on a self-hosted runner:
+// tool cache versions, downloaded actions, temp files (including
+// actions/cache archives) and workspaces of other jobs. Downloaded actions
+// and temp files are left alone inside a job, which may still need them.
+func detectRunnerItems(opts runnerOptions) []CleanableItem {
+	var items []CleanableItem
+	add := func(path, pattern, desc string) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		items = append(items, CleanableItem{
+			Path:    path,
+			Type:    desc,
+			Pattern: pattern,
+			ModTime: info.ModTime(),
+			Info:    desc,
+		})
+	}
+
+	items = append(items, detectToolCache(opts.toolCache, opts.keepLatestPerTool)...)
+
+	if !opts.inJob {
+		forEachDir(filepath.Join(opts.workDir, "_actions"), func(owner string) {
+			forEachDir(owner, func(repo string) {
+				add(repo, "gha-action", "Downloaded action "+filepath.Base(owner)+"/"+filepath.Base(repo))
+			})
+		})
+		forEachEntry(filepath.Join(opts.workDir, "_temp"), func(path string) {
+			add(path, "gha-temp", "Runner temp files")
+		})
+	}
+	forEachDir(opts.workDir, func(path string) {
+		if runnerInternalDirs[filepath.Base(path)] || samePath(path, opts.currentWorkspace) {
+			return
+		}
+		add(path, "gha-workspace", "Workspace left over from a previous job")
+	})
+	return items
+}
+
+// detectToolCache lists tool versions laid out as <cache>/<tool>/<version>.
+func detectToolCache(toolCache string, keepLatest bool) []CleanableItem {
+	var items []CleanableItem
+	forEachDir(toolCache, func(tool string) {
+		var versions []string
+		forEachDir(tool, func(version string) {
+			versions = append(versions, version)
+		})
+		sort.Slice(versions, func(i, j int) bool {
+			return compareVersions(filepath.Base(versions[i]), filepath.Base(versions[j])) > 0
+		})
+		if keepLatest && len(versions) > 0 {
+			versions = versions[1:]
+		}
+		for _, version := range versions {
+			desc := fmt.Sprintf("Tool cache %s %s", filepath.Base(tool), filepath.Base(version))
+			items = append(items, CleanableItem{
+				Path:    version,
+				Type:    desc,
+				Pattern: "gha-tool",
+				ModTime: modTimeOf(version),
+				Info:    desc,
+			})
+		}
+	})
+	return items
+}
+
+func forEachEntry(dir string, fn func(path string)) {
+	if dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		fn(filepath.Join(dir, e.Name()))
+	}
+}
+
+func forEachDir(dir string, fn func(path string)) {
+	forEachEntry(dir, func(path string) {
+		if info, err := os.Lstat(path); err == nil && info.IsDir() {
+			fn(path)
+		}
+	})
+}
+
+func modTimeOf(path string) (t time.Time) {
+	if info, err := os.Stat(path); err == nil {
+		t = info.ModTime()
+	}
+	return t
+}
+
+func samePath(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// compareVersions orders version strings like 1.21.5 and 3.11.0-rc1 by their
+// numeric components, falling back to plain string comparison.
+func compareVersions(a, b string) int {
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	}
+	pa, pb := split(a), split(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, _ := strconv.Atoi(pa[i])
+		nb, _ := strconv.Atoi(pb[i])
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	if len(pa) != len(pb) {
+		if len(pa) < len(pb) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func runRunnerCleanup(args []string) error {
+	fs := flag.NewFlagSet("runner-cleanup", flag.ExitOnError)
+	keepLatest := fs.Bool("keep-latest-per-tool", false, "keep the newest cached version of every tool")
+	dryRun := fs.Bool("dry-run", false, "only list what would be removed")
+	addReadOnlyFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy runner-cleanup [options] [runner work directory]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Removes tool cache versions, downloaded actions, runner temp files and")
+		fmt.Fprintln(fs.Output(), "workspaces of other jobs on a self-hosted GitHub Actions runner. Run it from")
+		fmt.Fprintln(fs.Output(), "the runner's job-completed hook; the work directory defaults to the parent of")
+		fmt.Fprintln(fs.Output(), "$RUNNER_WORKSPACE. Run as a step of a job, with $GITHUB_ACTIONS or $RUNNER_TEMP")
+		fmt.Fprintln(fs.Output(), "set, it leaves the downloaded actions and temp files the job still uses.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts := runnerOptionsFromEnv(fs.Arg(0))
+	opts.keepLatestPerTool = *keepLatest
+	if opts.workDir == "" {
+		return errors.New("no runner work directory given and $RUNNER_WORKSPACE is not set")
+	}
+
+	return cleanDetected(opts.workDir, detectRunnerItems(opts), *dryRun, removeAll)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// scanProgress counts the directories the walk has read and the items it
+// has found, and remembers the last directory, so the UI can show how far a
+// scan has got. The walkers update it concurrently.
+type scanProgress struct {
+	dirs    atomic.Int64
+	items   atomic.Int64
+	current atomic.Pointer[string]
+}
+
+// visit records that dir was read. A nil progress records nothing.
+func (p *scanProgress) visit(dir string) {
+	if p == nil {
+		return
+	}
+	p.dirs.Add(1)
+	p.current.Store(&dir)
+}
+
+// found records n items found, before the filters applied once the walk is
+// done.
+func (p *scanProgress) found(n int) {
+	if p != nil {
+		p.items.Add(int64(n))
+	}
+}
+
+// lastDir is the directory read last, or "" before the first.
+func (p *scanProgress) lastDir() string {
+	if p == nil {
+		return ""
+	}
+	if dir := p.current.Load(); dir != nil {
+		return *dir
+	}
+	return ""
+}
+
+func (p *scanProgress) visited() int {
+	if p == nil {
+		return 0
+	}
+	return int(p.dirs.Load())
+}
+
+// scanningView shows the scan in progress: where it is, how many
+// directories it has read and what it has found so far.
+func (m Model) scanningView() string {
+	var walked *scanProgress
+	if m.stream != nil {
+		walked = &m.stream.progress
+	}
+	h, _ := docStyle.GetFrameSize()
+	width := max(m.windowWidth-h-len("Current: "), 20)
+	roots := make([]string, len(m.targets))
+	for i, root := range m.targets {
+		roots[i] = displayPath(root)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s Scanning for cleanable items...\n\n", m.spinner.View())
+	fmt.Fprintf(&b, "Directory: %s\n", strings.Join(roots, ", "))
+	if dir := walked.lastDir(); dir != "" {
+		fmt.Fprintf(&b, "Current: %s\n", truncatePath(displayPath(dir), width))
+	}
+	fmt.Fprintf(&b, "Elapsed: %v\n", time.Since(m.scanStartTime).Round(time.Millisecond))
+	fmt.Fprintf(&b, "Directories: %s\n", groupDigits(walked.visited()))
+	found := m.scannedItems
+	if walked != nil {
+		found = max(found, int(walked.items.Load()))
+	}
+	fmt.Fprintf(&b, "Items found: %d", found)
+	if size := m.items.TotalSize(); size > 0 {
+		fmt.Fprintf(&b, " (%s sized so far)", formatSize(size))
+	}
+	if m.stream.stopped() {
+		b.WriteString("\n\nStopping the scan...")
+	} else {
+		b.WriteString("\n\nesc: stop and list what was found " + symbols.bullet + " q: quit")
+	}
+	return docStyle.Render(b.String())
+}
+
+// scanningStatus describes the scan going on behind the list.
+func (m Model) scanningStatus() string {
+	return fmt.Sprintf("%s Scanning: %v, %s directories (%d items, %s so far)",
+		m.spinner.View(),
+		time.Since(m.scanStartTime).Round(time.Second),
+		groupDigits(m.stream.progress.visited()),
+		m.scannedItems,
+		formatSize(m.items.TotalSize()),
+	)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// devtidy leaves files of its own behind: crash reports, the scan history,
+// temporary files of writes that were cut short, archives a clean was
+// interrupted in the middle of and fixtures made by devtidy devgen. The
+// devtidy group lists them, and every run prunes those that are clearly
+// abandoned, so the cleaner never becomes clutter itself.
+
+const (
+	devtidyCrashPattern   = "devtidy-crash-report"
+	devtidyHistoryPattern = "devtidy-scan-history"
+	devtidyTempPattern    = "devtidy-temp"
+	devtidyFixturePattern = "devtidy-fixture"
+)
+
+// partialSuffix marks an archive being written; see archiveItem.
+const partialSuffix = ".partial"
+
+const (
+	// tempAge is when a temporary file is no longer being written
+	tempAge = time.Hour
+	// crashReportAge and fixtureAge are when crash reports and fixtures
+	// are pruned
+	crashReportAge = 30 * 24 * time.Hour
+	fixtureAge     = 7 * 24 * time.Hour
+)
+
+// ownFile is a file or directory devtidy left behind.
+type ownFile struct {
+	path    string
+	pattern string
+	modTime time.Time
+	// size is that of a file; directories are sized like other items
+	size int64
+}
+
+// ownFiles lists what devtidy left behind. Temporary files are only listed
+// once they are older than tempAge, so no write in progress is touched.
+func ownFiles() []ownFile {
+	var files []ownFile
+	add := func(dir string, pattern string, match func(name string) bool) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			if !match(e.Name()) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			if pattern == devtidyTempPattern && time.Since(info.ModTime()) < tempAge {
+				continue
+			}
+			f := ownFile{path: filepath.Join(dir, e.Name()), pattern: pattern, modTime: info.ModTime()}
+			if !info.IsDir() {
+				f.size = info.Size()
+			}
+			files = append(files, f)
+		}
+	}
+	isTemp := func(name string) bool { return strings.HasSuffix(name, ".tmp") }
+	if dir, err := cacheDir(); err == nil {
+		add(dir, devtidyCrashPattern, func(name string) bool {
+			return strings.HasPrefix(name, "crash-") && strings.HasSuffix(name, ".json")
+		})
+		add(dir, devtidyTempPattern, isTemp)
+		add(filepath.Join(dir, "history"), devtidyTempPattern, isTemp)
+		add(dir, devtidyHistoryPattern, func(name string) bool { return name == "history" })
+		// left by archives to or from object storage
+		add(filepath.Join(dir, "staging"), devtidyTempPattern, func(name string) bool {
+			return strings.HasPrefix(name, "archive-")
+		})
+	}
+	if dir, _, err := stateDir(); err == nil {
+		// left by writeStateFile, as .pins.123456
+		add(dir, devtidyTempPattern, func(name string) bool {
+			i := strings.LastIndex(name, ".")
+			return strings.HasPrefix(name, ".") && i > 0 && isDigits(name[i+1:])
+		})
+	}
+	if activeConfig.ArchiveDir != "" && !isRemote(activeConfig.ArchiveDir) {
+		add(activeConfig.ArchiveDir, devtidyTempPattern, func(name string) bool {
+			return slices.ContainsFunc(archiveExts, func(ext string) bool {
+				return strings.HasSuffix(name, ext+partialSuffix)
+			})
+		})
+	}
+	add(os.TempDir(), devtidyFixturePattern, func(name string) bool {
+		return strings.HasPrefix(name, "devtidy-fixture-")
+	})
+	return files
+}
+
+var ownFileDescriptions = map[string][2]string{
+	devtidyCrashPattern: {"devtidy crash report",
+		"Written when devtidy crashed, for a bug report; pruned after 30 days"},
+	devtidyHistoryPattern: {"devtidy scan history",
+		"The scans devtidy growth compares; the next scan starts it again"},
+	devtidyTempPattern: {"devtidy temporary file",
+		"Left by a write or an archive that was cut short; pruned after a day"},
+	devtidyFixturePattern: {"devtidy devgen fixture",
+		"A test project made by devtidy devgen fixture; pruned after 7 days"},
+}
+
+// detectOwnFiles lists what devtidy left behind as items.
+func detectOwnFiles() []CleanableItem {
+	var items []CleanableItem
+	for _, f := range ownFiles() {
+		if activeConfig.excluded(f.path) {
+			continue
+		}
+		desc := ownFileDescriptions[f.pattern]
+		items = append(items, CleanableItem{
+			Path:    f.path,
+			Type:    desc[0],
+			Pattern: f.pattern,
+			ModTime: f.modTime,
+			Size:    f.size,
+			Info:    desc[1],
+		})
+	}
+	return items
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// prunableOwnFiles lists what devtidy left behind and nobody needs any
+// more: temporary files older than a day, crash reports older than
+// crashReportAge and fixtures older than fixtureAge.
+func prunableOwnFiles() []ownFile {
+	var prunable []ownFile
+	for _, f := range ownFiles() {
+		age := time.Since(f.modTime)
+		switch {
+		case f.pattern == devtidyTempPattern && age > 24*time.Hour,
+			f.pattern == devtidyCrashPattern && age > crashReportAge,
+			f.pattern == devtidyFixturePattern && age > fixtureAge:
+			prunable = append(prunable, f)
+		}
+	}
+	return prunable
+}
+
+// pruneOwnFiles removes what prunableOwnFiles lists. It is best effort.
+func pruneOwnFiles() {
+	for _, f := range prunableOwnFiles() {
+		removeAll(f.path)
+	}
+}
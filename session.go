@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// A session can go through several roots: O opens another directory, which
+// is scanned, selected from and cleaned like the first, while the bytes
+// freed keep adding up for the whole session.
+
+func (m Model) openRootPrompt() (Model, tea.Cmd) {
+	if m.opts.snapshot != nil {
+		m.statusMsg = errorStyle.Render("A snapshot can't open other directories")
+		return m, nil
+	}
+	m.statusMsg = ""
+	m.openingRoot = true
+	m.command.Prompt = "open: "
+	m.command.Placeholder = "directory to scan next"
+	m.command.SetValue("")
+	m.commandActive = true
+	return m, m.command.Focus()
+}
+
+// submitRoot checks the typed directory and opens it.
+func (m Model) submitRoot() (Model, tea.Cmd) {
+	m = m.closeCommand()
+	dir := expandHome(m.command.Value())
+	if dir == "" {
+		return m, nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		m.statusMsg = errorStyle.Render("Not a directory: " + dir)
+		return m, nil
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return m.openRoot(dir)
+}
+
+// openRoot starts scanning dir, dropping everything known about the current
+// root except what was cleaned and which deletions failed.
+func (m Model) openRoot(dir string) (Model, tea.Cmd) {
+	m.rememberRootSettings()
+	var failures []Issue
+	for _, issue := range m.issues {
+		if issue.Phase == phaseClean {
+			failures = append(failures, issue)
+		}
+	}
+
+	if m.stream != nil {
+		m.stream.cancel()
+	}
+	m.state = stateScanning
+	m.stream = newScanStream()
+	m.partialScan = false
+	m.currentDir = dir
+	m.targets = []string{dir}
+	m.roots = append(m.roots, dir)
+	m.items = newItemSet(nil)
+	m.issues = failures
+	m.scanStartTime = time.Now()
+	m.scannedItems = 0
+	m.rootSize = -1
+	m.rootFreed = 0
+	m.freeSpaceKnown = false
+	m.unsized = make(map[string]bool)
+	m.sizing = make(map[string]bool)
+	m.recentlySelected = nil
+	m.totalSizeJobs, m.completedSizeJobs = 0, 0
+	m.calculatingSizes = false
+	m.projects = make(map[string]string)
+	m.previews = make(map[string]previewMsg)
+	m.visual, m.count = false, 0
+	m.list.ResetFilter()
+	m.list.ResetSelected()
+	m.statusMsg = ""
+	m = m.restoreRoot(dir)
+
+	return m, tea.Batch(
+		m.refreshList(),
+		m.spinner.Tick,
+		scanForCleanableItems(m.stream, m.targets, m.opts),
+		measureRoot(dir),
+		checkFreeSpace(dir),
+	)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Static site generators, packaging tools and some indexers write to
+// directories with names as common as public, site or src, so those patterns
+// only match where the tool puts them, like next to the generator's config
+// file.
+var patternGates = map[string]func(project string) bool{
+	// Hugo and Gatsby
+	"public": func(project string) bool {
+		return isHugoSite(project) || anyExists(project, "gatsby-config.js", "gatsby-config.ts", "gatsby-config.mjs")
+	},
+	"_site": func(project string) bool { return anyExists(project, "_config.yml", "_config.yaml") },
+	".cache": func(project string) bool {
+		return anyExists(project, "gatsby-config.js", "gatsby-config.ts", "gatsby-config.mjs")
+	},
+	"site": func(project string) bool { return anyExists(project, "mkdocs.yml", "mkdocs.yaml") },
+
+	// clangd indexes into .cache/clangd and rust-analyzer builds into
+	// target/rust-analyzer; elsewhere those names are likely sources
+	"clangd":        inDirNamed(".cache"),
+	"rust-analyzer": inDirNamed("target"),
+
+	"Pods": isCocoaPodsProject,
+
+	// Linux packaging
+	"parts": isSnapcraftProject,
+	"stage": isSnapcraftProject,
+	"prime": isSnapcraftProject,
+	"cache": isSnapcraftCache,
+	"src":   isMakepkgBuild,
+	"pkg":   isMakepkgBuild,
+}
+
+// isHugoSite recognizes hugo.toml and friends, or the config.toml of older
+// sites next to the directories `hugo new site` creates.
+func isHugoSite(project string) bool {
+	if anyExists(project, "hugo.toml", "hugo.yaml", "hugo.json") {
+		return true
+	}
+	return anyExists(project, "config.toml", "config.yaml", "config.json") &&
+		anyExists(project, "archetypes", "layouts", "themes")
+}
+
+func anyExists(dir string, names ...string) bool {
+	for _, name := range names {
+		if _, err := os.Stat(fsPath(filepath.Join(dir, name))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// gateAllows reports whether the directory at path may match pat, which is
+// always the case for patterns without a gate.
+func gateAllows(pat, path string) bool {
+	gate, ok := patternGates[pat]
+	return !ok || gate(filepath.Dir(path))
+}
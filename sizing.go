@@ -0,0 +1,84 @@
+package main
+
+import (
+	"runtime"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The list is shown as soon as the scan finds the first items and sizes fill
+// in while the user browses. Only a few items are sized at a time, and every
+// free slot goes to the item the user most likely wants to know about: one
+// they just selected, then one on the page they are looking at, then the
+// rest in list order.
+
+// recentSelections is how many selected paths are remembered for sizing.
+const recentSelections = 16
+
+func sizeWorkers() int {
+	return max(runtime.NumCPU()/2, 2)
+}
+
+// noteSelected moves path to the front of the recently selected paths.
+func (m *Model) noteSelected(path string) {
+	if !m.unsized[path] {
+		return
+	}
+	recent := slices.DeleteFunc(m.recentlySelected, func(p string) bool { return p == path })
+	m.recentlySelected = append([]string{path}, recent...)
+	if len(m.recentlySelected) > recentSelections {
+		m.recentlySelected = m.recentlySelected[:recentSelections]
+	}
+}
+
+// nextSizeJobs starts sizing items until every worker is busy.
+func (m *Model) nextSizeJobs() tea.Cmd {
+	var cmds []tea.Cmd
+	for len(m.sizing) < sizeWorkers() {
+		path, ok := m.nextToSize()
+		if !ok {
+			break
+		}
+		m.sizing[path] = true
+		cmds = append(cmds, calculateSingleSize(path))
+	}
+	return tea.Batch(cmds...)
+}
+
+// nextToSize picks the unsized item to size next.
+func (m *Model) nextToSize() (string, bool) {
+	waiting := func(path string) bool { return m.unsized[path] && !m.sizing[path] }
+
+	for _, path := range m.recentlySelected {
+		if waiting(path) {
+			return path, true
+		}
+	}
+
+	visible := m.list.VisibleItems()
+	start, end := m.list.Paginator.GetSliceBounds(len(visible))
+	for _, listItem := range visible[start:end] {
+		if item, ok := listItem.(CleanableItem); ok && waiting(item.Path) {
+			return item.Path, true
+		}
+	}
+
+	for _, item := range m.items.All() {
+		if waiting(item.Path) {
+			return item.Path, true
+		}
+	}
+	return "", false
+}
+
+// selectionUnsized reports whether a selected item is still being sized, so
+// cleaning it now would be checked against the policy with a wrong size.
+func (m Model) selectionUnsized() bool {
+	for _, item := range m.items.Selected() {
+		if m.unsized[item.Path] {
+			return true
+		}
+	}
+	return false
+}
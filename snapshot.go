@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// loadSnapshot feeds a saved scan to the model in place of a fresh scan,
+// preselecting the plan if the snapshot carries one.
+func loadSnapshot(record *scanRecord) tea.Cmd {
+	return func() tea.Msg {
+		plan := make(map[string]bool, len(record.Plan))
+		for _, path := range record.Plan {
+			plan[path] = true
+		}
+		items := activePolicy.filter(append([]CleanableItem(nil), record.Items...))
+		for i := range items {
+			items[i].Selected = plan[items[i].Path]
+		}
+		return scanCompleteMsg{items: items}
+	}
+}
+
+// savePlan writes the selected items as a plan instead of deleting them, for
+// snapshots reviewed away from the host they were taken on.
+func (m Model) savePlan() Model {
+	record := *m.opts.snapshot
+	record.Plan = nil
+	for _, item := range m.items.Selected() {
+		record.Plan = append(record.Plan, item.Path)
+	}
+	if err := writeScanRecord(m.opts.planPath, record); err != nil {
+		m.statusMsg = errorStyle.Render("Could not save plan: " + err.Error())
+		return m
+	}
+	m.statusMsg = successStyle.Render(fmt.Sprintf(
+		"Saved a plan with %d items to %s; run devtidy load on %s to apply it",
+		len(record.Plan), m.opts.planPath, record.Host))
+	return m
+}
+
+// defaultPlanPath derives snap.plan.json from snap.json.
+func defaultPlanPath(snapshot string) string {
+	return strings.TrimSuffix(snapshot, filepath.Ext(snapshot)) + ".plan.json"
+}
+
+func runScan(args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	save := fs.String("save", "", "write the scan results to this file")
+	gitignore := fs.Bool("gitignore", false, "scan files matching .gitignore patterns")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy scan [options] [directory]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Scans without the interactive UI. With --save the results are written as a")
+		fmt.Fprintln(fs.Output(), "snapshot that devtidy load can review on this or another machine.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	targetDir := resolveTargetDir(fs.Args())
+	if *gitignore {
+		requireGitignore(targetDir)
+	}
+
+	items, _ := scanAndSize(targetDir, scanOptions{
+		useGitignore: *gitignore,
+	})
+
+	// Best effort, like in the UI: it only feeds query and growth
+	writeLastScan(newScanRecord(targetDir, items))
+	if *save == "" {
+		return writeItems(os.Stdout, items, formatText)
+	}
+	if err := writeScanRecord(*save, newScanRecord(targetDir, items)); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d items to %s\n", len(items), *save)
+	return nil
+}
+
+func runLoad(args []string) error {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	planFlag := fs.String("plan", "", "save the selection as a plan to this file instead of cleaning")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy load [options] <snapshot>")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Opens a snapshot from devtidy scan --save for review. On the host it was")
+		fmt.Fprintln(fs.Output(), "taken on, c cleans as usual. Elsewhere, c saves the selection as a plan")
+		fmt.Fprintln(fs.Output(), "(snapshot.plan.json by default) to load and apply on the original host.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	record, err := readScanRecord(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	planPath := *planFlag
+	if planPath == "" && record.Host != hostname() {
+		planPath = defaultPlanPath(fs.Arg(0))
+	}
+
+	if detectASCII() {
+		useASCII()
+	}
+	runInteractive(initialModel([]string{record.Root}, scanOptions{
+		snapshot: &record,
+		planPath: planPath,
+	}), runOutputs{})
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
+)
+
+// Deleting more than confirm_size or from more than confirm_projects projects
+// at once takes typing the size instead of a single key, so a stray select
+// all can't wipe a disk. Moving to the trash can be undone and isn't
+// limited.
+
+const (
+	defaultConfirmSize     = 100 << 30
+	defaultConfirmProjects = 20
+)
+
+// confirmSize is the size above which a clean needs a typed confirmation;
+// 0 turns the check off.
+func (c config) confirmSize() int64 {
+	if c.ConfirmSize == "" {
+		return defaultConfirmSize
+	}
+	n, _ := parseSize(c.ConfirmSize)
+	return n
+}
+
+// confirmProjects is the number of projects above which a clean needs a
+// typed confirmation; 0 turns the check off.
+func (c config) confirmProjects() int {
+	if c.ConfirmProjects == nil {
+		return defaultConfirmProjects
+	}
+	return *c.ConfirmProjects
+}
+
+// softLimit tells why deleting items needs a typed confirmation and what to
+// type, which is their total size.
+func softLimit(items []CleanableItem) (text, reason string, ok bool) {
+	var total int64
+	projects := make(map[string]bool)
+	cache := make(map[string]string)
+	for _, item := range items {
+		total += item.Size
+		projects[projectOf(item.Path, cache)] = true
+	}
+	switch size, count := activeConfig.confirmSize(), activeConfig.confirmProjects(); {
+	case size > 0 && total > size:
+		reason = fmt.Sprintf("This deletes %s, more than %s", formatSize(total), formatSize(size))
+	case count > 0 && len(projects) > count:
+		reason = fmt.Sprintf("This deletes from %d projects, more than %d", len(projects), count)
+	default:
+		return "", "", false
+	}
+	return strings.ReplaceAll(formatSize(total), " ", ""), reason, true
+}
+
+// underSoftLimit keeps the items, in order, up to the limits of softLimit,
+// for cleans nobody is there to confirm. The items past them are returned as
+// rest.
+func underSoftLimit(items []CleanableItem) (kept, rest []CleanableItem) {
+	size, count := activeConfig.confirmSize(), activeConfig.confirmProjects()
+	var total int64
+	projects := make(map[string]bool)
+	cache := make(map[string]string)
+	for _, item := range items {
+		project := projectOf(item.Path, cache)
+		switch {
+		case size > 0 && total+item.Size > size,
+			count > 0 && !projects[project] && len(projects) == count:
+			rest = append(rest, item)
+			continue
+		}
+		total += item.Size
+		projects[project] = true
+		kept = append(kept, item)
+	}
+	return kept, rest
+}
+
+// confirmationMatches compares what was typed with the text asked for,
+// ignoring case and spaces.
+func confirmationMatches(typed, text string) bool {
+	normalize := func(s string) string { return strings.ToUpper(strings.Join(strings.Fields(s), "")) }
+	return normalize(typed) == normalize(text)
+}
+
+// confirmTypedOnTerminal asks for text on the terminal instead of y/N.
+func confirmTypedOnTerminal(text, reason string) bool {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprintln(os.Stderr, "stdin is not a terminal; a clean this large must be confirmed by typing its size")
+		return false
+	}
+	fmt.Printf("%s. Type %s to confirm: ", reason, text)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return confirmationMatches(answer, text)
+}
+
+// openConfirm asks for the size of the selection to be typed before
+// cleaning it.
+func (m Model) openConfirm(text, reason string) (Model, tea.Cmd) {
+	m.confirmText = text
+	m.statusMsg = ""
+	m.command.Prompt = fmt.Sprintf("%s. Type %s to confirm: ", reason, text)
+	m.command.Placeholder = ""
+	m.command.SetValue("")
+	m.commandActive = true
+	return m, m.command.Focus()
+}
+
+func (m Model) submitConfirm() (Model, tea.Cmd) {
+	text := m.confirmText
+	m = m.closeCommand()
+	if !confirmationMatches(m.command.Value(), text) {
+		m.statusMsg = errorStyle.Render("Not confirmed; nothing was deleted")
+		return m, nil
+	}
+	return m.beginCleaning()
+}
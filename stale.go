@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Stale runtime files are the sockets, pid files and editor swap files left
+// behind by processes that are gone. Unlike the other detectors they're
+// single files, found by looking at what each one refers to.
+
+const stalePattern = "stale-runtime"
+
+// pidFileMaxSize keeps lockfiles such as Cargo.lock or yarn.lock, which
+// never start with a pid anyway, from being read in full.
+const pidFileMaxSize = 128
+
+// staleReason returns why the file at path is stale, or "" if it isn't or
+// that can't be told.
+func staleReason(path string, e os.DirEntry) string {
+	name := e.Name()
+	switch {
+	case e.Type()&os.ModeSocket != 0:
+		conn, err := net.DialTimeout("unix", path, 200*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return ""
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return "socket with no listener"
+		}
+	case !e.Type().IsRegular():
+	case strings.HasSuffix(name, ".pid"), strings.HasSuffix(name, ".lock"):
+		if pid := readPidFile(path); pid > 0 && !processAlive(pid) {
+			return fmt.Sprintf("process %d is gone", pid)
+		}
+	case strings.HasPrefix(name, ".") && isVimSwapName(name):
+		if pid, ok := vimSwapOwner(path); ok && pid > 0 && !processAlive(pid) {
+			return fmt.Sprintf("swap file of vim process %d, which is gone", pid)
+		}
+	}
+	return ""
+}
+
+// readPidFile returns the pid on the first line of a small file, or 0.
+func readPidFile(path string) int {
+	info, err := os.Stat(fsPath(path))
+	if err != nil || info.Size() > pidFileMaxSize {
+		return 0
+	}
+	data, err := os.ReadFile(fsPath(path))
+	if err != nil {
+		return 0
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// isVimSwapName matches .swp, .swo, ... down to .saa, the names vim picks
+// for swap files.
+func isVimSwapName(name string) bool {
+	ext := filepath.Ext(name)
+	return len(ext) == 4 && ext[1] == 's' && ext[2] >= 'a' && ext[2] <= 'w' && ext[3] >= 'a' && ext[3] <= 'z'
+}
+
+// vimSwapOwner reads the pid from the header of a vim swap file. It is only
+// meaningful when the file was written on this host.
+func vimSwapOwner(path string) (int, bool) {
+	f, err := os.Open(fsPath(path))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	// b0_id and b0_version, then page size, mtime and inode before the pid;
+	// the host name follows the 40 byte user name
+	var header [108]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil || string(header[:5]) != "b0VIM" {
+		return 0, false
+	}
+	host, _, _ := strings.Cut(string(header[68:108]), "\x00")
+	if name, err := os.Hostname(); err != nil || host != name {
+		return 0, false
+	}
+	return int(binary.LittleEndian.Uint32(header[24:28])), true
+}
+
+// detectStaleFile is the walker's file callback for the stale runtime files
+// detector.
+func detectStaleFile(path string, e os.DirEntry) (CleanableItem, bool) {
+	reason := staleReason(path, e)
+	if reason == "" {
+		return CleanableItem{}, false
+	}
+	info, err := e.Info()
+	if err != nil {
+		return CleanableItem{}, false
+	}
+	return CleanableItem{
+		Path:    path,
+		Type:    "Stale runtime files",
+		Pattern: stalePattern,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Info:    "Left behind by a process that is gone",
+		Broken:  reason,
+	}, true
+}
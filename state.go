@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Pins, notes and the ignore list live in the state directory. It is the
+// user's config directory unless state_dir or $DEVTIDY_STATE_DIR points
+// somewhere else, typically /var/lib/devtidy on a server where a team should
+// see the same pins, notes and ignore list. A shared directory also holds
+// the index, so the journal of scans and cleans is the team's. It is made
+// group writable with the setgid bit, so every file written there stays
+// editable by the whole group.
+
+const (
+	sharedDirMode  = os.ModeDir | os.ModeSetgid | 0o775
+	sharedFileMode = 0o664
+)
+
+func stateDir() (dir string, shared bool, err error) {
+	if dir := os.Getenv("DEVTIDY_STATE_DIR"); dir != "" {
+		return dir, true, nil
+	}
+	if activeConfig.StateDir != "" {
+		return activeConfig.StateDir, true, nil
+	}
+	dir, err = configDir()
+	return dir, false, err
+}
+
+func statePath(name string) (string, error) {
+	dir, _, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// writeStateFile replaces the named state file in one rename, so users
+// sharing the directory never read half-written files.
+func writeStateFile(name string, data []byte) error {
+	dir, shared, err := stateDir()
+	if err != nil {
+		return err
+	}
+	if err := makeStateDir(dir, shared); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if shared {
+		mode = sharedFileMode
+	}
+	// CreateTemp makes the file private and a umask would narrow the mode
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, name))
+}
+
+// updateStateFile changes the named state file while holding a lock on it,
+// so users editing it at once don't lose each other's changes. update gets
+// the file as it is now, nil if it doesn't exist, and returns what to write.
+func updateStateFile(name string, update func(data []byte) ([]byte, error)) error {
+	dir, shared, err := stateDir()
+	if err != nil {
+		return err
+	}
+	if err := makeStateDir(dir, shared); err != nil {
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if shared {
+		mode = sharedFileMode
+	}
+	// The file itself is replaced on every write, so lock one beside it
+	lock, err := openLockFile(filepath.Join(dir, "."+name+".lock"), mode)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if data, err = update(data); err != nil {
+		return err
+	}
+	return writeStateFile(name, data)
+}
+
+// readStateList reads a state file of paths and globs, one per line. A
+// missing file means an empty list.
+func readStateList(name string) ([]string, error) {
+	path, err := statePath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseStateList(data)
+}
+
+// parseStateList returns the lines of data, skipping blank lines and
+// comments starting with #.
+func parseStateList(data []byte) ([]string, error) {
+	var list []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			list = append(list, line)
+		}
+	}
+	return list, scanner.Err()
+}
+
+// formatStateList writes list under a comment saying what it is.
+func formatStateList(comment string, list []string) []byte {
+	content := "# " + comment + "\n"
+	for _, line := range list {
+		content += line + "\n"
+	}
+	return []byte(content)
+}
+
+// makeStateDir creates dir if needed. A shared directory that devtidy creates
+// gets sharedDirMode regardless of the umask; an existing one is left as the
+// administrator set it up.
+func makeStateDir(dir string, shared bool) error {
+	if !shared {
+		return os.MkdirAll(dir, 0o755)
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, sharedDirMode.Perm()); err != nil {
+		return err
+	}
+	return os.Chmod(dir, sharedDirMode)
+}
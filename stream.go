@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The scan streams what it finds into the list: the items of the pattern
+// walk show up as soon as they are found and are sized right away, so on
+// slow disks selecting, and even cleaning, can start long before the walk is
+// done. The complete results replace them at the end, keeping what was
+// selected, sized or cleaned meanwhile. Scans whose filters may still drop
+// items once the walk is done, --older-than and --dormant, aren't streamed.
+// A scan can be stopped early, which lists what it found until then.
+
+// streamInterval collects the items found in a burst into one update, so
+// the list isn't redrawn for every one.
+const streamInterval = 100 * time.Millisecond
+
+// scanStream carries the results of a scan to the UI without ever blocking
+// the walk, which goes on when nobody listens any more.
+type scanStream struct {
+	// ctx is cancelled to stop the scan early
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	pending []CleanableItem
+	ready   chan struct{}
+	done    chan scanCompleteMsg
+	// progress is updated by the walk whether or not it streams items
+	progress scanProgress
+}
+
+func newScanStream() *scanStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scanStream{
+		ctx:    ctx,
+		cancel: cancel,
+		ready:  make(chan struct{}, 1),
+		done:   make(chan scanCompleteMsg, 1),
+	}
+}
+
+// cancelled reports whether ctx, which may be nil, was cancelled.
+func cancelled(ctx context.Context) bool {
+	return ctx != nil && ctx.Err() != nil
+}
+
+// stopped reports whether the scan was told to stop early.
+func (s *scanStream) stopped() bool {
+	return s != nil && s.ctx.Err() != nil
+}
+
+// add passes found items on. A nil stream drops them.
+func (s *scanStream) add(items ...CleanableItem) {
+	if s == nil || len(items) == 0 {
+		return
+	}
+	s.mu.Lock()
+	s.pending = append(s.pending, items...)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scanStream) take() []CleanableItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.pending
+	s.pending = nil
+	return items
+}
+
+// scanFoundMsg brings the items found since the last one.
+type scanFoundMsg struct {
+	stream *scanStream
+	items  []CleanableItem
+}
+
+// wait delivers the next items found, or the results once the scan is done.
+func (s *scanStream) wait() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case <-s.ready:
+			time.Sleep(streamInterval)
+			return scanFoundMsg{stream: s, items: s.take()}
+		case msg := <-s.done:
+			return msg
+		}
+	}
+}
+
+// scanForCleanableItems scans roots, streaming the items into the UI, until
+// the scan is done or its context is cancelled.
+func scanForCleanableItems(stream *scanStream, roots []string, opts scanOptions) tea.Cmd {
+	opts.ctx = stream.ctx
+	opts.progress = &stream.progress
+	if opts.olderThan == 0 && opts.dormant == 0 {
+		opts.stream = stream
+	}
+	scan := func() tea.Msg {
+		items, issues := scanRoots(roots, opts)
+		stream.done <- scanCompleteMsg{stream: stream, items: items, issues: issues, stopped: stream.stopped()}
+		return nil
+	}
+	return tea.Batch(scan, stream.wait())
+}
+
+// addFound lists the items streamed from the scan and starts sizing them.
+// The list replaces the scanning screen with the first of them.
+func (m Model) addFound(found []CleanableItem) (Model, tea.Cmd) {
+	current, _ := m.list.SelectedItem().(CleanableItem)
+	items := append([]CleanableItem(nil), m.items.All()...)
+	for _, item := range activePolicy.filter(found) {
+		if _, listed := m.items.Get(item.Path); listed {
+			continue
+		}
+		items = append(items, item)
+		m.unsized[item.Path] = true
+		m.totalSizeJobs++
+	}
+	m.items = newItemSet(dedupeItems(items))
+	m.items.ApplyPins(m.pins)
+	m.items.ApplyNotes(m.notes)
+	m.items.Sort(m.sortOrder)
+	m.scannedItems = m.items.Len()
+	m.calculatingSizes = m.completedSizeJobs < m.totalSizeJobs
+	if m.state == stateScanning && !m.onboarding {
+		m.state = stateSelecting
+	}
+	cmd := m.refreshList()
+	m.selectPath(current.Path)
+	return m, tea.Batch(cmd, m.nextSizeJobs(), m.stream.wait())
+}
+
+// mergeScan combines the complete results of the scan with the items
+// streamed before: what was selected, sized or cleaned meanwhile is kept,
+// and items cleaned and dropped from the list stay gone. Streamed items the
+// complete results leave out are no longer sized.
+func (m *Model) mergeScan(items []CleanableItem) []CleanableItem {
+	cleaned := make(map[string]bool, len(m.cleaned))
+	for _, item := range m.cleaned {
+		cleaned[item.Path] = true
+	}
+	kept := make(map[string]bool, len(items))
+	merged := items[:0]
+	for _, item := range items {
+		if streamed, listed := m.items.Get(item.Path); listed {
+			if streamed.Size != 0 {
+				item.Size = streamed.Size
+			}
+			item.Selected, item.Cleaned = streamed.Selected, streamed.Cleaned
+		} else if cleaned[item.Path] {
+			continue
+		}
+		kept[item.Path] = true
+		merged = append(merged, item)
+	}
+	for path := range m.unsized {
+		if !kept[path] && !m.sizing[path] {
+			delete(m.unsized, path)
+			m.totalSizeJobs--
+		}
+	}
+	return merged
+}
+
+// stopScan cancels the scan going on, which then lists what it found.
+func (m Model) stopScan() (Model, tea.Cmd) {
+	if m.stream == nil || m.stream.stopped() {
+		return m, nil
+	}
+	m.stream.cancel()
+	m.statusMsg = "Stopping the scan..."
+	return m, nil
+}
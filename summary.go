@@ -0,0 +1,84 @@
+package main
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/charmbracelet/log"
+)
+
+// A summary template turns the result of a run into whatever a team wants
+// mailed after a scheduled cleanup. Templates ending in .html or .htm are
+// executed with html/template, so paths can't inject markup.
+
+type summaryTemplate interface {
+	Execute(w io.Writer, data any) error
+}
+
+// summaryData is what templates see: the fields of runResult plus the host,
+// e.g. {{.Host}} freed {{size .FreedBytes}}.
+type summaryData struct {
+	runResult
+	Host string
+}
+
+var summaryFuncs = map[string]any{
+	"size": formatSize,
+	"path": displayPath,
+}
+
+// loadSummaryTemplate parses the template at path, so a broken template is
+// reported before anything is cleaned rather than after.
+func loadSummaryTemplate(path string) (summaryTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return htmltemplate.New(name).Funcs(summaryFuncs).Parse(string(data))
+	}
+	return texttemplate.New(name).Funcs(summaryFuncs).Parse(string(data))
+}
+
+// runOutputs are the files written once a run is over.
+type runOutputs struct {
+	resultFile string
+	summary    summaryTemplate
+	// summaryFile receives the summary; empty means stdout
+	summaryFile string
+}
+
+func (o runOutputs) write(result runResult) {
+	if o.resultFile != "" {
+		if err := writeRunResult(o.resultFile, result); err != nil {
+			log.Errorf("Error: could not write result file: %v", err)
+		}
+	}
+	if o.summary != nil {
+		if err := writeSummary(o.summary, o.summaryFile, result); err != nil {
+			log.Errorf("Error: could not write summary: %v", err)
+		}
+	}
+}
+
+func writeSummary(t summaryTemplate, path string, result runResult) error {
+	data := summaryData{runResult: result, Host: hostname()}
+	if path == "" {
+		return t.Execute(os.Stdout, data)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := t.Execute(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// detectBuildDirs finds per-build directories in CI workspace layouts such as
+// Jenkins' workspace/<job>/<build> and jobs/<job>/builds/<build>, keeping the
+// keep most recent builds of every job.
+func detectBuildDirs(root string, keep int) []CleanableItem {
+	var items []CleanableItem
+	forEachDir(root, func(job string) {
+		builds := numberedDirs(job)
+		if len(builds) == 0 {
+			builds = numberedDirs(filepath.Join(job, "builds"))
+		}
+		if len(builds) <= keep {
+			return
+		}
+		for _, build := range builds[keep:] {
+			num := filepath.Base(build)
+			desc := fmt.Sprintf("Build %s of %s", num, filepath.Base(job))
+			items = append(items, CleanableItem{
+				Path:    build,
+				Type:    desc,
+				Pattern: "ci-build",
+				ModTime: modTimeOf(build),
+				Info:    desc,
+			})
+		}
+	})
+	return items
+}
+
+// numberedDirs returns the subdirectories of dir named by a build number,
+// newest first.
+func numberedDirs(dir string) []string {
+	var dirs []string
+	numbers := make(map[string]int)
+	forEachDir(dir, func(path string) {
+		if n, err := strconv.Atoi(filepath.Base(path)); err == nil && n >= 0 {
+			dirs = append(dirs, path)
+			numbers[path] = n
+		}
+	})
+	sort.Slice(dirs, func(i, j int) bool {
+		return numbers[dirs[i]] > numbers[dirs[j]]
+	})
+	return dirs
+}
+
+func runSweep(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	keep := fs.Int("keep", 5, "number of most recent builds to keep per job")
+	dryRun := fs.Bool("dry-run", false, "only list what would be removed")
+	addReadOnlyFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy sweep [options] [workspace root]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Treats every directory below the workspace root as a job and removes all")
+		fmt.Fprintln(fs.Output(), "but the most recent numbered build directories of each job. Both")
+		fmt.Fprintln(fs.Output(), "<job>/<build> and <job>/builds/<build> layouts are recognised.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *keep < 0 {
+		return fmt.Errorf("--keep must not be negative")
+	}
+
+	root := resolveTargetDir(fs.Args())
+	return cleanDetected(root, detectBuildDirs(root, *keep), *dryRun, removeAll)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/paginator"
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// symbolSet holds the glyphs drawn by the TUI
+type symbolSet struct {
+	check   string
+	bullet  string
+	cleaned string
+	pin     string
+	// expanded and collapsed mark project headers
+	expanded  string
+	collapsed string
+}
+
+var (
+	unicodeSymbols = symbolSet{check: "✓", bullet: "•", cleaned: "✗", pin: "★", expanded: "▾", collapsed: "▸"}
+	asciiSymbols   = symbolSet{check: "[x]", bullet: "|", cleaned: "[-]", pin: "*", expanded: "v", collapsed: ">"}
+)
+
+// Active rendering mode, switched to ASCII by useASCII
+var (
+	symbols   = unicodeSymbols
+	asciiMode = false
+)
+
+// detectASCII reports whether the terminal is unlikely to render Unicode
+// glyphs or 256 colors.
+func detectASCII() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return true
+	}
+	if lipgloss.ColorProfile() > termenv.ANSI256 {
+		return true
+	}
+	return !localeSupportsUTF8()
+}
+
+func localeSupportsUTF8() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			value = strings.ToLower(value)
+			return strings.Contains(value, "utf-8") || strings.Contains(value, "utf8")
+		}
+	}
+	// Windows consoles don't advertise a locale but handle Unicode
+	return runtime.GOOS == "windows"
+}
+
+// useASCII switches all rendering to plain ASCII without colors.
+func useASCII() {
+	asciiMode = true
+	symbols = asciiSymbols
+	lipgloss.SetColorProfile(termenv.Ascii)
+}
+
+func newSpinner() spinner.Model {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	if asciiMode {
+		s.Spinner = spinner.Line
+	}
+	return s
+}
+
+func newProgress() progress.Model {
+	if asciiMode {
+		return progress.New(progress.WithFillCharacters('#', '-'), progress.WithSolidFill(""))
+	}
+	return progress.New(progress.WithDefaultGradient())
+}
+
+func newDelegate() list.DefaultDelegate {
+	delegate := list.NewDefaultDelegate()
+	if asciiMode {
+		selectedBorder := lipgloss.Border{Left: ">"}
+		delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.Border(selectedBorder, false, false, false, true)
+		delegate.Styles.SelectedDesc = delegate.Styles.SelectedDesc.Border(selectedBorder, false, false, false, true)
+	}
+	return delegate
+}
+
+func newList() list.Model {
+	l := list.New([]list.Item{}, newDelegate(), 0, 0)
+	l.Title = "Cleanable Items"
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(true)
+	// f jumps to a path instead
+	l.KeyMap.NextPage.SetKeys("right", "l", "pgdown", "d")
+	l.Styles.Title = titleStyle
+	if asciiMode {
+		l.Paginator.Type = paginator.Arabic
+		l.Help.ShortSeparator = " " + symbols.bullet + " "
+	}
+	return l
+}
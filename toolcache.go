@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Toolchains and package managers keep caches outside of any project. Each
+// ecosystem's caches are an opt-in group, found by asking the tool where
+// they are and cleaned with the tool's own command where it has one.
+
+// toolCacheGroups are the opt-in groups of global caches with their
+// detectors.
+var toolCacheGroups = []struct {
+	group  string
+	detect func() []CleanableItem
+}{
+	{"go", detectGoCaches},
+	{"node-cache", detectNodeCaches},
+	{"cargo", detectCargoCaches},
+	{"docker", detectDocker},
+	{"jvm", detectJVMCaches},
+	{"xcode-cache", detectXcodeCaches},
+	{"indexer-cache", detectIndexerCaches},
+	{"homebrew", detectHomebrew},
+	{"python-cache", detectPythonCaches},
+	{"bazel", detectBazelCaches},
+	{"devtidy", detectOwnFiles},
+}
+
+// toolCleaners clean items of these patterns with the command of the tool
+// that owns them instead of deleting them outright. Moving to the trash
+// bypasses them.
+var toolCleaners = map[string]func(path string) error{
+	goBuildCachePattern: goCleaner("-cache", "GOCACHE"),
+	goModCachePattern:   goCleaner("-modcache", "GOMODCACHE"),
+	npmCachePattern:     npmCleaner,
+	yarnCachePattern:    yarnCleaner,
+	pnpmStorePattern:    pnpmCleaner,
+
+	cargoRegistryCachePattern: cargoCleaner,
+	cargoRegistrySrcPattern:   cargoCleaner,
+	cargoGitDBPattern:         cargoCleaner,
+	cargoGitCheckoutsPattern:  cargoCleaner,
+
+	dockerImagesPattern:     dockerCleaner,
+	dockerContainersPattern: dockerCleaner,
+	dockerVolumesPattern:    dockerCleaner,
+	dockerBuildCachePattern: dockerCleaner,
+
+	gradleWrapperPattern: jvmCleaner(gradleWrapperPattern),
+	gradleCachesPattern:  jvmCleaner(gradleCachesPattern),
+	mavenRepoPattern:     jvmCleaner(mavenRepoPattern),
+	ivyCachePattern:      jvmCleaner(ivyCachePattern),
+
+	homebrewPattern:       homebrewCleaner,
+	cocoaPodsCachePattern: cocoaPodsCleaner,
+
+	pipCachePattern:  pipCleaner,
+	condaPkgsPattern: condaCleaner,
+
+	bazelOutputBasePattern: bazelExpunger("bazel"),
+}
+
+// detectToolCaches lists the caches of the enabled groups.
+func detectToolCaches() []CleanableItem {
+	var items []CleanableItem
+	for _, g := range toolCacheGroups {
+		if activeConfig.groupEnabled(g.group) {
+			items = append(items, g.detect()...)
+		}
+	}
+	return items
+}
+
+// toolOutput runs a tool to ask it about its configuration and returns the
+// trimmed output, or "" when the tool is missing or fails.
+func toolOutput(name string, args ...string) string {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// cacheItem describes the cache directory at path, unless it doesn't exist
+// or is excluded.
+func cacheItem(path, pattern, desc, info string) (CleanableItem, bool) {
+	if path == "" || !filepath.IsAbs(path) || activeConfig.excluded(path) {
+		return CleanableItem{}, false
+	}
+	if st, err := os.Stat(fsPath(path)); err != nil || !st.IsDir() {
+		return CleanableItem{}, false
+	}
+	return CleanableItem{
+		Path:    path,
+		Type:    desc,
+		Pattern: pattern,
+		ModTime: modTimeOf(path),
+		Info:    info,
+	}, true
+}
+
+// runToolClean runs a tool's own clean command.
+func runToolClean(cmd *exec.Cmd) error {
+	if out, err := runDestructive(cmd); err != nil {
+		name := append([]string{filepath.Base(cmd.Args[0])}, cmd.Args[1:]...)
+		return fmt.Errorf("%s: %w: %s", strings.Join(name, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tracing is off unless an OTLP endpoint is configured. Every phase of a run
+// is recorded as a span below one span for the whole run, kept in memory and
+// posted as OTLP/HTTP JSON when devtidy exits, so the scan itself never
+// waits on the collector.
+
+// traceTimeout bounds how long exiting waits for the collector.
+const traceTimeout = 5 * time.Second
+
+type span struct {
+	id     [8]byte
+	parent *span
+	name   string
+	start  time.Time
+	end    time.Time
+	attrs  map[string]any
+	err    string
+	mu     sync.Mutex
+}
+
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	traceID  [16]byte
+	run      *span
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+// activeTracer is nil when tracing is off; every span method is then a no-op.
+var activeTracer *tracer
+
+// otlpEndpoint picks the traces URL: the flag or config value, then the
+// standard OpenTelemetry environment variables. Base endpoints get
+// /v1/traces appended, like the OpenTelemetry SDKs do.
+func otlpEndpoint(configured string) string {
+	if configured != "" {
+		return strings.TrimSuffix(configured, "/") + "/v1/traces"
+	}
+	if url := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); url != "" {
+		return url
+	}
+	if url := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); url != "" {
+		return strings.TrimSuffix(url, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// otlpHeaders parses OTEL_EXPORTER_OTLP_HEADERS, a comma-separated list of
+// key=value pairs, usually carrying the collector's credentials.
+func otlpHeaders() map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if ok && strings.TrimSpace(key) != "" {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
+
+// startTracing turns tracing on and starts the span of the run.
+func startTracing(endpoint string, root string) {
+	t := &tracer{endpoint: endpoint, headers: otlpHeaders()}
+	rand.Read(t.traceID[:])
+	activeTracer = t
+	t.run = startSpan(nil, "devtidy", "devtidy.root", root)
+}
+
+// startSpan starts a span below parent, or below the run when parent is nil.
+// attrs are key, value pairs.
+func startSpan(parent *span, name string, attrs ...any) *span {
+	t := activeTracer
+	if t == nil {
+		return nil
+	}
+	s := &span{parent: parent, name: name, start: time.Now(), attrs: make(map[string]any)}
+	if s.parent == nil {
+		s.parent = t.run
+	}
+	rand.Read(s.id[:])
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attrs[attrs[i].(string)] = attrs[i+1]
+	}
+	return s
+}
+
+func (s *span) set(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// fail marks the span as failed with err, if there is one.
+func (s *span) fail(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.finishAt(time.Now())
+}
+
+func (s *span) finishAt(end time.Time) {
+	t := activeTracer
+	s.mu.Lock()
+	s.end = end
+	s.mu.Unlock()
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+}
+
+// recordFreeSpace adds the free space on the filesystem holding path, so
+// spans can be lined up with disk metrics.
+func (s *span) recordFreeSpace(key, path string) {
+	if s == nil {
+		return
+	}
+	if free, ok := freeSpace(path); ok {
+		s.set(key, int64(free))
+	}
+}
+
+// detectorTimer sums the time spent in one detector over a walk. A detector
+// runs once per entry, so its span starts with the scan and lasts as long as
+// all its calls together.
+type detectorTimer struct {
+	name  string
+	busy  atomic.Int64
+	calls atomic.Int64
+	found atomic.Int64
+}
+
+func (d *detectorTimer) observe(start time.Time, found int) {
+	d.busy.Add(int64(time.Since(start)))
+	d.calls.Add(1)
+	d.found.Add(int64(found))
+}
+
+// wrap times every call of detect.
+func (d *detectorTimer) wrap(detect func(string, os.DirEntry) []CleanableItem) func(string, os.DirEntry) []CleanableItem {
+	return func(path string, e os.DirEntry) []CleanableItem {
+		start := time.Now()
+		found := detect(path, e)
+		d.observe(start, len(found))
+		return found
+	}
+}
+
+func (d *detectorTimer) record(scan *span) {
+	if scan == nil {
+		return
+	}
+	s := startSpan(scan, "detect",
+		"devtidy.detector", d.name,
+		"devtidy.detector.calls", d.calls.Load(),
+		"devtidy.items", d.found.Load())
+	s.start = scan.start
+	s.finishAt(scan.start.Add(time.Duration(d.busy.Load())))
+}
+
+// flushTraces ends the run and posts every span to the collector.
+func flushTraces() error {
+	t := activeTracer
+	if t == nil {
+		return nil
+	}
+	t.run.finish()
+	activeTracer = nil
+
+	body, err := json.Marshal(t.export())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), traceTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+// export builds an OTLP ExportTraceServiceRequest in its JSON encoding.
+func (t *tracer) export() map[string]any {
+	host, _ := os.Hostname()
+	resource := map[string]any{
+		"attributes": otlpAttributes(map[string]any{
+			"service.name":    "devtidy",
+			"service.version": version,
+			"host.name":       host,
+		}),
+	}
+
+	t.mu.Lock()
+	spans := slices.Clone(t.spans)
+	t.mu.Unlock()
+	traceID := hex.EncodeToString(t.traceID[:])
+	var out []map[string]any
+	for _, s := range spans {
+		s.mu.Lock()
+		o := map[string]any{
+			"traceId":           traceID,
+			"spanId":            hex.EncodeToString(s.id[:]),
+			"name":              s.name,
+			"kind":              1, // internal
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+		}
+		if s.parent != nil {
+			o["parentSpanId"] = hex.EncodeToString(s.parent.id[:])
+		}
+		if s.err != "" {
+			o["status"] = map[string]any{"code": 2, "message": s.err}
+		}
+		s.mu.Unlock()
+		out = append(out, o)
+	}
+
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": resource,
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "devtidy", "version": version},
+				"spans": out,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes encodes attributes as OTLP key/value pairs; 64-bit integers
+// are strings in OTLP JSON.
+func otlpAttributes(attrs map[string]any) []map[string]any {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	out := make([]map[string]any, 0, len(attrs))
+	for _, key := range keys {
+		var value map[string]any
+		switch v := attrs[key].(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]any{"key": key, "value": value})
+	}
+	return out
+}
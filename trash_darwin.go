@@ -0,0 +1,40 @@
+//go:build !readonly
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+func homeTrash() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".Trash"), nil
+}
+
+func volumeTrash(top string) string {
+	return filepath.Join(top, ".Trashes", strconv.Itoa(os.Getuid()))
+}
+
+// trashInto moves path into trash under a name not taken yet. The Finder
+// keeps no record of where items came from that other programs can write,
+// so origin is unused and items are restored by dragging them back, or by
+// devtidy undo.
+func trashInto(trash, path, origin string) (string, error) {
+	if err := os.MkdirAll(trash, 0o700); err != nil {
+		return "", err
+	}
+	name := trashName(filepath.Base(path), func(name string) bool {
+		_, err := os.Lstat(filepath.Join(trash, name))
+		return err == nil
+	})
+	trashed := filepath.Join(trash, name)
+	return trashed, os.Rename(path, trashed)
+}
+
+// forgetTrashed has nothing to clean up after an item is restored.
+func forgetTrashed(string) {}
@@ -0,0 +1,77 @@
+//go:build !readonly && !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// moveToTrash moves path into the trash of the home directory or, when path
+// is on another filesystem, the trash at the top of that filesystem, so the
+// move is always a rename and never a copy. It returns where path went.
+func moveToTrash(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	home, err := homeTrash()
+	if err != nil {
+		return "", err
+	}
+	trashed, err := trashInto(home, path, path)
+	if !errors.Is(err, syscall.EXDEV) {
+		return trashed, err
+	}
+	top := mountTop(path)
+	rel, err := filepath.Rel(top, path)
+	if err != nil {
+		return "", err
+	}
+	return trashInto(volumeTrash(top), path, rel)
+}
+
+// mountTop returns the topmost directory above path on the same filesystem.
+func mountTop(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return filepath.Dir(path)
+	}
+	dev, _ := deviceID(info)
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		info, err := os.Stat(parent)
+		if err != nil {
+			return path
+		}
+		if d, _ := deviceID(info); d != dev {
+			return path
+		}
+		path = parent
+	}
+}
+
+// trashName returns the first of name, "name 2", "name 3", ... for which
+// taken is false.
+func trashName(name string, taken func(string) bool) string {
+	candidate := name
+	for n := 2; taken(candidate); n++ {
+		candidate = name + " " + strconv.Itoa(n)
+	}
+	return candidate
+}
+
+func trashBackend() (string, error) {
+	dir, err := homeTrash()
+	if err != nil {
+		return "", fmt.Errorf("no trash directory: %w", err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,144 @@
+//go:build !readonly
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var procSHFileOperationW = syscall.NewLazyDLL("shell32.dll").NewProc("SHFileOperationW")
+
+const (
+	maxPath = 260
+
+	foDelete          = 0x3
+	fofSilent         = 0x4
+	fofNoConfirmation = 0x10
+	fofAllowUndo      = 0x40
+	fofNoErrorUI      = 0x400
+)
+
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+// moveToTrash sends path to the Recycle Bin. The shell API doesn't accept
+// extended-length paths, so items with paths beyond MAX_PATH can't be
+// recycled: moving them fails and they stay where they are. The shell doesn't
+// say where in the Recycle Bin an item went, so it is restored from there
+// rather than by devtidy undo.
+func moveToTrash(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if len(path) >= maxPath {
+		return "", fmt.Errorf("the path is longer than the Recycle Bin accepts (%d characters); clean it with trash mode off", len(path))
+	}
+	// FOF_NOCONFIRMATION makes the shell delete what doesn't fit in the
+	// Recycle Bin without asking, so check that first
+	if err := checkRecycleBin(path); err != nil {
+		return "", err
+	}
+	// pFrom is a list of paths, terminated by an extra NUL
+	from, err := syscall.UTF16FromString(path)
+	if err != nil {
+		return "", err
+	}
+	from = append(from, 0)
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI,
+	}
+	if ret, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(&op))); ret != 0 {
+		return "", fmt.Errorf("moving to the Recycle Bin failed (error 0x%x)", ret)
+	}
+	if op.fAnyOperationsAborted != 0 {
+		return "", errors.New("moving to the Recycle Bin was aborted")
+	}
+	return "", nil
+}
+
+// checkRecycleBin returns an error when the shell would delete path
+// permanently instead of recycling it: the Recycle Bin of its drive is
+// turned off, or path is larger than the Recycle Bin may grow.
+func checkRecycleBin(path string) error {
+	root := filepath.VolumeName(path) + `\`
+	capacity, off, err := recycleBinCapacity(root)
+	if err != nil {
+		return fmt.Errorf("can't tell whether it fits in the Recycle Bin: %w", err)
+	}
+	if off {
+		return fmt.Errorf("the Recycle Bin of %s is turned off, so the shell would delete it permanently; clean it with trash mode off", root)
+	}
+	if size := measureSize(path); size > capacity {
+		return fmt.Errorf("it is larger (%s) than the Recycle Bin of %s can hold (%s), so the shell would delete it permanently; clean it with trash mode off",
+			formatSize(size), root, formatSize(capacity))
+	}
+	return nil
+}
+
+// recycleBinCapacity returns the bytes the Recycle Bin of the drive at root
+// may hold and whether it is turned off. Unless it was changed, the
+// capacity is taken as 5% of the drive, the least Windows gives it.
+func recycleBinCapacity(root string) (int64, bool, error) {
+	rootPtr, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return 0, false, err
+	}
+	// The settings are kept per volume, named \\?\Volume{GUID}\
+	var volume [windows.MAX_PATH]uint16
+	if err := windows.GetVolumeNameForVolumeMountPoint(rootPtr, &volume[0], uint32(len(volume))); err != nil {
+		return 0, false, err
+	}
+	name := windows.UTF16ToString(volume[:])
+	i := strings.Index(name, "{")
+	if i < 0 {
+		return 0, false, fmt.Errorf("unexpected volume name %s", name)
+	}
+	guid := strings.TrimSuffix(name[i:], `\`)
+
+	key, err := registry.OpenKey(registry.CURRENT_USER,
+		`Software\Microsoft\Windows\CurrentVersion\Explorer\BitBucket\Volume\`+guid, registry.QUERY_VALUE)
+	if err == nil {
+		defer key.Close()
+		if nuke, _, err := key.GetIntegerValue("NukeOnDelete"); err == nil && nuke != 0 {
+			return 0, true, nil
+		}
+		if mb, _, err := key.GetIntegerValue("MaxCapacity"); err == nil {
+			return int64(mb) << 20, false, nil
+		}
+	} else if !errors.Is(err, registry.ErrNotExist) {
+		return 0, false, err
+	}
+	var available, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(rootPtr, &available, &total, &totalFree); err != nil {
+		return 0, false, err
+	}
+	return int64(total / 20), false, nil
+}
+
+func forgetTrashed(string) {}
+
+func trashBackend() (string, error) {
+	if err := procSHFileOperationW.Find(); err != nil {
+		return "", err
+	}
+	return "Recycle Bin", nil
+}
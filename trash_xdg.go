@@ -0,0 +1,75 @@
+//go:build !readonly && !windows && !darwin
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The trash follows the FreeDesktop.org trash specification, so file
+// managers can list the items and restore them to where they came from.
+
+func homeTrash() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "Trash"), nil
+}
+
+func volumeTrash(top string) string {
+	return filepath.Join(top, fmt.Sprintf(".Trash-%d", os.Getuid()))
+}
+
+// trashInto moves path into trash, recording origin (absolute for the home
+// trash, relative to the top directory otherwise) in its .trashinfo file.
+func trashInto(trash, path, origin string) (string, error) {
+	files, info := filepath.Join(trash, "files"), filepath.Join(trash, "info")
+	for _, dir := range []string{files, info} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return "", err
+		}
+	}
+
+	// Claiming the name by creating the info file first keeps two devtidy
+	// processes, or a file manager, from picking the same one
+	var infoFile *os.File
+	var err error
+	name := trashName(filepath.Base(path), func(name string) bool {
+		infoFile, err = os.OpenFile(filepath.Join(info, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		return os.IsExist(err)
+	})
+	if err != nil {
+		return "", err
+	}
+	infoPath := infoFile.Name()
+	_, err = fmt.Fprintf(infoFile, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: origin}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	if closeErr := infoFile.Close(); err == nil {
+		err = closeErr
+	}
+	trashed := filepath.Join(files, name)
+	if err == nil {
+		err = os.Rename(path, trashed)
+	}
+	if err != nil {
+		os.Remove(infoPath)
+		return "", err
+	}
+	return trashed, nil
+}
+
+// forgetTrashed removes the .trashinfo file of an item restored from the
+// trash at trashed.
+func forgetTrashed(trashed string) {
+	trash := filepath.Dir(filepath.Dir(trashed))
+	os.Remove(filepath.Join(trash, "info", filepath.Base(trashed)+".trashinfo"))
+}
@@ -0,0 +1,152 @@
+//go:build !readonly && !windows && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// trashFixture points the trash and the cache into a temporary directory
+// and returns a node_modules fixture to trash.
+func trashFixture(t *testing.T) (project, item string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	project, err := writeFixture(filepath.Join(dir, "work"), "node_modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return project, filepath.Join(project, "node_modules")
+}
+
+func TestTrashAndUndo(t *testing.T) {
+	project, item := trashFixture(t)
+
+	trashed, err := trashItem(item)
+	if err != nil {
+		t.Fatalf("trashItem: %v", err)
+	}
+	if _, err := os.Lstat(item); !os.IsNotExist(err) {
+		t.Fatalf("%s is still there after trashing it", item)
+	}
+	wantDir := filepath.Join(os.Getenv("XDG_DATA_HOME"), "Trash", "files")
+	if filepath.Dir(trashed) != wantDir {
+		t.Errorf("trashed to %s, want it in %s", trashed, wantDir)
+	}
+	infoPath := filepath.Join(filepath.Dir(wantDir), "info", filepath.Base(trashed)+".trashinfo")
+	info, err := os.ReadFile(infoPath)
+	if err != nil {
+		t.Fatalf("reading the trash info: %v", err)
+	}
+	if !strings.Contains(string(info), "Path="+item+"\n") {
+		t.Errorf("trash info %q doesn't record %s", info, item)
+	}
+
+	if err := saveUndo(project, []trashedItem{{Item: CleanableItem{Path: item}, Trashed: trashed}}); err != nil {
+		t.Fatalf("saveUndo: %v", err)
+	}
+	root, restored, failures, err := undoLastClean()
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("undoLastClean: %v %v", err, failures)
+	}
+	if root != project || len(restored) != 1 || restored[0].Path != item {
+		t.Errorf("undoLastClean restored %v of %s, want %s of %s", restored, root, item, project)
+	}
+	want := fixtureFiles["node_modules"]["node_modules/left-pad/index.js"]
+	if got, err := os.ReadFile(filepath.Join(item, "left-pad", "index.js")); err != nil || string(got) != want {
+		t.Errorf("restored file = %q, %v, want %q", got, err, want)
+	}
+	if _, err := os.Lstat(infoPath); !os.IsNotExist(err) {
+		t.Errorf("the trash info of a restored item is left behind")
+	}
+	if _, err := loadUndo(); !errors.Is(err, errNothingToUndo) {
+		t.Errorf("loadUndo after undoing = %v, want %v", err, errNothingToUndo)
+	}
+}
+
+func TestUndoDoesNotReplace(t *testing.T) {
+	project, item := trashFixture(t)
+	trashed, err := trashItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveUndo(project, []trashedItem{{Item: CleanableItem{Path: item}, Trashed: trashed}}); err != nil {
+		t.Fatal(err)
+	}
+	// A reinstall since the clean
+	if err := os.Mkdir(item, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, restored, failures, err := undoLastClean()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 0 || len(failures) != 1 {
+		t.Fatalf("undoLastClean restored %v and failed %v, want only a failure", restored, failures)
+	}
+	if _, err := os.Lstat(trashed); err != nil {
+		t.Errorf("the item left the trash: %v", err)
+	}
+	record, err := loadUndo()
+	if err != nil || len(record.Items) != 1 {
+		t.Errorf("the item that failed isn't kept for the next undo: %v %v", record.Items, err)
+	}
+}
+
+func TestTrashName(t *testing.T) {
+	taken := map[string]bool{"dist": true, "dist 2": true}
+	if got := trashName("dist", func(name string) bool { return taken[name] }); got != "dist 3" {
+		t.Errorf("trashName = %q, want %q", got, "dist 3")
+	}
+	if got := trashName("build", func(name string) bool { return taken[name] }); got != "build" {
+		t.Errorf("trashName = %q, want %q", got, "build")
+	}
+}
+
+func TestRecordTrashedCapsTheTrash(t *testing.T) {
+	_, item := trashFixture(t)
+	saved := activeConfig
+	t.Cleanup(func() { activeConfig = saved })
+	activeConfig.TrashLimit = "1KB"
+
+	old := filepath.Join(filepath.Dir(item), "old")
+	if err := os.MkdirAll(old, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	trashedOld, err := trashItem(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recordTrashed([]trashedItem{{Item: CleanableItem{Path: old, Size: 800}, Trashed: trashedOld}}); err != nil {
+		t.Fatal(err)
+	}
+	trashedNew, err := trashItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	purged, err := recordTrashed([]trashedItem{{Item: CleanableItem{Path: item, Size: 800}, Trashed: trashedNew}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the older clean is emptied, so the last one can still be undone
+	if len(purged) != 1 || purged[0].Item.Path != old {
+		t.Errorf("purged %v, want only %s", purged, old)
+	}
+	if _, err := os.Lstat(trashedOld); !os.IsNotExist(err) {
+		t.Errorf("%s is still in the trash", trashedOld)
+	}
+	if _, err := os.Lstat(trashedNew); err != nil {
+		t.Errorf("the item just trashed was purged: %v", err)
+	}
+	entries, err := loadTrashLedger()
+	if err != nil || len(entries) != 1 || entries[0].Trashed != trashedNew {
+		t.Errorf("ledger = %v, %v, want only %s", entries, err, trashedNew)
+	}
+}
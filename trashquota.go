@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Moving items to the trash frees nothing until the trash is emptied, so
+// devtidy keeps a ledger of what it put there. devtidy trash shows how much
+// that is, devtidy trash purge deletes it for good, and after every clean to
+// the trash the oldest items devtidy trashed before are purged until the
+// total is within trash_limit. Items emptied from the trash or restored by
+// other means drop out of the ledger.
+
+const defaultTrashLimit = 50 << 30
+
+// trashLimit is how much devtidy keeps in the trash; 0 turns the cap off.
+func (c config) trashLimit() int64 {
+	if c.TrashLimit == "" {
+		return defaultTrashLimit
+	}
+	n, _ := parseSize(c.TrashLimit)
+	return n
+}
+
+// trashEntry is an item devtidy moved to the trash, and when.
+type trashEntry struct {
+	trashedItem
+	Time time.Time `json:"time"`
+}
+
+func trashLedgerPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "trash.json"), nil
+}
+
+// loadTrashLedger reads the items devtidy moved to the trash that are still
+// there, oldest first. A missing ledger means there are none.
+func loadTrashLedger() ([]trashEntry, error) {
+	path, err := trashLedgerPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []trashEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid trash ledger %s: %w", path, err)
+	}
+	return slices.DeleteFunc(entries, func(e trashEntry) bool {
+		_, err := os.Lstat(fsPath(e.Trashed))
+		return err != nil
+	}), nil
+}
+
+func saveTrashLedger(entries []trashEntry) error {
+	path, err := trashLedgerPath()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func trashTotal(entries []trashEntry) int64 {
+	var total int64
+	for _, e := range entries {
+		total += e.Item.Size
+	}
+	return total
+}
+
+// purgeTrashed deletes the entries purge picks from the trash. It returns
+// those left and the ones purged.
+func purgeTrashed(entries []trashEntry, purge func(e trashEntry) bool) (kept, purged []trashEntry, failures []Issue) {
+	for _, e := range entries {
+		if !purge(e) {
+			kept = append(kept, e)
+			continue
+		}
+		if err := removeAllWritable(e.Trashed); err != nil {
+			failures = append(failures, newIssue(e.Trashed, phaseClean, err))
+			kept = append(kept, e)
+			continue
+		}
+		forgetTrashed(e.Trashed)
+		purged = append(purged, e)
+	}
+	return kept, purged, failures
+}
+
+// recordTrashed adds the items of a clean to the ledger, then purges the
+// oldest items trashed before it while the total is over trash_limit. The
+// items just trashed are never purged, so the clean can still be undone.
+func recordTrashed(items []trashedItem) (purged []trashEntry, err error) {
+	entries, err := loadTrashLedger()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, t := range items {
+		// The Recycle Bin doesn't say where items went
+		if t.Trashed != "" {
+			entries = append(entries, trashEntry{trashedItem: t, Time: now})
+		}
+	}
+	limit := activeConfig.trashLimit()
+	if limit > 0 && !activePolicy.RequireTrash {
+		over := trashTotal(entries) - limit
+		entries, purged, _ = purgeTrashed(entries, func(e trashEntry) bool {
+			if over <= 0 || !e.Time.Before(now) {
+				return false
+			}
+			over -= e.Item.Size
+			return true
+		})
+	}
+	return purged, saveTrashLedger(entries)
+}
+
+type trashRecordedMsg struct {
+	purged []trashEntry
+	err    error
+}
+
+// recordTrashedCmd records the items of a clean in the UI, where purging
+// mustn't hold it up.
+func recordTrashedCmd(items []trashedItem) tea.Cmd {
+	return func() tea.Msg {
+		purged, err := recordTrashed(items)
+		return trashRecordedMsg{purged: purged, err: err}
+	}
+}
+
+// trashPurgeNote tells what was purged to stay within trash_limit, or ""
+// when nothing was.
+func trashPurgeNote(purged []trashEntry) string {
+	if len(purged) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Emptied %d older items (%s) from the trash to stay within %s",
+		len(purged), formatSize(trashTotal(purged)), formatSize(activeConfig.trashLimit()))
+}
+
+func runTrash(args []string) error {
+	if len(args) > 0 && args[0] == "purge" {
+		return runTrashPurge(args[1:])
+	}
+	fs := flag.NewFlagSet("trash", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy trash")
+		fmt.Fprintln(fs.Output(), "  devtidy trash purge [options]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Lists what devtidy moved to the trash and is still there. purge deletes it")
+		fmt.Fprintln(fs.Output(), "for good; see devtidy trash purge -h.")
+	}
+	fs.Parse(args)
+
+	entries, err := loadTrashLedger()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		fmt.Printf("%s  %9s  %s\n", e.Time.Format(time.DateTime), formatSize(e.Item.Size), displayPath(e.Item.Path))
+	}
+	fmt.Printf("%d items, %s in the trash", len(entries), formatSize(trashTotal(entries)))
+	if limit := activeConfig.trashLimit(); limit > 0 {
+		fmt.Printf(" (limit %s)", formatSize(limit))
+	}
+	fmt.Println()
+	return nil
+}
+
+func runTrashPurge(args []string) error {
+	fs := flag.NewFlagSet("trash purge", flag.ExitOnError)
+	olderThan := fs.String("older-than", "7d", "purge items trashed longer ago than this; 0 purges everything")
+	dryRun := fs.Bool("dry-run", false, "only list what would be purged")
+	addReadOnlyFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy trash purge [options]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Deletes what devtidy moved to the trash for good, leaving the rest of the")
+		fmt.Fprintln(fs.Output(), "trash alone.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		return fmt.Errorf("invalid --older-than: %w", err)
+	}
+	if activePolicy.RequireTrash && !*dryRun {
+		return errors.New("the policy requires the trash, so devtidy doesn't empty it")
+	}
+	entries, err := loadTrashLedger()
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-age)
+	old := func(e trashEntry) bool { return !e.Time.After(cutoff) }
+	if *dryRun || readOnly {
+		var n int
+		var size int64
+		for _, e := range entries {
+			if old(e) {
+				fmt.Printf("%s (%s)\n", displayPath(e.Item.Path), formatSize(e.Item.Size))
+				n++
+				size += e.Item.Size
+			}
+		}
+		fmt.Printf("Would free %s from %d items\n", formatSize(size), n)
+		return nil
+	}
+	kept, purged, failures := purgeTrashed(entries, old)
+	if err := saveTrashLedger(kept); err != nil {
+		return err
+	}
+	fmt.Printf("Freed %s from %d items\n", formatSize(trashTotal(purged)), len(purged))
+	for _, issue := range failures {
+		fmt.Fprintf(os.Stderr, "failed to purge %s: %s\n", displayPath(issue.Path), issue.Reason)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d items could not be purged", len(failures))
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// A clean that moved items to the trash can be undone: each item trashed is
+// recorded with where it went, and u in the UI or devtidy undo moves them
+// back. Only the last clean is kept, and a clean that deleted items
+// permanently leaves nothing to undo.
+
+// trashedItem is an item of the last clean and where in the trash it is.
+type trashedItem struct {
+	Item    CleanableItem `json:"item"`
+	Trashed string        `json:"trashed"`
+}
+
+type undoRecord struct {
+	Root  string        `json:"root"`
+	Time  time.Time     `json:"time"`
+	Items []trashedItem `json:"items"`
+}
+
+var errNothingToUndo = errors.New("nothing to undo: the last clean didn't move anything to the trash")
+
+func undoPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "last-clean.json"), nil
+}
+
+// saveUndo records a finished clean. Items moved to the trash make it
+// undoable; without any, an earlier record is dropped, since it no longer
+// describes the last clean.
+func saveUndo(root string, items []trashedItem) error {
+	path, err := undoPath()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(undoRecord{Root: root, Time: time.Now(), Items: items}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadUndo() (undoRecord, error) {
+	var record undoRecord
+	path, err := undoPath()
+	if err != nil {
+		return record, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return record, errNothingToUndo
+	}
+	if err != nil {
+		return record, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, fmt.Errorf("invalid undo record %s: %w", path, err)
+	}
+	return record, nil
+}
+
+// restoreTrashed moves an item back from the trash. Something created at its
+// path since is never overwritten.
+func restoreTrashed(t trashedItem) error {
+	if readOnly {
+		return errReadOnly
+	}
+	if _, err := os.Lstat(fsPath(t.Item.Path)); err == nil {
+		return errors.New("something was created at its path since")
+	}
+	if err := os.MkdirAll(fsPath(filepath.Dir(t.Item.Path)), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(fsPath(t.Trashed), fsPath(t.Item.Path)); err != nil {
+		return err
+	}
+	forgetTrashed(t.Trashed)
+	return nil
+}
+
+// undoLastClean restores the items of the last clean of root. Those that
+// can't be restored stay recorded, so undoing again retries them.
+func undoLastClean() (root string, restored []CleanableItem, failures []Issue, err error) {
+	record, err := loadUndo()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var left []trashedItem
+	for _, t := range record.Items {
+		if err := restoreTrashed(t); err != nil {
+			failures = append(failures, newIssue(t.Item.Path, phaseClean, err))
+			left = append(left, t)
+			continue
+		}
+		restored = append(restored, t.Item)
+	}
+	return record.Root, restored, failures, saveUndo(record.Root, left)
+}
+
+type undoMsg struct {
+	root     string
+	restored []CleanableItem
+	failures []Issue
+	err      error
+}
+
+func undoCmd() tea.Cmd {
+	return func() tea.Msg {
+		root, restored, failures, err := undoLastClean()
+		return undoMsg{root: root, restored: restored, failures: failures, err: err}
+	}
+}
+
+// undo restores the last clean, if it moved items to the trash.
+func (m Model) undo() (Model, tea.Cmd) {
+	m.statusMsg = "Restoring the last clean from the trash..."
+	return m, undoCmd()
+}
+
+// finishUndo lists the restored items again when they were cleaned from
+// the current root.
+func (m Model) finishUndo(msg undoMsg) (Model, tea.Cmd) {
+	if msg.err != nil && len(msg.restored) == 0 {
+		m.statusMsg = errorStyle.Render(msg.err.Error())
+		return m, nil
+	}
+	items := m.items.All()
+	var size int64
+	for _, item := range msg.restored {
+		size += item.Size
+		if msg.root != m.currentDir {
+			continue
+		}
+		if _, listed := m.items.Get(item.Path); !listed {
+			item.Selected, item.Cleaned = false, false
+			items = append(items, item)
+		}
+	}
+	m.trashedSize = max(m.trashedSize-size, 0)
+	m.rootFreed = max(m.rootFreed-size, 0)
+	m.items = newItemSet(items)
+	m.items.Sort(m.sortOrder)
+	m.scannedItems = m.items.Len()
+	m.statusMsg = successStyle.Render(fmt.Sprintf("Restored %d items (%s) from the trash", len(msg.restored), formatSize(size)))
+	if len(msg.failures) > 0 {
+		m.statusMsg += errorStyle.Render(fmt.Sprintf(" | %d could not be restored: %s", len(msg.failures), msg.failures[0].Reason))
+	}
+	return m, m.refreshList()
+}
+
+func runUndo(args []string) error {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	list := fs.Bool("list", false, "list what would be restored without restoring it")
+	addReadOnlyFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "USAGE:")
+		fmt.Fprintln(fs.Output(), "  devtidy undo [options]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Moves everything the last clean moved to the trash back where it was.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *list {
+		record, err := loadUndo()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Last clean of %s, %s:\n", displayPath(record.Root), record.Time.Format(time.DateTime))
+		for _, t := range record.Items {
+			fmt.Printf("  %s (%s)\n", displayPath(t.Item.Path), formatSize(t.Item.Size))
+		}
+		return nil
+	}
+
+	_, restored, failures, err := undoLastClean()
+	for _, item := range restored {
+		fmt.Printf("Restored %s\n", displayPath(item.Path))
+	}
+	for _, issue := range failures {
+		fmt.Fprintf(os.Stderr, "failed to restore %s: %s\n", displayPath(issue.Path), issue.Reason)
+	}
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d items could not be restored", len(failures))
+	}
+	return nil
+}
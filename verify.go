@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+
+	"github.com/charmbracelet/log"
+)
+
+// sizeCheck compares the size reported for an item with the bytes actually
+// freed when it was deleted, measured right before and after removal.
+type sizeCheck struct {
+	Path     string `json:"path"`
+	Reported int64  `json:"reported"`
+	Measured int64  `json:"measured"`
+}
+
+// sizeSlack is the smallest difference between the reported and the freed
+// bytes that counts as a mismatch. Sizes from disk quotas are in allocated
+// blocks, which round differently from one measurement to the next as
+// metadata is written; a hundredth of the size is allowed for large items.
+const sizeSlack = 64 << 10
+
+func (c sizeCheck) mismatch() bool {
+	diff := c.Reported - c.Measured
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff > max(sizeSlack, c.Reported/100)
+}
+
+// sampleIndexes picks n random queue positions to verify.
+func sampleIndexes(total, n int) []bool {
+	sample := make([]bool, total)
+	for _, i := range rand.Perm(total)[:min(n, total)] {
+		sample[i] = true
+	}
+	return sample
+}
+
+// measureRemoval deletes path like remove would and reports how many bytes
+// disappeared from disk, sized the way the scan sized the item.
+func measureRemoval(path string, remove func() error) (int64, error) {
+	before := measureSize(path)
+	err := remove()
+	return before - measureSize(path), err
+}
+
+// measureSize sizes path like the scan does: a directory with
+// getDirectorySizeFast, a file by its own size.
+func measureSize(path string) int64 {
+	info, err := os.Lstat(fsPath(path))
+	switch {
+	case err != nil:
+		return 0
+	case !info.IsDir():
+		return info.Size()
+	}
+	return getDirectorySizeFast(path)
+}
+
+func countMismatches(checks []sizeCheck) int {
+	count := 0
+	for _, c := range checks {
+		if c.mismatch() {
+			count++
+		}
+	}
+	return count
+}
+
+func verifySummary(checks []sizeCheck) string {
+	summary := fmt.Sprintf("Verified %d sampled items", len(checks))
+	if n := countMismatches(checks); n > 0 {
+		return summary + fmt.Sprintf(": %d size mismatches", n)
+	}
+	return summary + ": sizes match"
+}
+
+// logMismatches reports every sampled item whose freed bytes differ from the
+// size shown for it.
+func logMismatches(checks []sizeCheck) {
+	for _, c := range checks {
+		if c.mismatch() {
+			log.Warn("freed size differs from reported size",
+				"path", displayPath(c.Path),
+				"reported", formatSize(c.Reported),
+				"measured", formatSize(c.Measured))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The xcode-cache group lists what Xcode keeps under ~/Library/Developer,
+// which only exists on macOS: the DerivedData of every project built, the
+// debug symbols copied from each device ever plugged in, archived builds and
+// the simulators' caches. Each project, device version and archive is an
+// item of its own, so the ones still in use can be left alone.
+
+const (
+	xcodeDerivedDataPattern   = "xcode-derived-data"
+	xcodeDeviceSupportPattern = "xcode-device-support"
+	xcodeArchivePattern       = "xcode-archive"
+	simulatorCachesPattern    = "simulator-caches"
+)
+
+// deviceSupportPlatforms are the directories holding the symbols of each OS
+// version that devices were connected with.
+var deviceSupportPlatforms = []string{"iOS DeviceSupport", "watchOS DeviceSupport", "tvOS DeviceSupport", "visionOS DeviceSupport"}
+
+func developerDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "Library", "Developer")
+}
+
+// detectXcodeCaches lists the entries of Xcode's caches that exist.
+func detectXcodeCaches() []CleanableItem {
+	dev := developerDir()
+	if dev == "" {
+		return nil
+	}
+	xcode := filepath.Join(dev, "Xcode")
+	var items []CleanableItem
+	add := func(path, pattern, desc, info string) {
+		if item, ok := cacheItem(path, pattern, desc, info); ok {
+			items = append(items, item)
+		}
+	}
+
+	for _, dir := range subdirs(filepath.Join(xcode, "DerivedData")) {
+		if filepath.Base(dir) == "ModuleCache.noindex" {
+			add(dir, xcodeDerivedDataPattern, "Xcode module cache",
+				"Compiled modules shared by every project; the next builds compile them again")
+			continue
+		}
+		name := filepath.Base(dir)
+		if workspace := derivedDataWorkspace(dir); workspace != "" {
+			name = strings.TrimSuffix(filepath.Base(workspace), filepath.Ext(workspace))
+		}
+		add(dir, xcodeDerivedDataPattern, "Xcode DerivedData of "+name,
+			"Build products and indexes; Xcode rebuilds them on the next build, which takes longer")
+	}
+
+	for _, platform := range deviceSupportPlatforms {
+		versions := subdirs(filepath.Join(xcode, platform))
+		// the most recently used version is likely the one on the devices
+		// at hand, and copying it again takes minutes per device
+		slices.SortFunc(versions, func(a, b string) int { return modTimeOf(b).Compare(modTimeOf(a)) })
+		for _, dir := range versions[min(1, len(versions)):] {
+			add(dir, xcodeDeviceSupportPattern, strings.TrimSuffix(platform, " DeviceSupport")+" device support "+filepath.Base(dir),
+				"Debug symbols copied from a device; copied again when a device running this version is connected")
+		}
+	}
+
+	for _, day := range subdirs(filepath.Join(xcode, "Archives")) {
+		for _, dir := range subdirs(day) {
+			if strings.HasSuffix(dir, ".xcarchive") {
+				add(dir, xcodeArchivePattern, "Xcode archive "+strings.TrimSuffix(filepath.Base(dir), ".xcarchive"),
+					"An archived build and its symbols, needed to symbolicate crash reports of that release")
+			}
+		}
+	}
+
+	add(filepath.Join(dev, "CoreSimulator", "Caches"), simulatorCachesPattern, "Simulator caches",
+		"Shared caches of the simulator runtimes; the simulator recreates them when it boots, which takes longer")
+	return append(items, detectCocoaPodsCache()...)
+}
+
+// subdirs returns the directories in dir.
+func subdirs(dir string) []string {
+	entries, _ := os.ReadDir(fsPath(dir))
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, e.Name()))
+		}
+	}
+	return dirs
+}
+
+var workspacePathKey = regexp.MustCompile(`<key>WorkspacePath</key>\s*<string>([^<]+)</string>`)
+
+// derivedDataWorkspace reads which project a DerivedData directory was built
+// for, or "" when it doesn't tell.
+func derivedDataWorkspace(dir string) string {
+	data, err := os.ReadFile(fsPath(filepath.Join(dir, "info.plist")))
+	if err != nil {
+		return ""
+	}
+	if m := workspacePathKey.FindSubmatch(data); m != nil {
+		return string(m[1])
+	}
+	return ""
+}